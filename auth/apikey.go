@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+)
+
+// Области доступа API-ключей
+const (
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeCostRead           = "cost:read"
+	ScopeWebhooks           = "webhooks" // управление вебхуками и журналом доставок
+	ScopeAdmin              = "admin"    // доступ ко всем маршрутам, включая /admin/*
+)
+
+// APIKeyPrefix отличает API-ключи от прочих токенов и упрощает поиск утёкших ключей
+const APIKeyPrefix = "sk_"
+
+// IsScope сообщает, существует ли область доступа
+func IsScope(scope string) bool {
+	return slices.Contains([]string{ScopeSubscriptionsRead, ScopeSubscriptionsWrite, ScopeCostRead, ScopeWebhooks, ScopeAdmin}, scope)
+}
+
+// GenerateAPIKey создаёт новый ключ и возвращает его вместе с хешем для хранения.
+// Сам ключ показывается клиенту один раз и нигде не сохраняется.
+func GenerateAPIKey() (key, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey возвращает хеш ключа для поиска в хранилище.
+// Ключи случайные и длинные, поэтому медленный хеш вроде bcrypt не нужен.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
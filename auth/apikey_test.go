@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) < len(APIKeyPrefix)+40 {
+		t.Errorf("ключ %q", key)
+	}
+	// в хранилище попадает только хеш, и по нему ключ находится снова
+	if hash != HashAPIKey(key) || len(hash) != 64 || strings.Contains(hash, key) {
+		t.Errorf("хеш %q не соответствует ключу", hash)
+	}
+
+	other, otherHash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if other == key || otherHash == hash {
+		t.Error("два ключа совпали")
+	}
+	if HashAPIKey(key+"x") == hash {
+		t.Error("хеш не зависит от ключа")
+	}
+}
+
+func TestIsScope(t *testing.T) {
+	for _, scope := range []string{ScopeSubscriptionsRead, ScopeSubscriptionsWrite, ScopeCostRead, ScopeWebhooks, ScopeAdmin} {
+		if !IsScope(scope) {
+			t.Errorf("IsScope(%q) = false", scope)
+		}
+	}
+	for _, scope := range []string{"", "subscriptions", "Admin", "cost:write"} {
+		if IsScope(scope) {
+			t.Errorf("IsScope(%q) = true", scope)
+		}
+	}
+}
+
+func TestPrincipalHasScope(t *testing.T) {
+	user := Principal{UserID: "alice"}
+	reader := Principal{APIKeyID: 1, Scopes: []string{ScopeSubscriptionsRead}}
+	admin := Principal{APIKeyID: 2, Scopes: []string{ScopeAdmin}}
+
+	tests := []struct {
+		name  string
+		p     Principal
+		scope string
+		want  bool
+	}{
+		{name: "пользователь с JWT", p: user, scope: ScopeSubscriptionsWrite, want: true},
+		{name: "своя область", p: reader, scope: ScopeSubscriptionsRead, want: true},
+		{name: "чужая область", p: reader, scope: ScopeSubscriptionsWrite},
+		{name: "область admin", p: reader, scope: ScopeAdmin},
+		{name: "admin покрывает все", p: admin, scope: ScopeCostRead, want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.p.HasScope(tt.scope); got != tt.want {
+			t.Errorf("%s: HasScope(%q) = %v, want %v", tt.name, tt.scope, got, tt.want)
+		}
+	}
+}
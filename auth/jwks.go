@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// keySet — ключи из JWKS-файла по kid
+type keySet struct {
+	rsa  map[string]*rsa.PublicKey
+	hmac map[string][]byte
+}
+
+// jsonWebKey — поля JWK, нужные для RSA- и симметричных ключей
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// loadKeySet читает JWKS-файл. Поддерживаются ключи RSA (RS256) и oct (HS256); ключи без kid и ключи шифрования пропускаются.
+func loadKeySet(path string) (*keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("чтение JWKS: %w", err)
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("разбор JWKS: %w", err)
+	}
+
+	set := &keySet{rsa: map[string]*rsa.PublicKey{}, hmac: map[string][]byte{}}
+	for _, k := range doc.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			key, err := k.rsaPublicKey()
+			if err != nil {
+				return nil, fmt.Errorf("JWKS, ключ %q: %w", k.Kid, err)
+			}
+			set.rsa[k.Kid] = key
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("JWKS, ключ %q: некорректное поле k", k.Kid)
+			}
+			set.hmac[k.Kid] = secret
+		}
+	}
+	if len(set.rsa) == 0 && len(set.hmac) == 0 {
+		return nil, fmt.Errorf("в JWKS %s нет ключей подписи с kid", path)
+	}
+
+	return set, nil
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, fmt.Errorf("некорректный модуль n")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("некорректная экспонента e")
+	}
+
+	var exponent int
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+}
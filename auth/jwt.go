@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config описывает ключи и ограничения для проверки JWT.
+// Нужен хотя бы один источник ключей: HMACSecret, RSAPublicKeyFile или JWKSFile.
+type Config struct {
+	HMACSecret       string // общий секрет для HS256
+	RSAPublicKeyFile string // PEM-файл с публичным ключом для RS256
+	JWKSFile         string // локальный JWKS-файл; ключи выбираются по kid
+	Issuer           string // ожидаемый iss, если задан
+	Audience         string // ожидаемый aud, если задан
+}
+
+// Claims — поля токена, которые использует сервис. sub — ID пользователя.
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Verifier проверяет подпись и срок действия токенов
+type Verifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	jwks       *keySet
+	parser     *jwt.Parser
+}
+
+// NewVerifier загружает ключи из конфигурации
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{}
+	if cfg.HMACSecret != "" {
+		v.hmacSecret = []byte(cfg.HMACSecret)
+	}
+	if cfg.RSAPublicKeyFile != "" {
+		pemData, err := os.ReadFile(cfg.RSAPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("чтение публичного ключа: %w", err)
+		}
+		if v.rsaKey, err = jwt.ParseRSAPublicKeyFromPEM(pemData); err != nil {
+			return nil, fmt.Errorf("разбор публичного ключа: %w", err)
+		}
+	}
+	if cfg.JWKSFile != "" {
+		var err error
+		if v.jwks, err = loadKeySet(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if v.hmacSecret == nil && v.rsaKey == nil && v.jwks == nil {
+		return nil, errors.New("не задан ни один ключ для проверки JWT")
+	}
+
+	// алгоритм фиксирован, чтобы токен не мог подменить RS256 на HS256 с публичным ключом в роли секрета
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify проверяет токен и возвращает его владельца
+func (v *Verifier) Verify(token string) (Principal, error) {
+	var claims Claims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.key); err != nil {
+		return Principal{}, err
+	}
+	if claims.Subject == "" {
+		return Principal{}, errors.New("в токене нет sub")
+	}
+	return Principal{UserID: claims.Subject, Roles: claims.Roles}, nil
+}
+
+// key выбирает ключ проверки по алгоритму и kid токена
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if kid != "" && v.jwks != nil {
+			if secret, ok := v.jwks.hmac[kid]; ok {
+				return secret, nil
+			}
+		}
+		if v.hmacSecret != nil {
+			return v.hmacSecret, nil
+		}
+	case jwt.SigningMethodRS256.Alg():
+		if kid != "" && v.jwks != nil {
+			if key, ok := v.jwks.rsa[kid]; ok {
+				return key, nil
+			}
+		}
+		if v.rsaKey != nil {
+			return v.rsaKey, nil
+		}
+	}
+	return nil, fmt.Errorf("нет ключа для алгоритма %s (kid %q)", token.Method.Alg(), kid)
+}
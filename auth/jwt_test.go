@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testHMACSecret = "test-secret"
+
+var (
+	rsaKeysOnce sync.Once
+	rsaKey      *rsa.PrivateKey // ключ сервиса
+	otherRSAKey *rsa.PrivateKey // ключ, которому сервис не доверяет
+)
+
+// testRSAKeys генерирует RSA-ключи один раз на все тесты пакета
+func testRSAKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+
+	rsaKeysOnce.Do(func() {
+		var err error
+		if rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+		if otherRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+	})
+	return rsaKey, otherRSAKey
+}
+
+// writeFile сохраняет data во временный файл теста и возвращает путь к нему
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func publicKeyPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// validClaims — claims действующего токена пользователя alice
+func validClaims() Claims {
+	return Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "alice",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+}
+
+// sign подписывает claims методом method; kid добавляется в заголовок, если задан
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("подпись токена: %v", err)
+	}
+	return s
+}
+
+func TestVerifier(t *testing.T) {
+	key, otherKey := testRSAKeys(t)
+	v, err := NewVerifier(Config{
+		HMACSecret:       testHMACSecret,
+		RSAPublicKeyFile: writeFile(t, "public.pem", publicKeyPEM(t, key)),
+	})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+	noSubject := validClaims()
+	noSubject.Subject = ""
+	admin := validClaims()
+	admin.Roles = []string{RoleAdmin}
+
+	tests := []struct {
+		name      string
+		token     string
+		want      Principal
+		wantError bool
+	}{
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, []byte(testHMACSecret), "", validClaims()), want: Principal{UserID: "alice"}},
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, key, "", validClaims()), want: Principal{UserID: "alice"}},
+		{name: "роли из токена", token: sign(t, jwt.SigningMethodHS256, []byte(testHMACSecret), "", admin), want: Principal{UserID: "alice", Roles: []string{RoleAdmin}}},
+		{name: "HS256 просрочен", token: sign(t, jwt.SigningMethodHS256, []byte(testHMACSecret), "", expired), wantError: true},
+		{name: "RS256 просрочен", token: sign(t, jwt.SigningMethodRS256, key, "", expired), wantError: true},
+		{name: "без exp", token: sign(t, jwt.SigningMethodHS256, []byte(testHMACSecret), "", noExpiry), wantError: true},
+		{name: "без sub", token: sign(t, jwt.SigningMethodHS256, []byte(testHMACSecret), "", noSubject), wantError: true},
+		{name: "HS256 чужой секрет", token: sign(t, jwt.SigningMethodHS256, []byte("other-secret"), "", validClaims()), wantError: true},
+		{name: "RS256 чужой ключ", token: sign(t, jwt.SigningMethodRS256, otherKey, "", validClaims()), wantError: true},
+		{name: "алгоритм HS384", token: sign(t, jwt.SigningMethodHS384, []byte(testHMACSecret), "", validClaims()), wantError: true},
+		{name: "алгоритм none", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims()), wantError: true},
+		// публичный ключ известен всем, поэтому HS256 с ним в роли секрета не должен проходить
+		{name: "HS256 с публичным ключом RS256", token: sign(t, jwt.SigningMethodHS256, publicKeyPEM(t, key), "", validClaims()), wantError: true},
+		{name: "не JWT", token: "not-a-token", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("токен принят: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got.UserID != tt.want.UserID || !slices.Equal(got.Roles, tt.want.Roles) || got.APIKeyID != 0 {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifierIssuerAudience(t *testing.T) {
+	v, err := NewVerifier(Config{HMACSecret: testHMACSecret, Issuer: "https://id.example.com", Audience: "subscriptions"})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	withIssuer := func(iss string, aud ...string) Claims {
+		c := validClaims()
+		c.Issuer, c.Audience = iss, aud
+		return c
+	}
+	tests := []struct {
+		name   string
+		claims Claims
+		valid  bool
+	}{
+		{name: "совпадают", claims: withIssuer("https://id.example.com", "subscriptions"), valid: true},
+		{name: "другой iss", claims: withIssuer("https://evil.example.com", "subscriptions")},
+		{name: "другой aud", claims: withIssuer("https://id.example.com", "billing")},
+		{name: "без aud", claims: withIssuer("https://id.example.com")},
+	}
+
+	for _, tt := range tests {
+		_, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testHMACSecret), "", tt.claims))
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: err = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestVerifierJWKS(t *testing.T) {
+	key, otherKey := testRSAKeys(t)
+	hmacKey := []byte("jwks-secret")
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+		{"kty": "oct", "kid": "hmac-1", "k": b64(hmacKey)},
+		// ключ шифрования и ключ без kid пропускаются
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": b64(otherKey.N.Bytes()), "e": "AQAB"},
+		{"kty": "oct", "k": b64([]byte("no-kid"))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(Config{JWKSFile: writeFile(t, "jwks.json", jwks)})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "RS256 по kid", token: sign(t, jwt.SigningMethodRS256, key, "rsa-1", validClaims()), valid: true},
+		{name: "HS256 по kid", token: sign(t, jwt.SigningMethodHS256, hmacKey, "hmac-1", validClaims()), valid: true},
+		{name: "неизвестный kid", token: sign(t, jwt.SigningMethodRS256, key, "rsa-2", validClaims())},
+		{name: "без kid", token: sign(t, jwt.SigningMethodHS256, hmacKey, "", validClaims())},
+		{name: "ключ шифрования", token: sign(t, jwt.SigningMethodRS256, otherKey, "enc-1", validClaims())},
+		{name: "ключ без kid", token: sign(t, jwt.SigningMethodHS256, []byte("no-kid"), "", validClaims())},
+		// kid симметричного ключа не даёт выбрать его для RS256 и наоборот
+		{name: "HS256 с kid RSA-ключа", token: sign(t, jwt.SigningMethodHS256, publicKeyPEM(t, key), "rsa-1", validClaims())},
+		{name: "RS256 с kid HMAC-ключа", token: sign(t, jwt.SigningMethodRS256, key, "hmac-1", validClaims())},
+	}
+
+	for _, tt := range tests {
+		_, err := v.Verify(tt.token)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: err = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestNewVerifierErrors(t *testing.T) {
+	tests := map[string]Config{
+		"нет ключей":          {},
+		"нет PEM-файла":       {RSAPublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"не PEM":              {RSAPublicKeyFile: writeFile(t, "bad.pem", []byte("not a key"))},
+		"JWKS не JSON":        {JWKSFile: writeFile(t, "bad.json", []byte("{"))},
+		"JWKS без ключей":     {JWKSFile: writeFile(t, "empty.json", []byte(`{"keys":[]}`))},
+		"JWKS с пустым k":     {JWKSFile: writeFile(t, "oct.json", []byte(`{"keys":[{"kty":"oct","kid":"a","k":""}]}`))},
+		"JWKS с неверным n/e": {JWKSFile: writeFile(t, "rsa.json", []byte(`{"keys":[{"kty":"RSA","kid":"a","n":"!","e":"AQAB"}]}`))},
+	}
+	for name, cfg := range tests {
+		if _, err := NewVerifier(cfg); err == nil {
+			t.Errorf("%s: конфигурация принята", name)
+		}
+	}
+}
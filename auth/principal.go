@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// RoleAdmin даёт доступ к подпискам любых пользователей и к административным маршрутам
+const RoleAdmin = "admin"
+
+// Principal — аутентифицированный вызывающий: пользователь с JWT или сервис с API-ключом
+type Principal struct {
+	UserID   string   // у API-ключа без привязки к пользователю пусто
+	Roles    []string // роли из JWT
+	Scopes   []string // области доступа API-ключа
+	APIKeyID int      // ненулевой, если вызывающий вошёл по API-ключу
+}
+
+// IsAdmin сообщает, есть ли у вызывающего роль администратора или API-ключ с областью admin
+func (p Principal) IsAdmin() bool {
+	return slices.Contains(p.Roles, RoleAdmin) || (p.APIKeyID != 0 && slices.Contains(p.Scopes, ScopeAdmin))
+}
+
+// HasScope сообщает, разрешена ли вызывающему область доступа.
+// Пользователей с JWT ограничивает не область, а владение данными, поэтому для них всегда true.
+func (p Principal) HasScope(scope string) bool {
+	if p.APIKeyID == 0 {
+		return true
+	}
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// CanAccess сообщает, может ли вызывающий работать с данными пользователя userID.
+// API-ключ без привязки к пользователю работает с данными всех пользователей в пределах своих областей.
+func (p Principal) CanAccess(userID string) bool {
+	return p.CanAccessAll() || p.UserID == userID
+}
+
+// CanAccessAll сообщает, может ли вызывающий работать с данными всех пользователей сразу:
+// это администратор или API-ключ без привязки к пользователю
+func (p Principal) CanAccessAll() bool {
+	return p.IsAdmin() || (p.APIKeyID != 0 && p.UserID == "")
+}
+
+type principalKey struct{}
+
+// WithPrincipal сохраняет вызывающего в контексте запроса
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает вызывающего, сохранённого middleware аутентификации
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
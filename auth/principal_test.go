@@ -0,0 +1,41 @@
+package auth
+
+import "testing"
+
+func TestPrincipalAccess(t *testing.T) {
+	tests := []struct {
+		name      string
+		p         Principal
+		admin     bool
+		accessAll bool
+		own       bool // доступ к данным alice
+		other     bool // доступ к данным bob
+	}{
+		{name: "пользователь", p: Principal{UserID: "alice"}, own: true},
+		{name: "администратор", p: Principal{UserID: "alice", Roles: []string{RoleAdmin}}, admin: true, accessAll: true, own: true, other: true},
+		{name: "другая роль", p: Principal{UserID: "alice", Roles: []string{"support"}}, own: true},
+		{name: "ключ пользователя", p: Principal{UserID: "alice", APIKeyID: 1, Scopes: []string{ScopeSubscriptionsRead}}, own: true},
+		{name: "ключ без пользователя", p: Principal{APIKeyID: 1, Scopes: []string{ScopeSubscriptionsRead}}, accessAll: true, own: true, other: true},
+		{name: "ключ admin", p: Principal{UserID: "alice", APIKeyID: 1, Scopes: []string{ScopeAdmin}}, admin: true, accessAll: true, own: true, other: true},
+		// область admin есть только у API-ключей, а пользователь с JWT получает права администратора только по роли
+		{name: "область admin без ключа", p: Principal{UserID: "alice", Scopes: []string{ScopeAdmin}}, own: true},
+		{name: "пустой", p: Principal{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.IsAdmin(); got != tt.admin {
+				t.Errorf("IsAdmin = %v, want %v", got, tt.admin)
+			}
+			if got := tt.p.CanAccessAll(); got != tt.accessAll {
+				t.Errorf("CanAccessAll = %v, want %v", got, tt.accessAll)
+			}
+			if got := tt.p.CanAccess("alice"); got != tt.own {
+				t.Errorf("CanAccess(alice) = %v, want %v", got, tt.own)
+			}
+			if got := tt.p.CanAccess("bob"); got != tt.other {
+				t.Errorf("CanAccess(bob) = %v, want %v", got, tt.other)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package base
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCountActiveSubscriptions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+
+		tests := []struct {
+			at   time.Time
+			want int
+		}{
+			{at: date("2023-10-31"), want: 0},
+			{at: date("2024-02-15"), want: 3},
+			// время дня не учитывается, последний день подписки включается
+			{at: date("2024-06-30").Add(15 * time.Hour), want: 4},
+			{at: date("2025-01-01"), want: 2},
+		}
+		for _, tt := range tests {
+			n, err := store.CountActiveSubscriptions(context.Background(), tt.at)
+			if err != nil {
+				t.Fatalf("CountActiveSubscriptions(%v): %v", tt.at, err)
+			}
+			if n != tt.want {
+				t.Errorf("CountActiveSubscriptions(%v) = %d, want %d", tt.at, n, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey — ключ доступа для сервисов. Сам ключ не хранится: поиск идёт по его хешу.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name" example:"billing-export"`
+	Prefix     string     `json:"prefix" example:"sk_3fQ9x"` // начало ключа, чтобы узнать его в списке
+	Scopes     []string   `json:"scopes" example:"subscriptions:read,cost:read"`
+	UserID     string     `json:"user_id,omitempty"` // если задан, ключ даёт доступ только к данным этого пользователя
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CodeAPIKeyNotFound — стабильный код ошибки для отсутствующего ключа
+const CodeAPIKeyNotFound = "api_key_not_found"
+
+// ErrAPIKeyNotFound — ключа нет
+var ErrAPIKeyNotFound = &Error{Kind: ErrNotFound, Code: CodeAPIKeyNotFound, Message: "API-ключ не найден"}
+
+// Active сообщает, можно ли пользоваться ключом в момент now
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+const apiKeyColumns = "id, name, prefix, scopes, user_id, created_at, expires_at, last_used_at, revoked_at"
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var k APIKey
+	var userID sql.NullString
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &userID, &k.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	k.UserID = userID.String
+	k.ExpiresAt = nullTimePtr(expiresAt)
+	k.LastUsedAt = nullTimePtr(lastUsedAt)
+	k.RevokedAt = nullTimePtr(revokedAt)
+	return k, err
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// InsertAPIKey сохраняет новый ключ по его хешу
+func (p *PostgresStore) InsertAPIKey(ctx context.Context, key APIKey, hash string) (_ APIKey, err error) {
+	ctx, span := startQuery(ctx, "InsertAPIKey")
+	defer span.end(&err)
+
+	query := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, user_id, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING ` + apiKeyColumns
+	return scanAPIKey(p.db.QueryRowContext(ctx, query, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.UserID, key.ExpiresAt))
+}
+
+// SelectAPIKeys возвращает все ключи, включая отозванные и просроченные
+func (p *PostgresStore) SelectAPIKeys(ctx context.Context) (_ []APIKey, err error) {
+	ctx, span := startQuery(ctx, "SelectAPIKeys")
+	defer span.end(&err)
+
+	rows, err := p.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	span.rows(len(keys))
+	return keys, rows.Err()
+}
+
+// SelectAPIKeyByHash ищет ключ по хешу. Если ключа нет, возвращает ErrAPIKeyNotFound.
+func (p *PostgresStore) SelectAPIKeyByHash(ctx context.Context, hash string) (_ APIKey, err error) {
+	ctx, span := startQuery(ctx, "SelectAPIKeyByHash")
+	defer span.end(&err)
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	k, err := scanAPIKey(p.db.QueryRowContext(ctx, query, hash))
+	if err == sql.ErrNoRows {
+		return k, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+// RevokeAPIKey отзывает ключ. Повторный отзыв ничего не меняет.
+func (p *PostgresStore) RevokeAPIKey(ctx context.Context, id string) (err error) {
+	ctx, span := startQuery(ctx, "RevokeAPIKey")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	span.affected(n)
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey запоминает время последнего использования ключа
+func (p *PostgresStore) TouchAPIKey(ctx context.Context, id int, usedAt time.Time) (err error) {
+	ctx, span := startQuery(ctx, "TouchAPIKey")
+	defer span.end(&err)
+
+	_, err = p.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, usedAt, id)
+	return err
+}
@@ -0,0 +1,103 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		service, err := store.InsertAPIKey(ctx, APIKey{Name: "billing", Prefix: "sk_aaaaa", Scopes: []string{"subscriptions:read", "cost:read"}}, "hash-1")
+		if err != nil {
+			t.Fatalf("InsertAPIKey: %v", err)
+		}
+		personal, err := store.InsertAPIKey(ctx, APIKey{Name: "cli", Prefix: "sk_bbbbb", Scopes: []string{"subscriptions:write"}, UserID: testUser, ExpiresAt: &expiresAt}, "hash-2")
+		if err != nil {
+			t.Fatalf("InsertAPIKey: %v", err)
+		}
+		if service.ID == 0 || personal.ID == service.ID || service.CreatedAt.IsZero() {
+			t.Fatalf("ключи после вставки: %+v, %+v", service, personal)
+		}
+
+		found, err := store.SelectAPIKeyByHash(ctx, "hash-2")
+		if err != nil {
+			t.Fatalf("SelectAPIKeyByHash: %v", err)
+		}
+		if found.ID != personal.ID || found.UserID != testUser || !slices.Equal(found.Scopes, []string{"subscriptions:write"}) ||
+			found.ExpiresAt == nil || !found.ExpiresAt.Equal(expiresAt) || found.LastUsedAt != nil || found.RevokedAt != nil {
+			t.Errorf("найден ключ %+v", found)
+		}
+		if _, err := store.SelectAPIKeyByHash(ctx, "unknown"); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("неизвестный хеш: err = %v, want ErrAPIKeyNotFound", err)
+		}
+
+		usedAt := time.Now().Truncate(time.Second)
+		if err := store.TouchAPIKey(ctx, service.ID, usedAt); err != nil {
+			t.Fatalf("TouchAPIKey: %v", err)
+		}
+		found, err = store.SelectAPIKeyByHash(ctx, "hash-1")
+		if err != nil {
+			t.Fatalf("SelectAPIKeyByHash: %v", err)
+		}
+		if found.LastUsedAt == nil || !found.LastUsedAt.Equal(usedAt) {
+			t.Errorf("LastUsedAt = %v, want %v", found.LastUsedAt, usedAt)
+		}
+
+		if err := store.RevokeAPIKey(ctx, strconv.Itoa(service.ID)); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+		revoked, err := store.SelectAPIKeyByHash(ctx, "hash-1")
+		if err != nil || revoked.RevokedAt == nil {
+			t.Fatalf("отозванный ключ: %+v, %v", revoked, err)
+		}
+		// повторный отзыв не сдвигает время отзыва
+		if err := store.RevokeAPIKey(ctx, strconv.Itoa(service.ID)); err != nil {
+			t.Fatalf("повторный RevokeAPIKey: %v", err)
+		}
+		if again, _ := store.SelectAPIKeyByHash(ctx, "hash-1"); again.RevokedAt == nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+			t.Errorf("RevokedAt после повторного отзыва %v, want %v", again.RevokedAt, revoked.RevokedAt)
+		}
+		if err := store.RevokeAPIKey(ctx, "999"); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("отзыв неизвестного ключа: err = %v, want ErrAPIKeyNotFound", err)
+		}
+
+		// отозванные ключи остаются в списке
+		keys, err := store.SelectAPIKeys(ctx)
+		if err != nil {
+			t.Fatalf("SelectAPIKeys: %v", err)
+		}
+		if len(keys) != 2 || keys[0].ID != service.ID || keys[1].ID != personal.ID || keys[0].RevokedAt == nil {
+			t.Errorf("список ключей %+v", keys)
+		}
+	})
+}
+
+func TestAPIKeyActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	tests := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{name: "бессрочный", key: APIKey{}, want: true},
+		{name: "ещё действует", key: APIKey{ExpiresAt: &future}, want: true},
+		{name: "просрочен", key: APIKey{ExpiresAt: &past}},
+		{name: "истекает сейчас", key: APIKey{ExpiresAt: &now}},
+		{name: "отозван", key: APIKey{RevokedAt: &past}},
+		{name: "отозван до истечения", key: APIKey{ExpiresAt: &future, RevokedAt: &past}},
+	}
+	for _, tt := range tests {
+		if got := tt.key.Active(now); got != tt.want {
+			t.Errorf("%s: Active = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package base
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestInsertSubscriptionsAllOrNothing(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+
+		_, err := store.InsertSubscriptions(ctx, []Subscription{
+			{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd},
+			{UserID: testUser, Service: "spotify", Price: 0, StartDate: date("2024-01-01"), EndDate: openEnd},
+		})
+		assertFieldErrors(t, err, "[1].price")
+
+		page, err := store.SelectUsersSubscriptions(ctx, SubscriptionFilter{UserID: testUser})
+		if err != nil {
+			t.Fatalf("SelectUsersSubscriptions: %v", err)
+		}
+		if len(page.Subscriptions) != 0 {
+			t.Errorf("сохранена часть пачки: %v", serviceNames(page.Subscriptions))
+		}
+
+		ids := insertAll(t, store,
+			Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd},
+			Subscription{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: openEnd},
+		)
+		for i, want := range []string{"netflix", "spotify"} {
+			s, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(ids[i]), false)
+			if err != nil {
+				t.Fatalf("SelectSubscriptionByID(%d): %v", ids[i], err)
+			}
+			if s.Service != want {
+				t.Errorf("ID %d: service = %q, want %q", ids[i], s.Service, want)
+			}
+		}
+	})
+}
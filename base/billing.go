@@ -0,0 +1,111 @@
+package base
+
+import (
+	"math"
+	"time"
+)
+
+// Периоды списания подписки. Price — сумма одного списания за период.
+const (
+	BillingWeekly    = "weekly"
+	BillingMonthly   = "monthly"
+	BillingQuarterly = "quarterly"
+	BillingAnnual    = "annual"
+)
+
+// IsBillingPeriod сообщает, поддерживается ли период списания
+func IsBillingPeriod(period string) bool {
+	switch period {
+	case BillingWeekly, BillingMonthly, BillingQuarterly, BillingAnnual:
+		return true
+	}
+	return false
+}
+
+// normalizeBillingPeriod подставляет BillingMonthly для пустого периода
+func normalizeBillingPeriod(period string) string {
+	if period == "" {
+		return BillingMonthly
+	}
+	return period
+}
+
+// MonthlyEquivalentPrice возвращает цену подписки, приведённую к одному месяцу,
+// с точностью до двух знаков: например, годовая подписка за 1200 стоит 100 в месяц
+func MonthlyEquivalentPrice(price int, period string) float64 {
+	var monthly float64
+	switch normalizeBillingPeriod(period) {
+	case BillingWeekly:
+		monthly = float64(price) * 52 / 12
+	case BillingQuarterly:
+		monthly = float64(price) / 3
+	case BillingAnnual:
+		monthly = float64(price) / 12
+	default:
+		monthly = float64(price)
+	}
+	return math.Round(monthly*100) / 100
+}
+
+// withMonthlyPrice заполняет вычисляемое поле MonthlyPrice
+func withMonthlyPrice(s Subscription) Subscription {
+	s.MonthlyPrice = MonthlyEquivalentPrice(s.Price, s.BillingPeriod)
+	return s
+}
+
+// billingDates возвращает даты списаний подписки, попадающие в отрезок [from, to].
+// Списания отсчитываются от даты начала подписки, но перебираются только внутри отрезка:
+// номер первого списания не раньше from вычисляется сразу, поэтому старые подписки не дороже новых.
+func billingDates(s Subscription, from, to time.Time) []time.Time {
+	start := dayStart(s.StartDate)
+	from, to = dayStart(from), dayStart(to)
+
+	period := normalizeBillingPeriod(s.BillingPeriod)
+	var dates []time.Time
+	for n := firstBillingIndex(period, start, from); ; n++ {
+		var date time.Time
+		switch period {
+		case BillingWeekly:
+			date = start.AddDate(0, 0, 7*n)
+		case BillingQuarterly:
+			date = addMonthsClamped(start, 3*n)
+		case BillingAnnual:
+			date = addMonthsClamped(start, 12*n)
+		default:
+			date = addMonthsClamped(start, n)
+		}
+		if date.After(to) {
+			break
+		}
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// firstBillingIndex возвращает номер последнего списания, которое не позже from по неделям или месяцам.
+// Точная дата этого списания может оказаться раньше from, поэтому billingDates её ещё проверяет.
+func firstBillingIndex(period string, start, from time.Time) int {
+	if !from.After(start) {
+		return 0
+	}
+	switch period {
+	case BillingWeekly:
+		return int(from.Sub(start)/(24*time.Hour)) / 7
+	case BillingQuarterly:
+		return (CountMonths(start, from) - 1) / 3
+	case BillingAnnual:
+		return (CountMonths(start, from) - 1) / 12
+	default:
+		return CountMonths(start, from) - 1
+	}
+}
+
+// addMonthsClamped прибавляет месяцы, не перескакивая в следующий месяц:
+// 31 января + 1 месяц = 29 февраля (в високосный год), а не 2 марта
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), lastDay)-1)
+}
@@ -0,0 +1,200 @@
+package base
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInsertSubscriptionDefaults(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+
+		ids := insertAll(t, store,
+			Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd},
+			Subscription{UserID: testUser, Service: "jetbrains", Price: 1200, Currency: "usd", BillingPeriod: BillingAnnual, StartDate: date("2024-01-01"), EndDate: openEnd},
+		)
+
+		tests := []struct {
+			id           int
+			currency     string
+			period       string
+			monthlyPrice float64
+		}{
+			{id: ids[0], currency: DefaultCurrency, period: BillingMonthly, monthlyPrice: 400},
+			{id: ids[1], currency: "USD", period: BillingAnnual, monthlyPrice: 100},
+		}
+		for _, tt := range tests {
+			s, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(tt.id), false)
+			if err != nil {
+				t.Fatalf("SelectSubscriptionByID(%d): %v", tt.id, err)
+			}
+			if s.Currency != tt.currency || s.BillingPeriod != tt.period || s.MonthlyPrice != tt.monthlyPrice {
+				t.Errorf("ID %d: got %s/%s/%v, want %s/%s/%v", tt.id,
+					s.Currency, s.BillingPeriod, s.MonthlyPrice, tt.currency, tt.period, tt.monthlyPrice)
+			}
+			if !s.StartDate.Equal(date("2024-01-01")) || !s.EndDate.Equal(openEnd) {
+				t.Errorf("ID %d: dates %v - %v", tt.id, s.StartDate, s.EndDate)
+			}
+		}
+	})
+}
+func TestMonthlyEquivalentPrice(t *testing.T) {
+	tests := []struct {
+		price  int
+		period string
+		want   float64
+	}{
+		{price: 400, period: "", want: 400},
+		{price: 400, period: BillingMonthly, want: 400},
+		{price: 100, period: BillingWeekly, want: 433.33},
+		{price: 1000, period: BillingQuarterly, want: 333.33},
+		{price: 1200, period: BillingAnnual, want: 100},
+		{price: 1000, period: BillingAnnual, want: 83.33},
+	}
+
+	for _, tt := range tests {
+		if got := MonthlyEquivalentPrice(tt.price, tt.period); got != tt.want {
+			t.Errorf("MonthlyEquivalentPrice(%d, %q) = %v, want %v", tt.price, tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestAddMonthsClamped(t *testing.T) {
+	tests := []struct {
+		from   string
+		months int
+		want   string
+	}{
+		{from: "2024-01-15", months: 1, want: "2024-02-15"},
+		{from: "2024-01-31", months: 1, want: "2024-02-29"},
+		{from: "2023-01-31", months: 1, want: "2023-02-28"},
+		{from: "2024-01-31", months: 3, want: "2024-04-30"},
+		{from: "2024-02-29", months: 12, want: "2025-02-28"},
+		{from: "2024-11-30", months: 3, want: "2025-02-28"},
+		{from: "2024-03-31", months: 0, want: "2024-03-31"},
+	}
+
+	for _, tt := range tests {
+		if got := addMonthsClamped(date(tt.from), tt.months); !got.Equal(date(tt.want)) {
+			t.Errorf("addMonthsClamped(%s, %d) = %s, want %s", tt.from, tt.months, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
+
+func TestBillingDates(t *testing.T) {
+	tests := []struct {
+		name     string
+		period   string
+		start    string
+		from, to string
+		want     []string
+	}{
+		{
+			name: "еженедельная внутри периода", period: BillingWeekly, start: "2024-01-01",
+			from: "2024-01-10", to: "2024-01-31", want: []string{"2024-01-15", "2024-01-22", "2024-01-29"},
+		},
+		{
+			name: "еженедельная с давним началом", period: BillingWeekly, start: "1990-01-01",
+			from: "2024-01-01", to: "2024-01-14", want: []string{"2024-01-01", "2024-01-08"},
+		},
+		{
+			name: "ежемесячная с конца месяца", period: BillingMonthly, start: "2023-01-31",
+			from: "2024-02-01", to: "2024-04-30", want: []string{"2024-02-29", "2024-03-31", "2024-04-30"},
+		},
+		{
+			name: "квартальная", period: BillingQuarterly, start: "2020-02-15",
+			from: "2024-02-16", to: "2024-12-31", want: []string{"2024-05-15", "2024-08-15", "2024-11-15"},
+		},
+		{
+			name: "годовая в день списания", period: BillingAnnual, start: "2000-02-29",
+			from: "2024-02-29", to: "2025-03-01", want: []string{"2024-02-29", "2025-02-28"},
+		},
+		{
+			name: "период до начала подписки", period: BillingWeekly, start: "2024-01-10",
+			from: "2024-01-01", to: "2024-01-20", want: []string{"2024-01-10", "2024-01-17"},
+		},
+		{
+			name: "без списаний в периоде", period: BillingAnnual, start: "2023-06-15",
+			from: "2024-01-01", to: "2024-06-14",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Subscription{BillingPeriod: tt.period, StartDate: date(tt.start)}
+			var got []string
+			for _, d := range billingDates(s, date(tt.from), date(tt.to)) {
+				got = append(got, d.Format(time.DateOnly))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestBillingDatesWindow сверяет billingDates с перебором всех списаний от начала подписки
+func TestBillingDatesWindow(t *testing.T) {
+	for _, period := range []string{BillingWeekly, BillingMonthly, BillingQuarterly, BillingAnnual} {
+		for _, start := range []string{"2023-01-31", "2023-02-28", "2023-03-15", "2023-12-31"} {
+			s := Subscription{BillingPeriod: period, StartDate: date(start)}
+			all := billingDates(s, s.StartDate, date("2027-12-31"))
+
+			for from := date("2022-12-01"); from.Before(date("2026-12-31")); from = from.AddDate(0, 0, 5) {
+				to := from.AddDate(0, 2, 0)
+				var want []time.Time
+				for _, d := range all {
+					if !d.Before(from) && !d.After(to) {
+						want = append(want, d)
+					}
+				}
+				if got := billingDates(s, from, to); !slices.EqualFunc(got, want, time.Time.Equal) {
+					t.Fatalf("%s с %s, отрезок %s - %s: got %v, want %v", period, start,
+						from.Format(time.DateOnly), to.Format(time.DateOnly), got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCountSubscriptionsCostBillingPeriods(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "годовая подписка списывается в дату начала",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "jetbrains", Price: 1200, BillingPeriod: BillingAnnual, StartDate: date("2023-06-15"), EndDate: openEnd},
+			},
+			filter:     CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-12-31"), Breakdown: true},
+			want:       1200,
+			wantMonths: []int{0, 0, 0, 0, 0, 1200, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "годовая подписка без списания в периоде",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "jetbrains", Price: 1200, BillingPeriod: BillingAnnual, StartDate: date("2023-06-15"), EndDate: openEnd},
+			},
+			filter: CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-06-14")},
+			want:   0,
+		},
+		{
+			name: "квартальная подписка с конца месяца",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "icloud", Price: 300, BillingPeriod: BillingQuarterly, StartDate: date("2024-01-31"), EndDate: openEnd},
+			},
+			filter: year2024,
+			want:   1200,
+		},
+		{
+			name: "еженедельная подписка",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "news", Price: 100, BillingPeriod: BillingWeekly, StartDate: date("2024-01-01"), EndDate: openEnd},
+			},
+			filter: CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+			// списания 1, 8, 15, 22 и 29 января
+			want: 500,
+		},
+	})
+}
@@ -1,8 +1,9 @@
 package base
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -11,12 +12,44 @@ type CostFilter struct {
 	ServiceName string
 	StartDate   time.Time
 	EndDate     time.Time
+	Breakdown   bool   // заполнить CostReport.Months помесячной разбивкой
+	Currency    string // валюта отчёта, по умолчанию DefaultCurrency
+	Prorate     bool   // считать неполные месяцы пропорционально активным дням
+
+	IncludeDeleted bool // учитывать мягко удалённые подписки
+}
+
+// CostReport — результат подсчёта стоимости подписок
+type CostReport struct {
+	Total        int           `json:"total"`
+	Currency     string        `json:"currency"`
+	Months       []MonthCost   `json:"months,omitempty"`        // по одной записи на каждый месяц периода, если запрошена разбивка
+	MissingRates []MissingRate `json:"missing_rates,omitempty"` // месяцы без курса, не вошедшие в итог
+}
+
+// MonthCost — стоимость подписок за один месяц периода
+type MonthCost struct {
+	Month         string          `json:"month" example:"01-2024"` // месяц в формате MM-YYYY
+	Total         int             `json:"total"`
+	Subscriptions []MonthCostItem `json:"subscriptions"`
+}
+
+// MonthCostItem — вклад одной подписки в стоимость месяца
+type MonthCostItem struct {
+	SubscriptionID int    `json:"subscription_id"`
+	Service        string `json:"service_name"`
+	Price          int    `json:"price"`    // цена в валюте подписки
+	Currency       string `json:"currency"` // валюта подписки
+	Amount         int    `json:"amount"`   // цена в валюте отчёта
 }
 
 // CountSubscriptionsCost считает суммарную стоимость подписок по фильтру
-func CountSubscriptionsCost(db *sql.DB, filter CostFilter) (int, error) {
+func (p *PostgresStore) CountSubscriptionsCost(ctx context.Context, filter CostFilter) (_ CostReport, err error) {
+	ctx, span := startQuery(ctx, "CountSubscriptionsCost")
+	defer span.end(&err)
+
 	query := `
-        SELECT user_id, service_name, price, start_date, end_date
+        SELECT ` + subscriptionColumns + `
         FROM subscriptions
         WHERE (start_date <= $2) AND (end_date IS NULL OR end_date >= $1)
     `
@@ -30,22 +63,98 @@ func CountSubscriptionsCost(db *sql.DB, filter CostFilter) (int, error) {
 		query += " AND service_name = $" + fmt.Sprint(len(args)+1)
 		args = append(args, filter.ServiceName)
 	}
+	if !filter.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	query += " ORDER BY id"
 
-	rows, err := db.Query(query, args...)
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return 0, err
+		return CostReport{}, err
 	}
 	defer rows.Close()
 
-	var total int
+	var subscriptions []Subscription
 
 	for rows.Next() {
-		var s Subscription
-		err := rows.Scan(&s.UserID, &s.Service, &s.Price, &s.StartDate, &s.EndDate)
+		s, err := scanSubscription(rows)
 		if err != nil {
-			return 0, err
+			return CostReport{}, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return CostReport{}, err
+	}
+	span.rows(len(subscriptions))
+
+	ids := make([]int, len(subscriptions))
+	for i, s := range subscriptions {
+		ids[i] = s.ID
+	}
+	histories, err := p.selectPriceHistories(ctx, ids)
+	if err != nil {
+		return CostReport{}, err
+	}
+	rates, err := p.selectRateTable(ctx, costCurrencies(subscriptions, filter), filter.StartDate, filter.EndDate)
+	if err != nil {
+		return CostReport{}, err
+	}
+
+	return buildCostReport(subscriptions, histories, rates, filter), nil
+}
+
+// buildCostReport считает стоимость подписок в пределах периода фильтра.
+// Помесячные подписки оплачиваются за каждый месяц по цене, действовавшей в нём согласно
+// истории цен: по умолчанию любой затронутый месяц целиком, при filter.Prorate — пропорционально
+// активным дням. Остальные подписки оплачиваются в даты списания, попавшие в период.
+// Каждое списание переводится в валюту отчёта по курсу своего месяца.
+// Помесячная разбивка строится из тех же списаний, что и общий итог,
+// поэтому сумма по месяцам всегда совпадает с Total.
+func buildCostReport(subscriptions []Subscription, histories map[int][]PriceChange, rates rateTable, filter CostFilter) CostReport {
+	report := CostReport{Currency: normalizeCurrency(filter.Currency)}
+	if filter.Breakdown {
+		report.Months = make([]MonthCost, max(CountMonths(filter.StartDate, filter.EndDate), 0))
+		for i := range report.Months {
+			month := time.Date(filter.StartDate.Year(), filter.StartDate.Month()+time.Month(i), 1, 0, 0, 0, 0, time.UTC)
+			report.Months[i] = MonthCost{
+				Month:         month.Format("01-2006"),
+				Subscriptions: []MonthCostItem{},
+			}
+		}
+	}
+	// месяцы без курса: ключ — месяц и валюта, для которой не нашлось курса
+	type missingKey struct {
+		month    time.Time
+		currency string
+	}
+	missing := map[missingKey]bool{}
+
+	// addCharge учитывает одно списание подписки s в месяце month:
+	// price — цена в валюте подписки, charge — списанная сумма с учётом пропорции
+	addCharge := func(s Subscription, month time.Time, price int, charge float64) {
+		currency := normalizeCurrency(s.Currency)
+		amount, missingCurrency := rates.convert(charge, currency, report.Currency, month)
+		if missingCurrency != "" {
+			missing[missingKey{month: monthStart(month), currency: missingCurrency}] = true
+			return
+		}
+		report.Total += amount
+
+		// индекс месяца относительно начала периода фильтра
+		if i := CountMonths(filter.StartDate, month) - 1; i >= 0 && i < len(report.Months) {
+			report.Months[i].Total += amount
+			report.Months[i].Subscriptions = append(report.Months[i].Subscriptions, MonthCostItem{
+				SubscriptionID: s.ID,
+				Service:        s.Service,
+				Price:          price,
+				Currency:       currency,
+				Amount:         amount,
+			})
 		}
+	}
 
+	for _, s := range subscriptions {
 		start := maxDate(s.StartDate, filter.StartDate)
 		end := minDate(s.EndDate, filter.EndDate)
 
@@ -53,11 +162,66 @@ func CountSubscriptionsCost(db *sql.DB, filter CostFilter) (int, error) {
 			continue // подписка не активна в заданном периоде
 		}
 
-		months := countMonths(start, end)
-		total += s.Price * months
+		if normalizeBillingPeriod(s.BillingPeriod) != BillingMonthly {
+			for _, date := range billingDates(s, start, end) {
+				price := s.Price
+				if p, ok := priceAt(histories[s.ID], date); ok {
+					price = p
+				}
+				addCharge(s, date, price, float64(price))
+			}
+			continue
+		}
+
+		for _, period := range pricedPeriods(s, histories[s.ID], start, end) {
+			months := CountMonths(period.Start, period.End)
+			if normalizeCurrency(s.Currency) == report.Currency && report.Months == nil && !filter.Prorate {
+				// без конвертации, разбивки и пропорции месяцы можно не перебирать
+				report.Total += period.Price * months
+				continue
+			}
+
+			for k := 0; k < months; k++ {
+				month := time.Date(period.Start.Year(), period.Start.Month()+time.Month(k), 1, 0, 0, 0, 0, time.UTC)
+				charge := float64(period.Price)
+				if filter.Prorate {
+					charge *= activeFraction(month, period.Start, period.End)
+				}
+				addCharge(s, month, period.Price, charge)
+			}
+		}
 	}
 
-	return total, nil
+	keys := make([]missingKey, 0, len(missing))
+	for k := range missing {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].month.Equal(keys[j].month) {
+			return keys[i].month.Before(keys[j].month)
+		}
+		return keys[i].currency < keys[j].currency
+	})
+	for _, k := range keys {
+		report.MissingRates = append(report.MissingRates, MissingRate{Month: k.month.Format("01-2006"), Currency: k.currency})
+	}
+
+	return report
+}
+
+// costCurrencies возвращает валюты, курсы которых понадобятся для отчёта
+func costCurrencies(subscriptions []Subscription, filter CostFilter) []string {
+	seen := map[string]bool{normalizeCurrency(filter.Currency): true}
+	for _, s := range subscriptions {
+		seen[normalizeCurrency(s.Currency)] = true
+	}
+	delete(seen, DefaultCurrency)
+
+	currencies := make([]string, 0, len(seen))
+	for c := range seen {
+		currencies = append(currencies, c)
+	}
+	return currencies
 }
 
 func maxDate(a, b time.Time) time.Time {
@@ -74,8 +238,23 @@ func minDate(a, b time.Time) time.Time {
 	return b
 }
 
-// считает количество месяцев между двумя датами включительно
-func countMonths(start, end time.Time) int {
+// activeFraction возвращает долю дней месяца month, попадающих в отрезок [start, end]
+func activeFraction(month, start, end time.Time) float64 {
+	first := month
+	last := month.AddDate(0, 1, -1)
+
+	from := maxDate(first, dayStart(start))
+	to := minDate(last, dayStart(end))
+	if from.After(to) {
+		return 0
+	}
+
+	activeDays := int(to.Sub(from).Hours()/24) + 1
+	return float64(activeDays) / float64(last.Day())
+}
+
+// CountMonths считает количество месяцев между двумя датами включительно
+func CountMonths(start, end time.Time) int {
 	year1, month1 := start.Year(), int(start.Month())
 	year2, month2 := end.Year(), int(end.Month())
 
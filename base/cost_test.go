@@ -0,0 +1,224 @@
+package base
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// costCase — случай подсчёта стоимости, который прогоняется на каждом хранилище
+type costCase struct {
+	name          string
+	subscriptions []Subscription
+	deleted       []int         // индексы подписок, удаляемых перед подсчётом
+	prices        []PriceChange // SubscriptionID — индекс подписки в subscriptions
+	rates         []ExchangeRate
+	filter        CostFilter
+	want          int
+	wantMonths    []int // итоги по месяцам, если запрошена разбивка
+	wantMissing   []MissingRate
+}
+
+// year2024 — период отчёта за весь 2024 год
+var year2024 = CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-12-31")}
+
+func withFilter(f CostFilter, modify func(f *CostFilter)) CostFilter {
+	modify(&f)
+	return f
+}
+
+func TestCountSubscriptionsCost(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "каждый затронутый месяц целиком",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-15"), EndDate: date("2024-03-10")},
+			},
+			filter: year2024,
+			want:   1200,
+		},
+		{
+			name: "период фильтра обрезает подписку",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-15"), EndDate: openEnd},
+			},
+			filter: CostFilter{StartDate: date("2024-02-01"), EndDate: date("2024-04-30")},
+			want:   1200,
+		},
+		{
+			name: "подписка вне периода",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2023-01-01"), EndDate: date("2023-12-31")},
+				{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2025-01-01"), EndDate: openEnd},
+			},
+			filter: year2024,
+			want:   0,
+		},
+		{
+			name: "фильтр по пользователю и сервису",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+				{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+				{UserID: otherUser, Service: "netflix", Price: 250, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+			},
+			filter: withFilter(year2024, func(f *CostFilter) { f.UserID, f.ServiceName = testUser, "netflix" }),
+			want:   400,
+		},
+	})
+}
+
+func TestCountSubscriptionsCostBreakdown(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "разбивка по месяцам",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 100, StartDate: date("2024-01-01"), EndDate: date("2024-02-29")},
+				{UserID: testUser, Service: "spotify", Price: 50, StartDate: date("2024-02-10"), EndDate: date("2024-03-05")},
+			},
+			filter:     CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-04-30"), Breakdown: true},
+			want:       300,
+			wantMonths: []int{100, 150, 50, 0},
+		},
+		{
+			name: "месяцы без подписок остаются в разбивке",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2025-01-01"), EndDate: openEnd},
+			},
+			filter:     CostFilter{StartDate: date("2024-10-01"), EndDate: date("2024-12-31"), Breakdown: true},
+			want:       0,
+			wantMonths: []int{0, 0, 0},
+		},
+	})
+}
+
+func TestCountSubscriptionsCostProrate(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "пропорционально активным дням",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 310, StartDate: date("2024-01-01"), EndDate: date("2024-01-16")},
+				{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-03-17"), EndDate: openEnd},
+			},
+			filter: CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-04-30"), Prorate: true, Breakdown: true},
+			// январь: 16 из 31 дня от 310, март: 15 из 31 дня от 300
+			want:       160 + 145 + 300,
+			wantMonths: []int{160, 0, 145, 300},
+		},
+		{
+			name: "високосный февраль",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 290, StartDate: date("2024-02-01"), EndDate: date("2024-02-10")},
+			},
+			filter: CostFilter{StartDate: date("2024-02-01"), EndDate: date("2024-02-29"), Prorate: true},
+			// 10 из 29 дней
+			want: 100,
+		},
+		{
+			name: "период фильтра не урезает оплату месяца",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 300, StartDate: date("2024-01-01"), EndDate: openEnd},
+			},
+			filter: CostFilter{StartDate: date("2024-04-16"), EndDate: date("2024-04-30"), Prorate: true},
+			want:   150,
+		},
+	})
+}
+
+func TestActiveFraction(t *testing.T) {
+	tests := []struct {
+		name       string
+		month      time.Time
+		start, end time.Time
+		want       float64
+	}{
+		{name: "весь месяц", month: date("2024-01-01"), start: date("2023-12-15"), end: date("2024-02-15"), want: 1},
+		{name: "с середины месяца", month: date("2024-04-01"), start: date("2024-04-16"), end: openEnd, want: 0.5},
+		{name: "один день", month: date("2024-02-01"), start: date("2024-02-29"), end: date("2024-02-29"), want: 1.0 / 29},
+		{name: "время дня не учитывается", month: date("2024-04-01"), start: date("2024-04-01").Add(23 * time.Hour), end: date("2024-04-15").Add(time.Hour), want: 0.5},
+		{name: "вне месяца", month: date("2024-03-01"), start: date("2024-04-01"), end: date("2024-05-01"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activeFraction(tt.month, tt.start, tt.end); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("activeFraction = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// runCostCases проверяет итог, разбивку и месяцы без курса для каждого случая.
+// Каждый случай считается ещё раз с противоположным Breakdown: итог от разбивки не зависит.
+func runCostCases(t *testing.T, tests []costCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+				ctx := context.Background()
+
+				ids := insertAll(t, store, tt.subscriptions...)
+				for _, change := range tt.prices {
+					change.SubscriptionID = ids[change.SubscriptionID]
+					if _, err := store.AddPriceChange(ctx, change); err != nil {
+						t.Fatalf("AddPriceChange: %v", err)
+					}
+				}
+				for _, i := range tt.deleted {
+					deleteSubscription(t, store, ids[i])
+				}
+				if len(tt.rates) > 0 {
+					if err := store.UpsertExchangeRates(ctx, tt.rates); err != nil {
+						t.Fatalf("UpsertExchangeRates: %v", err)
+					}
+				}
+
+				report, err := store.CountSubscriptionsCost(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("CountSubscriptionsCost: %v", err)
+				}
+				if report.Total != tt.want {
+					t.Errorf("Total = %d, want %d", report.Total, tt.want)
+				}
+				if tt.wantMonths != nil && !slices.Equal(monthTotals(report), tt.wantMonths) {
+					t.Errorf("месяцы = %v, want %v", monthTotals(report), tt.wantMonths)
+				}
+				if !slices.Equal(report.MissingRates, tt.wantMissing) {
+					t.Errorf("MissingRates = %v, want %v", report.MissingRates, tt.wantMissing)
+				}
+
+				// разбивка строится из тех же списаний, что и итог
+				filter := tt.filter
+				filter.Breakdown = !filter.Breakdown
+				other, err := store.CountSubscriptionsCost(ctx, filter)
+				if err != nil {
+					t.Fatalf("CountSubscriptionsCost с Breakdown=%v: %v", filter.Breakdown, err)
+				}
+				if other.Total != report.Total {
+					t.Errorf("Total с Breakdown=%v = %d, без = %d", filter.Breakdown, other.Total, report.Total)
+				}
+				breakdown := report
+				if filter.Breakdown {
+					breakdown = other
+				}
+				var sum int
+				for _, total := range monthTotals(breakdown) {
+					sum += total
+				}
+				if sum != breakdown.Total {
+					t.Errorf("сумма по месяцам %d не равна Total %d", sum, breakdown.Total)
+				}
+			})
+		})
+	}
+}
+
+func monthTotals(report CostReport) []int {
+	totals := make([]int, len(report.Months))
+	for i, m := range report.Months {
+		totals[i] = m.Total
+	}
+	return totals
+}
@@ -1,124 +1,607 @@
 package base
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Subscription struct {
 	ID        int       `json:"id"`
 	UserID    string    `json:"user_id"`      //ID пользователя в формате UUID
 	Service   string    `json:"service_name"` //Название сервиса, предоставляющего подписку
-	Price     int       `json:"price"`        //Стоимость месячной подписки в рублях
-	StartDate time.Time `json:"start_date"`   //Дата начала подписки (месяц и год)
-	EndDate   time.Time `json:"end_date"`     //Дата окончания подписки
+	Price     int       `json:"price"`        //Стоимость одного списания в валюте Currency
+	Currency  string    `json:"currency"`     //Код валюты ISO 4217, по умолчанию RUB
+	StartDate time.Time `json:"start_date"`   //Дата начала подписки, от неё отсчитываются списания
+	EndDate   time.Time `json:"end_date"`     //Дата окончания подписки (последний активный день)
+
+	BillingPeriod string  `json:"billing_period"` //Период списания: weekly, monthly, quarterly или annual
+	MonthlyPrice  float64 `json:"monthly_price"`  //Цена, приведённая к месяцу (вычисляется, при записи игнорируется)
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` //Время мягкого удаления; nil, если подписка не удалена
+}
+
+// subscriptionColumns — колонки subscriptions в порядке, который ожидает scanSubscription
+const subscriptionColumns = "id, user_id, service_name, price, currency, start_date, end_date, billing_period, deleted_at"
+
+// rowScanner — общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row rowScanner) (Subscription, error) {
+	var s Subscription
+	var deletedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.UserID, &s.Service, &s.Price, &s.Currency, &s.StartDate, &s.EndDate, &s.BillingPeriod, &deletedAt)
+	if deletedAt.Valid {
+		s.DeletedAt = &deletedAt.Time
+	}
+	return withMonthlyPrice(s), err
+}
+
+// parseID разбирает строковый ID подписки; некорректный ID — ошибка валидации, а не ошибка БД
+func parseID(id string) (int, error) {
+	key, err := strconv.Atoi(id)
+	if err != nil || key <= 0 {
+		return 0, InvalidField("id", "ожидается положительное целое число")
+	}
+	return key, nil
+}
+
+func (p *PostgresStore) InsertSubscription(ctx context.Context, subscription Subscription) (_ int, err error) {
+	ctx, span := startQuery(ctx, "InsertSubscription")
+	defer span.end(&err)
+
+	if err := ValidateSubscription(subscription); err != nil {
+		return 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertSubscription(ctx, tx, subscription)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// InsertSubscriptions добавляет подписки одной транзакцией: либо все, либо ни одной
+func (p *PostgresStore) InsertSubscriptions(ctx context.Context, subscriptions []Subscription) (_ []int, err error) {
+	ctx, span := startQuery(ctx, "InsertSubscriptions")
+	defer span.end(&err)
+
+	for i, subscription := range subscriptions {
+		if err := ValidateSubscription(subscription); err != nil {
+			return nil, WithFieldPrefix(err, fmt.Sprintf("[%d]", i))
+		}
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		id, err := insertSubscription(ctx, tx, subscription)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	span.affected(int64(len(ids)))
+
+	return ids, tx.Commit()
 }
 
-func InsertSubscription(db *sql.DB, subscription Subscription) (int, error) {
+// insertSubscription добавляет подписку вместе с начальной ценой в рамках транзакции tx
+func insertSubscription(ctx context.Context, tx *sql.Tx, subscription Subscription) (int, error) {
 	var id int
+	subscription.Currency = normalizeCurrency(subscription.Currency)
+	subscription.BillingPeriod = normalizeBillingPeriod(subscription.BillingPeriod)
 
-	err := db.QueryRow(`
-		INSERT INTO subscriptions (user_id, service_name, price, start_date, end_date)
-		VALUES ($1, $2, $3, $4, $5)
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO subscriptions (user_id, service_name, price, currency, start_date, end_date, billing_period)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id
-	`, subscription.UserID, subscription.Service, subscription.Price, subscription.StartDate, subscription.EndDate).Scan(&id)
+	`, subscription.UserID, subscription.Service, subscription.Price, subscription.Currency,
+		subscription.StartDate, subscription.EndDate, subscription.BillingPeriod).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
 
-	return id, err
+	// начальная цена действует с месяца начала подписки
+	err = upsertPriceChange(ctx, tx, PriceChange{
+		SubscriptionID: id,
+		Price:          subscription.Price,
+		EffectiveFrom:  monthStart(subscription.StartDate),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := writeOutboxEventFor(ctx, tx, EventSubscriptionCreated, id); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
-// SelectsubscriptionByID позволяет получить подписку по номеру в таблице
-func SelectSubscriptionByID(db *sql.DB, id string) (Subscription, error) {
-	s := Subscription{}
+// SelectsubscriptionByID позволяет получить подписку по номеру в таблице.
+// Удалённые подписки возвращаются только при includeDeleted.
+func (p *PostgresStore) SelectSubscriptionByID(ctx context.Context, id string, includeDeleted bool) (_ Subscription, err error) {
+	ctx, span := startQuery(ctx, "SelectSubscriptionByID")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return Subscription{}, err
+	}
 
-	row := db.QueryRow(`
-		SELECT id, user_id, service_name, price, start_date, end_date
+	query := `
+		SELECT ` + subscriptionColumns + `
 		FROM subscriptions 
 		WHERE id = $1
-		`, id)
+		`
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	row := p.db.QueryRowContext(ctx, query, key)
 
-	err := row.Scan(&s.ID, &s.UserID, &s.Service, &s.Price, &s.StartDate, &s.EndDate)
+	s, err := scanSubscription(row)
 	if err == sql.ErrNoRows {
-		log.Printf("Подписка с ID=%d не найдена", id)
-		return s, err
+		slog.DebugContext(ctx, "Подписка не найдена", "subscription_id", key)
+		return s, ErrSubscriptionNotFound
 	} else if err != nil {
-		log.Printf("Ошибка при получении подписки с ID=%s: %v", id, err)
+		slog.ErrorContext(ctx, "Ошибка при получении подписки", "subscription_id", key, "error", err)
 		return s, err
 	}
+	span.rows(1)
 
 	return s, nil
 }
 
-// SelectUserssubscriptions позволяет получить подписки пользователя с указанием и без указания названия сервиса
-func SelectUsersSubscriptions(db *sql.DB, userID string, serviceName string) ([]Subscription, error) {
-	subscriptions := []Subscription{}
+// SelectUsersSubscriptions возвращает страницу подписок пользователя с учётом фильтров и сортировки.
+// Пагинация keyset: следующая страница начинается строго после (поле сортировки, id) последней строки.
+func (p *PostgresStore) SelectUsersSubscriptions(ctx context.Context, filter SubscriptionFilter) (_ SubscriptionPage, err error) {
+	ctx, span := startQuery(ctx, "SelectUsersSubscriptions")
+	defer span.end(&err)
+
+	filter = filter.normalize()
+	page := SubscriptionPage{Subscriptions: []Subscription{}}
+
+	cursor, cursorValue, err := filter.decodeCursor()
+	if err != nil {
+		return page, err
+	}
 
 	query := `
-		SELECT id, user_id, service_name, price, start_date, end_date
+		SELECT ` + subscriptionColumns + `
 		FROM subscriptions 
 		WHERE user_id = $1
 	`
-	args := []interface{}{userID}
+	args := []interface{}{filter.UserID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + fmt.Sprint(len(args))
+	}
+	query += filter.conditions(arg)
 
-	if serviceName != "" {
-		query += " AND service_name = $2"
-		args = append(args, serviceName)
+	// filter.SortBy прошёл normalize и совпадает с одной из колонок, поэтому его можно подставлять в запрос
+	op := ">"
+	if filter.SortDesc {
+		op = "<"
+	}
+	if cursor != nil {
+		if filter.SortBy == SortByID {
+			query += " AND id " + op + " " + arg(cursor.ID)
+		} else {
+			query += " AND (" + filter.SortBy + ", id) " + op + " (" + arg(cursorValue) + ", " + arg(cursor.ID) + ")"
+		}
 	}
+	query += filter.orderBy()
+	// Запрашиваем на одну строку больше, чтобы понять, есть ли следующая страница
+	query += " LIMIT " + arg(filter.Limit+1)
 
-	rows, err := db.Query(query, args...)
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Printf("SelectsubscriptionByID: query failed: %v", err)
-		return nil, err
+		slog.ErrorContext(ctx, "Ошибка запроса подписок пользователя", "user_id", filter.UserID, "error", err)
+		return page, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		s := Subscription{}
-
-		err := rows.Scan(&s.ID, &s.UserID, &s.Service, &s.Price, &s.StartDate, &s.EndDate)
+		s, err := scanSubscription(rows)
 		if err != nil {
-			log.Printf("SelectsubscriptionByID: scan failed: %v", err)
-			return nil, err
+			slog.ErrorContext(ctx, "Ошибка чтения подписки пользователя", "user_id", filter.UserID, "error", err)
+			return page, err
 		}
-		subscriptions = append(subscriptions, s)
+		page.Subscriptions = append(page.Subscriptions, s)
 	}
 
 	if err = rows.Err(); err != nil {
+		return page, err
+	}
+	span.rows(len(page.Subscriptions))
+
+	return filter.cutPage(page.Subscriptions), nil
+}
+
+// StreamSubscriptions читает подписки по фильтру курсором БД и передаёт их fn по одной, не собирая в память
+func (p *PostgresStore) StreamSubscriptions(ctx context.Context, filter SubscriptionFilter, fn func(Subscription) error) (err error) {
+	ctx, span := startQuery(ctx, "StreamSubscriptions")
+	defer span.end(&err)
+
+	if filter.SortBy == "" {
+		filter.SortBy = SortByID
+	}
+
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM subscriptions
+		WHERE TRUE
+	`
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + fmt.Sprint(len(args))
+	}
+	if filter.UserID != "" {
+		query += " AND user_id = " + arg(filter.UserID)
+	}
+	query += filter.conditions(arg) + filter.orderBy()
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+		n++
+	}
+	span.rows(n)
+
+	return rows.Err()
+}
+
+// conditions возвращает условия фильтра (кроме user_id и курсора) для WHERE; значения добавляются через arg
+func (f SubscriptionFilter) conditions(arg func(interface{}) string) string {
+	var query string
+	if !f.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	if len(f.ServiceNames) > 0 {
+		query += " AND service_name = ANY(" + arg(pq.Array(f.ServiceNames)) + ")"
+	}
+	if f.MinPrice != nil {
+		query += " AND price >= " + arg(*f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		query += " AND price <= " + arg(*f.MaxPrice)
+	}
+	if !f.ActiveAt.IsZero() {
+		activeAt := arg(f.ActiveAt)
+		query += " AND start_date <= " + activeAt + " AND (end_date IS NULL OR end_date >= " + activeAt + ")"
+	}
+	if !f.StartFrom.IsZero() {
+		query += " AND start_date >= " + arg(f.StartFrom)
+	}
+	if !f.StartTo.IsZero() {
+		query += " AND start_date <= " + arg(f.StartTo)
+	}
+	if !f.EndFrom.IsZero() {
+		query += " AND (end_date IS NULL OR end_date >= " + arg(f.EndFrom) + ")"
+	}
+	if !f.EndTo.IsZero() {
+		query += " AND end_date <= " + arg(f.EndTo)
+	}
+	return query
+}
+
+// orderBy возвращает ORDER BY по полю сортировки с id для однозначного порядка.
+// SortBy должен быть проверен IsSortField: он подставляется в запрос как есть.
+func (f SubscriptionFilter) orderBy() string {
+	direction := "ASC"
+	if f.SortDesc {
+		direction = "DESC"
+	}
+	if f.SortBy == SortByID {
+		return " ORDER BY id " + direction
+	}
+	return " ORDER BY " + f.SortBy + " " + direction + ", id " + direction
+}
+
+// DeleteSubscription мягко удаляет подписку: помечает её временем удаления и записывает это в историю.
+// Повторное удаление ничего не меняет. Если подписки нет, возвращает ErrSubscriptionNotFound.
+func (p *PostgresStore) DeleteSubscription(ctx context.Context, id string) (err error) {
+	ctx, span := startQuery(ctx, "DeleteSubscription")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var subscriptionID int
+	var deletedAt time.Time
+	err = tx.QueryRowContext(ctx, `
+		UPDATE subscriptions SET deleted_at = now()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, deleted_at
+	`, key).Scan(&subscriptionID, &deletedAt)
+	if err == sql.ErrNoRows {
+		return p.ensureSubscriptionExists(ctx, key)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO subscription_deletions (subscription_id, deleted_at) VALUES ($1, $2)
+	`, subscriptionID, deletedAt)
+	if err != nil {
+		return err
+	}
+	if err := writeOutboxEventFor(ctx, tx, EventSubscriptionDeleted, subscriptionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreSubscription снимает пометку об удалении. Если подписки нет, возвращает ErrSubscriptionNotFound.
+func (p *PostgresStore) RestoreSubscription(ctx context.Context, id string) (err error) {
+	ctx, span := startQuery(ctx, "RestoreSubscription")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT deleted_at FROM subscriptions WHERE id = $1 FOR UPDATE`, key).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return ErrSubscriptionNotFound
+	} else if err != nil {
+		return err
+	}
+	if !deletedAt.Valid {
+		return nil // подписка не удалена, восстанавливать нечего
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE subscriptions SET deleted_at = NULL WHERE id = $1`, key); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE subscription_deletions SET restored_at = now()
+		WHERE subscription_id = $1 AND restored_at IS NULL
+	`, key)
+	if err != nil {
+		return err
+	}
+	if err := writeOutboxEventFor(ctx, tx, EventSubscriptionRestored, key); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SelectDeletionHistory возвращает историю удалений и восстановлений подписки.
+// Если подписки нет, возвращает ErrSubscriptionNotFound.
+func (p *PostgresStore) SelectDeletionHistory(ctx context.Context, id string) (_ []DeletionRecord, err error) {
+	ctx, span := startQuery(ctx, "SelectDeletionHistory")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.ensureSubscriptionExists(ctx, key); err != nil {
 		return nil, err
 	}
 
-	return subscriptions, err
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT subscription_id, deleted_at, restored_at
+		FROM subscription_deletions
+		WHERE subscription_id = $1
+		ORDER BY deleted_at
+	`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []DeletionRecord{}
+	for rows.Next() {
+		var r DeletionRecord
+		var restoredAt sql.NullTime
+		if err := rows.Scan(&r.SubscriptionID, &r.DeletedAt, &restoredAt); err != nil {
+			return nil, err
+		}
+		if restoredAt.Valid {
+			r.RestoredAt = &restoredAt.Time
+		}
+		history = append(history, r)
+	}
+	span.rows(len(history))
+
+	return history, rows.Err()
+}
+
+// PurgeDeletedSubscriptions окончательно удаляет подписки, мягко удалённые раньше before,
+// вместе с их историей цен и удалений. Возвращает количество удалённых подписок.
+func (p *PostgresStore) PurgeDeletedSubscriptions(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := startQuery(ctx, "PurgeDeletedSubscriptions")
+	defer span.end(&err)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM subscriptions WHERE deleted_at < $1 RETURNING `+subscriptionColumns, before)
+	if err != nil {
+		return 0, err
+	}
+	var purged []Subscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		purged = append(purged, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, s := range purged {
+		if err := writeOutboxEvent(ctx, tx, EventSubscriptionPurged, s); err != nil {
+			return 0, err
+		}
+	}
+	span.affected(int64(len(purged)))
+
+	return len(purged), tx.Commit()
 }
 
-func DeleteSubscription(db *sql.DB, id string) error {
-	_, err := db.Exec("DELETE FROM subscriptions WHERE id = $1", id)
+// CountActiveSubscriptions считает неудалённые подписки, действующие в день at; подписка без end_date бессрочна
+func (p *PostgresStore) CountActiveSubscriptions(ctx context.Context, at time.Time) (_ int, err error) {
+	ctx, span := startQuery(ctx, "CountActiveSubscriptions")
+	defer span.end(&err)
 
-	return err
+	var n int
+	err = p.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM subscriptions
+		WHERE deleted_at IS NULL AND start_date <= $1 AND (end_date IS NULL OR end_date >= $1)
+	`, dayStart(at)).Scan(&n)
+	return n, err
 }
 
-func UpdateSubscription(db *sql.DB, subscription Subscription) error {
+// UpdateSubscription перезаписывает поля подписки. Изменение цены не переписывает историю:
+// новая цена записывается в subscription_prices с текущего месяца.
+// Удалённую подписку изменить нельзя: возвращается ErrSubscriptionDeleted.
+func (p *PostgresStore) UpdateSubscription(ctx context.Context, subscription Subscription) (err error) {
+	ctx, span := startQuery(ctx, "UpdateSubscription")
+	defer span.end(&err)
+
+	if err := ValidateSubscription(subscription); err != nil {
+		return err
+	}
+
+	subscription.Currency = normalizeCurrency(subscription.Currency)
+	subscription.BillingPeriod = normalizeBillingPeriod(subscription.BillingPeriod)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldPrice int
+	var deletedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT price, deleted_at FROM subscriptions WHERE id = $1 FOR UPDATE
+	`, subscription.ID).Scan(&oldPrice, &deletedAt)
+	if err == sql.ErrNoRows {
+		return ErrSubscriptionNotFound
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Не удалось заблокировать подписку для изменения", "subscription_id", subscription.ID, "error", err)
+		return err
+	}
+	if deletedAt.Valid {
+		return ErrSubscriptionDeleted
+	}
+
 	query := `
 		UPDATE subscriptions
 		SET user_id = $1,
 		    service_name = $2,
 		    price = $3,
-		    start_date = $4,
-		    end_date = $5
-		WHERE id = $6
+		    currency = $4,
+		    start_date = $5,
+		    end_date = $6,
+		    billing_period = $7
+		WHERE id = $8
 	`
-	_, err := db.Exec(query,
+	_, err = tx.ExecContext(ctx, query,
 		subscription.UserID,
 		subscription.Service,
 		subscription.Price,
+		subscription.Currency,
 		subscription.StartDate,
 		subscription.EndDate,
+		subscription.BillingPeriod,
 		subscription.ID,
 	)
 
 	if err != nil {
-		log.Printf("Update subscription: failed to update subscription: %v", err)
+		slog.ErrorContext(ctx, "Не удалось изменить подписку", "subscription_id", subscription.ID, "error", err)
 		return err
 	}
 
-	return nil
+	if subscription.Price != oldPrice {
+		err = upsertPriceChange(ctx, tx, PriceChange{
+			SubscriptionID: subscription.ID,
+			Price:          subscription.Price,
+			EffectiveFrom:  priceChangeDate(subscription.StartDate),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Не удалось записать изменение цены", "subscription_id", subscription.ID, "error", err)
+			return err
+		}
+		if err := syncCurrentPrice(ctx, tx, subscription.ID); err != nil {
+			return err
+		}
+	}
+	if err := writeOutboxEventFor(ctx, tx, EventSubscriptionUpdated, subscription.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
 
+// ensureSubscriptionExists возвращает ErrSubscriptionNotFound, если подписки нет, в том числе удалённой
+func (p *PostgresStore) ensureSubscriptionExists(ctx context.Context, id int) error {
+	var exists bool
+	err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSubscriptionNotFound
+	}
+	return nil
 }
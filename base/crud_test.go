@@ -0,0 +1,65 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSubscriptionCRUD(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		id, err := store.InsertSubscription(ctx, Subscription{
+			UserID: testUser, Service: "netflix", Price: 400, Currency: "USD", StartDate: date("2024-01-01"), EndDate: date("2024-12-31"),
+		})
+		if err != nil {
+			t.Fatalf("InsertSubscription: %v", err)
+		}
+		other := insertAll(t, store, Subscription{UserID: otherUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: openEnd})[0]
+		if id == 0 || other == id {
+			t.Fatalf("ID подписок %d и %d", id, other)
+		}
+
+		got, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(id), false)
+		if err != nil {
+			t.Fatalf("SelectSubscriptionByID: %v", err)
+		}
+		if got.ID != id || got.UserID != testUser || got.Service != "netflix" || got.Price != 400 || got.Currency != "USD" ||
+			!got.StartDate.Equal(date("2024-01-01")) || !got.EndDate.Equal(date("2024-12-31")) || got.DeletedAt != nil {
+			t.Errorf("после вставки %+v", got)
+		}
+
+		update := got
+		update.Service, update.Price, update.EndDate = "netflix premium", 700, openEnd
+		if err := store.UpdateSubscription(ctx, update); err != nil {
+			t.Fatalf("UpdateSubscription: %v", err)
+		}
+		got, err = store.SelectSubscriptionByID(ctx, strconv.Itoa(id), false)
+		if err != nil || got.Service != "netflix premium" || got.Price != 700 || !got.EndDate.Equal(openEnd) {
+			t.Errorf("после изменения %+v, %v", got, err)
+		}
+		update.Price = 0
+		assertFieldErrors(t, store.UpdateSubscription(ctx, update), "price")
+		update.Price = 700
+
+		// выборка пользователя не видит чужих подписок
+		page, err := store.SelectUsersSubscriptions(ctx, SubscriptionFilter{UserID: testUser})
+		if err != nil || len(page.Subscriptions) != 1 || page.Subscriptions[0].ID != id {
+			t.Errorf("подписки пользователя %+v, %v", page.Subscriptions, err)
+		}
+
+		if err := store.DeleteSubscription(ctx, strconv.Itoa(id)); err != nil {
+			t.Fatalf("DeleteSubscription: %v", err)
+		}
+		if _, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(id), false); !errors.Is(err, ErrSubscriptionNotFound) {
+			t.Errorf("после удаления: err = %v, want ErrSubscriptionNotFound", err)
+		}
+		if err := store.UpdateSubscription(ctx, update); !errors.Is(err, ErrSubscriptionDeleted) {
+			t.Errorf("изменение удалённой: err = %v, want ErrSubscriptionDeleted", err)
+		}
+		if _, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(other), false); err != nil {
+			t.Errorf("удаление задело другую подписку: %v", err)
+		}
+	})
+}
@@ -2,58 +2,59 @@ package base
 
 import (
 	"database/sql"
-	"fmt"
-	"log"
-	"os"
+	"log/slog"
+
+	"effective_mobile/config"
 
 	_ "github.com/lib/pq"
 )
 
 // Создание базы данных 2ой шаг
-func CreateDB() (db *sql.DB, err error) {
-	user := os.Getenv("DB_USER")
-	pass := os.Getenv("DB_PASSWORD")
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	name := os.Getenv("DB_NAME")
+func CreateDB(cfg config.DBConfig) (db *sql.DB, err error) {
+	db, err = OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Применяем миграции, которые ещё не были применены
+	if err := MigrateUp(db); err != nil {
+		slog.Error("Ошибка при применении миграций", "error", err)
+		db.Close()
+		return nil, err
+	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, pass, name)
+	slog.Info("База данных подключена, миграции применены")
+	return db, nil
+}
 
-	db, err = sql.Open("postgres", dsn)
+// OpenDB подключается к БД, настраивает пул соединений и проверяет соединение, не трогая схему
+func OpenDB(cfg config.DBConfig) (db *sql.DB, err error) {
+	db, err = sql.Open("postgres", cfg.DSN())
 	if err != nil {
-		log.Printf("Ошибка при подключении к БД: %v\n", err)
+		slog.Error("Ошибка при подключении к БД", "error", err)
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
 	// Проверка соединения
 	if err := db.Ping(); err != nil {
-		log.Printf("БД не доступна: %v\n", err)
+		slog.Error("БД недоступна", "host", cfg.Host, "port", cfg.Port, "sslmode", cfg.SSLMode, "error", err)
+		db.Close()
 		return nil, err
 	}
 
-	// Создание таблицы, если не существует
-	if err := createSubscribesTable(db); err != nil {
-		log.Printf("Ошибка при создании таблицы: %v\n", err)
-		return nil, err
-	}
-
-	fmt.Println("База данных подключена и таблица subscriptions готова.")
 	return db, nil
 }
 
-// Функция создания таблицы
-func createSubscribesTable(db *sql.DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS subscriptions (
-		id SERIAL PRIMARY KEY,
-		user_id UUID NOT NULL,
-		service_name TEXT NOT NULL,
-		price INTEGER NOT NULL CHECK (price >= 0),
-		start_date DATE NOT NULL,
-		end_date DATE
-	);`
-
-	_, err := db.Exec(query)
-	return err
+// PostgresStore — реализация SubscriptionStore поверх PostgreSQL
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore создаёт хранилище подписок поверх открытого подключения к БД
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
 }
@@ -0,0 +1,37 @@
+package base
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DeletionRecord — одно мягкое удаление подписки и, если было, её восстановление
+type DeletionRecord struct {
+	SubscriptionID int        `json:"subscription_id"`
+	DeletedAt      time.Time  `json:"deleted_at"`
+	RestoredAt     *time.Time `json:"restored_at,omitempty"`
+}
+
+// RunPurgeJob раз в interval окончательно удаляет подписки, мягко удалённые дольше retention назад.
+// Работает до отмены ctx.
+func RunPurgeJob(ctx context.Context, store SubscriptionStore, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.PurgeDeletedSubscriptions(ctx, time.Now().Add(-retention))
+			if err != nil {
+				slog.ErrorContext(ctx, "Ошибка очистки удалённых подписок", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "Окончательно удалены мягко удалённые подписки", "count", n)
+			}
+		}
+	}
+}
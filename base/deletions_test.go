@@ -0,0 +1,156 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		s := Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd}
+		s.ID = insertAll(t, store, s)[0]
+		id := strconv.Itoa(s.ID)
+
+		deleteSubscription(t, store, s.ID)
+
+		if _, err := store.SelectSubscriptionByID(ctx, id, false); !errors.Is(err, ErrSubscriptionNotFound) {
+			t.Errorf("удалённая подписка без includeDeleted: err = %v, want ErrSubscriptionNotFound", err)
+		}
+		deleted, err := store.SelectSubscriptionByID(ctx, id, true)
+		if err != nil {
+			t.Fatalf("удалённая подписка с includeDeleted: %v", err)
+		}
+		if deleted.DeletedAt == nil {
+			t.Error("DeletedAt не заполнено")
+		}
+		if err := store.UpdateSubscription(ctx, s); !errors.Is(err, ErrSubscriptionDeleted) {
+			t.Errorf("UpdateSubscription: err = %v, want ErrSubscriptionDeleted", err)
+		}
+		if _, err := store.AddPriceChange(ctx, PriceChange{SubscriptionID: s.ID, Price: 500, EffectiveFrom: date("2024-02-01")}); !errors.Is(err, ErrSubscriptionDeleted) {
+			t.Errorf("AddPriceChange: err = %v, want ErrSubscriptionDeleted", err)
+		}
+		if n, err := store.CountActiveSubscriptions(ctx, date("2024-06-01")); err != nil || n != 0 {
+			t.Errorf("CountActiveSubscriptions = %d, %v, want 0", n, err)
+		}
+
+		// повторное удаление ничего не меняет
+		deleteSubscription(t, store, s.ID)
+		history, err := store.SelectDeletionHistory(ctx, id)
+		if err != nil {
+			t.Fatalf("SelectDeletionHistory: %v", err)
+		}
+		if len(history) != 1 || history[0].RestoredAt != nil {
+			t.Fatalf("история после удаления: %+v", history)
+		}
+
+		if err := store.RestoreSubscription(ctx, id); err != nil {
+			t.Fatalf("RestoreSubscription: %v", err)
+		}
+		if _, err := store.SelectSubscriptionByID(ctx, id, false); err != nil {
+			t.Errorf("восстановленная подписка: %v", err)
+		}
+		// восстановление неудалённой подписки тоже ничего не меняет
+		if err := store.RestoreSubscription(ctx, id); err != nil {
+			t.Errorf("повторное RestoreSubscription: %v", err)
+		}
+		history, err = store.SelectDeletionHistory(ctx, id)
+		if err != nil {
+			t.Fatalf("SelectDeletionHistory: %v", err)
+		}
+		if len(history) != 1 || history[0].RestoredAt == nil {
+			t.Errorf("история после восстановления: %+v", history)
+		}
+		if err := store.UpdateSubscription(ctx, s); err != nil {
+			t.Errorf("UpdateSubscription после восстановления: %v", err)
+		}
+	})
+}
+
+func TestPurgeDeletedSubscriptions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		ids := insertAll(t, store,
+			Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd},
+			Subscription{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: openEnd},
+		)
+		deleteSubscription(t, store, ids[0])
+
+		if n, err := store.PurgeDeletedSubscriptions(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+			t.Errorf("очистка до удаления: %d, %v, want 0", n, err)
+		}
+		if n, err := store.PurgeDeletedSubscriptions(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+			t.Errorf("очистка после удаления: %d, %v, want 1", n, err)
+		}
+		if _, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(ids[0]), true); !errors.Is(err, ErrSubscriptionNotFound) {
+			t.Errorf("очищенная подписка: err = %v, want ErrSubscriptionNotFound", err)
+		}
+		if _, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(ids[1]), false); err != nil {
+			t.Errorf("неудалённая подписка: %v", err)
+		}
+	})
+}
+
+func TestSelectUsersSubscriptionsDeleted(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter SubscriptionFilter
+		want   []string
+	}{
+		{
+			name:   "с удалёнными",
+			filter: SubscriptionFilter{UserID: testUser, IncludeDeleted: true},
+			want:   []string{"netflix", "spotify", "youtube", "apple", "zoom"},
+		},
+		{
+			name:   "удалённая по сервису",
+			filter: SubscriptionFilter{UserID: testUser, ServiceNames: []string{"zoom"}, IncludeDeleted: true},
+			want:   []string{"zoom"},
+		},
+	}
+
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := store.SelectUsersSubscriptions(context.Background(), tt.filter)
+				if err != nil {
+					t.Fatalf("SelectUsersSubscriptions: %v", err)
+				}
+				if got := serviceNames(page.Subscriptions); !slices.Equal(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestCountSubscriptionsCostDeleted(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "удалённые подписки не учитываются",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+				{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+			},
+			deleted: []int{1},
+			filter:  year2024,
+			want:    400,
+		},
+		{
+			name: "удалённые подписки по запросу",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+				{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+			},
+			deleted: []int{1},
+			filter:  withFilter(year2024, func(f *CostFilter) { f.IncludeDeleted = true }),
+			want:    700,
+		},
+	})
+}
@@ -0,0 +1,118 @@
+package base
+
+import (
+	"errors"
+	"strings"
+)
+
+// Виды доменных ошибок. Каждая *Error оборачивает один из них,
+// поэтому вид проверяется через errors.Is(err, ErrNotFound).
+var (
+	ErrNotFound   = errors.New("не найдено")
+	ErrConflict   = errors.New("конфликт")
+	ErrValidation = errors.New("ошибка валидации")
+	ErrForbidden  = errors.New("доступ запрещён")
+)
+
+// Стабильные коды ошибок API. Клиенты опираются на них, поэтому существующие коды не переименовываются.
+const (
+	CodeValidationFailed     = "validation_failed"
+	CodeInvalidJSON          = "invalid_json"
+	CodeInvalidCursor        = "invalid_cursor"
+	CodeSubscriptionNotFound = "subscription_not_found"
+	CodeSubscriptionDeleted  = "subscription_deleted"
+	CodeForbidden            = "forbidden"
+)
+
+// Error — доменная ошибка со стабильным кодом
+type Error struct {
+	Kind    error        // ErrNotFound, ErrConflict, ErrValidation или ErrForbidden
+	Code    string       // стабильный код, например subscription_not_found
+	Message string       // описание для человека
+	Fields  []FieldError // ошибки отдельных полей, только для ErrValidation
+}
+
+// FieldError — ошибка в одном поле запроса
+type FieldError struct {
+	Field   string `json:"field" example:"price"`
+	Message string `json:"message" example:"должна быть положительной"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return e.Message + ": " + strings.Join(parts, "; ")
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+var (
+	// ErrSubscriptionNotFound — подписки нет или она мягко удалена
+	ErrSubscriptionNotFound = &Error{Kind: ErrNotFound, Code: CodeSubscriptionNotFound, Message: "подписка не найдена"}
+	// ErrSubscriptionDeleted — подписка мягко удалена, и изменить её можно только после восстановления
+	ErrSubscriptionDeleted = &Error{Kind: ErrConflict, Code: CodeSubscriptionDeleted, Message: "подписка удалена, сначала восстановите её"}
+	// ErrAccessDenied — вызывающий обращается к данным другого пользователя без роли администратора
+	ErrAccessDenied = &Error{Kind: ErrForbidden, Code: CodeForbidden, Message: "нет доступа к данным другого пользователя"}
+)
+
+// NewValidationError возвращает ошибку валидации с перечнем некорректных полей
+func NewValidationError(fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: CodeValidationFailed, Message: "некорректные данные запроса", Fields: fields}
+}
+
+// InvalidField — ошибка валидации одного поля
+func InvalidField(field, message string) *Error {
+	return NewValidationError(FieldError{Field: field, Message: message})
+}
+
+// ValidateSubscription проверяет подписку перед записью и возвращает все найденные ошибки полей
+func ValidateSubscription(s Subscription) error {
+	var fields []FieldError
+	if s.UserID == "" {
+		fields = append(fields, FieldError{Field: "user_id", Message: "обязательное поле"})
+	}
+	if s.Service == "" {
+		fields = append(fields, FieldError{Field: "service_name", Message: "обязательное поле"})
+	}
+	if s.Price <= 0 {
+		fields = append(fields, FieldError{Field: "price", Message: "должна быть положительной"})
+	}
+	if s.Currency != "" && !IsCurrencyCode(strings.ToUpper(s.Currency)) {
+		fields = append(fields, FieldError{Field: "currency", Message: "ожидается код ISO 4217, например RUB или USD"})
+	}
+	if s.BillingPeriod != "" && !IsBillingPeriod(s.BillingPeriod) {
+		fields = append(fields, FieldError{Field: "billing_period", Message: "должен быть одним из: weekly, monthly, quarterly, annual"})
+	}
+	if s.StartDate.IsZero() {
+		fields = append(fields, FieldError{Field: "start_date", Message: "обязательное поле"})
+	} else if !s.EndDate.IsZero() && s.EndDate.Before(s.StartDate) {
+		fields = append(fields, FieldError{Field: "end_date", Message: "не может быть раньше start_date"})
+	}
+
+	if len(fields) > 0 {
+		return NewValidationError(fields...)
+	}
+	return nil
+}
+
+// WithFieldPrefix дополняет имена полей ошибки валидации префиксом,
+// например rates[2].currency для элемента массива. Остальные ошибки возвращаются без изменений.
+func WithFieldPrefix(err error, prefix string) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	prefixed := *e
+	prefixed.Fields = make([]FieldError, len(e.Fields))
+	for i, f := range e.Fields {
+		prefixed.Fields[i] = FieldError{Field: prefix + "." + f.Field, Message: f.Message}
+	}
+	return &prefixed
+}
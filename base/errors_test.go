@@ -0,0 +1,125 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInsertSubscriptionValidation(t *testing.T) {
+	valid := Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd}
+
+	tests := []struct {
+		name   string
+		modify func(s *Subscription)
+		fields []string
+	}{
+		{name: "без пользователя", modify: func(s *Subscription) { s.UserID = "" }, fields: []string{"user_id"}},
+		{name: "без сервиса", modify: func(s *Subscription) { s.Service = "" }, fields: []string{"service_name"}},
+		{name: "нулевая цена", modify: func(s *Subscription) { s.Price = 0 }, fields: []string{"price"}},
+		{name: "некорректная валюта", modify: func(s *Subscription) { s.Currency = "рубль" }, fields: []string{"currency"}},
+		{name: "неизвестный период", modify: func(s *Subscription) { s.BillingPeriod = "daily" }, fields: []string{"billing_period"}},
+		{name: "без даты начала", modify: func(s *Subscription) { s.StartDate = time.Time{} }, fields: []string{"start_date"}},
+		{name: "окончание раньше начала", modify: func(s *Subscription) { s.EndDate = date("2023-12-31") }, fields: []string{"end_date"}},
+		{
+			name:   "несколько ошибок",
+			modify: func(s *Subscription) { s.UserID, s.Price = "", -1 },
+			fields: []string{"user_id", "price"},
+		},
+	}
+
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				s := valid
+				tt.modify(&s)
+
+				_, err := store.InsertSubscription(context.Background(), s)
+				assertFieldErrors(t, err, tt.fields...)
+			})
+		}
+
+		page, err := store.SelectUsersSubscriptions(context.Background(), SubscriptionFilter{UserID: testUser})
+		if err != nil {
+			t.Fatalf("SelectUsersSubscriptions: %v", err)
+		}
+		if len(page.Subscriptions) != 0 {
+			t.Errorf("некорректные подписки сохранены: %v", serviceNames(page.Subscriptions))
+		}
+	})
+}
+
+func TestSubscriptionNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		missing := Subscription{ID: 999, UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd}
+
+		checks := map[string]error{
+			"SelectSubscriptionByID": func() error {
+				_, err := store.SelectSubscriptionByID(ctx, "999", true)
+				return err
+			}(),
+			"UpdateSubscription":  store.UpdateSubscription(ctx, missing),
+			"DeleteSubscription":  store.DeleteSubscription(ctx, "999"),
+			"RestoreSubscription": store.RestoreSubscription(ctx, "999"),
+			"SelectDeletionHistory": func() error {
+				_, err := store.SelectDeletionHistory(ctx, "999")
+				return err
+			}(),
+			"AddPriceChange": func() error {
+				_, err := store.AddPriceChange(ctx, PriceChange{SubscriptionID: 999, Price: 100, EffectiveFrom: date("2024-01-01")})
+				return err
+			}(),
+			"SelectPriceHistory": func() error {
+				_, err := store.SelectPriceHistory(ctx, "999")
+				return err
+			}(),
+		}
+		for name, err := range checks {
+			if !errors.Is(err, ErrSubscriptionNotFound) {
+				t.Errorf("%s: err = %v, want ErrSubscriptionNotFound", name, err)
+			}
+		}
+
+		for _, id := range []string{"abc", "0", "-1"} {
+			if _, err := store.SelectSubscriptionByID(ctx, id, false); !errors.Is(err, ErrValidation) {
+				t.Errorf("SelectSubscriptionByID(%q): err = %v, want ErrValidation", id, err)
+			}
+		}
+	})
+}
+
+func TestWithFieldPrefix(t *testing.T) {
+	err := WithFieldPrefix(NewValidationError(
+		FieldError{Field: "price", Message: "должна быть положительной"},
+		FieldError{Field: "currency", Message: "некорректный код"},
+	), "rows[2]")
+	assertFieldErrors(t, err, "rows[2].price", "rows[2].currency")
+
+	other := errors.New("сбой")
+	if got := WithFieldPrefix(other, "rows[2]"); got != other {
+		t.Errorf("ошибка не валидации изменена: %v", got)
+	}
+	if !errors.Is(ErrSubscriptionNotFound, ErrNotFound) || errors.Is(ErrSubscriptionNotFound, ErrConflict) {
+		t.Error("ErrSubscriptionNotFound должна быть видом ErrNotFound")
+	}
+}
+
+// assertFieldErrors проверяет, что err — ошибка валидации ровно по полям fields
+func assertFieldErrors(t *testing.T, err error, fields ...string) {
+	t.Helper()
+
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("err = %v, want ErrValidation", err)
+	}
+	if len(e.Fields) != len(fields) {
+		t.Fatalf("поля ошибки %+v, want %v", e.Fields, fields)
+	}
+	for i, f := range e.Fields {
+		if f.Field != fields[i] {
+			t.Errorf("поле %d = %q, want %q", i, f.Field, fields[i])
+		}
+	}
+}
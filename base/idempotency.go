@@ -0,0 +1,128 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// IdempotencyRecord — запрос с заголовком Idempotency-Key и, когда он выполнен, его ответ
+type IdempotencyRecord struct {
+	Scope       string // чей ключ: API-ключ или пользователь; ключи разных вызывающих не пересекаются
+	Key         string
+	Fingerprint string // хеш метода, пути, параметров и тела запроса
+	StatusCode  int    // 0, пока запрос выполняется
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Completed сообщает, сохранён ли ответ на запрос
+func (r IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// ReserveIdempotencyKey занимает ключ rec.Scope/rec.Key на ttl и возвращает (rec, true).
+// Если ключ уже занят и не истёк, возвращает сохранённую запись и false. Истёкший ключ занимается заново.
+func (p *PostgresStore) ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord, ttl time.Duration) (_ IdempotencyRecord, _ bool, err error) {
+	ctx, span := startQuery(ctx, "ReserveIdempotencyKey")
+	defer span.end(&err)
+
+	err = p.db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (scope, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+		ON CONFLICT (scope, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, content_type = NULL, body = NULL,
+		    created_at = now(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+		RETURNING created_at, expires_at
+	`, rec.Scope, rec.Key, rec.Fingerprint, ttl.Seconds()).Scan(&rec.CreatedAt, &rec.ExpiresAt)
+	if err == nil {
+		return rec, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return rec, false, err
+	}
+
+	// ключ занят другим запросом
+	var status sql.NullInt64
+	var contentType sql.NullString
+	existing := IdempotencyRecord{Scope: rec.Scope, Key: rec.Key}
+	err = p.db.QueryRowContext(ctx, `
+		SELECT fingerprint, status_code, content_type, body, created_at, expires_at
+		FROM idempotency_keys WHERE scope = $1 AND key = $2
+	`, rec.Scope, rec.Key).Scan(&existing.Fingerprint, &status, &contentType, &existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+	if err == sql.ErrNoRows {
+		// первый запрос только что освободил ключ после ошибки; клиент повторит попытку
+		existing.Fingerprint = rec.Fingerprint
+		return existing, false, nil
+	} else if err != nil {
+		return rec, false, err
+	}
+	existing.StatusCode = int(status.Int64)
+	existing.ContentType = contentType.String
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с занятым ключом
+func (p *PostgresStore) CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (err error) {
+	ctx, span := startQuery(ctx, "CompleteIdempotencyKey")
+	defer span.end(&err)
+
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status_code = $3, content_type = $4, body = $5
+		WHERE scope = $1 AND key = $2
+	`, rec.Scope, rec.Key, rec.StatusCode, rec.ContentType, rec.Body)
+	return err
+}
+
+// ReleaseIdempotencyKey освобождает ключ, запрос с которым завершился ошибкой сервера, чтобы его можно было повторить
+func (p *PostgresStore) ReleaseIdempotencyKey(ctx context.Context, scope, key string) (err error) {
+	ctx, span := startQuery(ctx, "ReleaseIdempotencyKey")
+	defer span.end(&err)
+
+	_, err = p.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status_code IS NULL
+	`, scope, key)
+	return err
+}
+
+// PurgeExpiredIdempotencyKeys удаляет ключи, истёкшие раньше before, и возвращает их количество
+func (p *PostgresStore) PurgeExpiredIdempotencyKeys(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := startQuery(ctx, "PurgeExpiredIdempotencyKeys")
+	defer span.end(&err)
+
+	res, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	span.affected(n)
+	return int(n), err
+}
+
+// RunIdempotencyPurgeJob удаляет истёкшие ключи идемпотентности, пока не отменён ctx. Истёкший ключ и так
+// занимается заново, поэтому очистка только не даёт таблице расти: она запускается четыре раза за ttl,
+// но не чаще раза в минуту и не реже раза в час.
+func RunIdempotencyPurgeJob(ctx context.Context, store SubscriptionStore, ttl time.Duration) {
+	ticker := time.NewTicker(min(max(ttl/4, time.Minute), time.Hour))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+			if err != nil {
+				slog.ErrorContext(ctx, "Ошибка очистки истёкших ключей идемпотентности", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "Удалены истёкшие ключи идемпотентности", "count", n)
+			}
+		}
+	}
+}
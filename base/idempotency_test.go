@@ -0,0 +1,86 @@
+package base
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		rec := IdempotencyRecord{Scope: "user:" + testUser, Key: "create-1", Fingerprint: "a"}
+
+		reserve := func(rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool) {
+			t.Helper()
+			got, reserved, err := store.ReserveIdempotencyKey(ctx, rec, ttl)
+			if err != nil {
+				t.Fatalf("ReserveIdempotencyKey: %v", err)
+			}
+			return got, reserved
+		}
+
+		if _, reserved := reserve(rec, time.Hour); !reserved {
+			t.Fatal("свободный ключ не занят")
+		}
+		other := rec
+		other.Fingerprint = "b"
+		existing, reserved := reserve(other, time.Hour)
+		if reserved || existing.Fingerprint != "a" || existing.Completed() {
+			t.Fatalf("повтор во время выполнения: %+v, %v", existing, reserved)
+		}
+		// у другого вызывающего свои ключи
+		if _, reserved := reserve(IdempotencyRecord{Scope: "key:7", Key: rec.Key, Fingerprint: "a"}, time.Hour); !reserved {
+			t.Error("ключ другого вызывающего не занят")
+		}
+
+		// ключ без ответа освобождается, и запрос можно выполнить снова
+		if err := store.ReleaseIdempotencyKey(ctx, rec.Scope, rec.Key); err != nil {
+			t.Fatalf("ReleaseIdempotencyKey: %v", err)
+		}
+		if _, reserved := reserve(rec, time.Hour); !reserved {
+			t.Fatal("освобождённый ключ не занят")
+		}
+
+		rec.StatusCode, rec.ContentType, rec.Body = 201, "application/json", []byte(`{"id":1}`)
+		if err := store.CompleteIdempotencyKey(ctx, rec); err != nil {
+			t.Fatalf("CompleteIdempotencyKey: %v", err)
+		}
+		// ключ с сохранённым ответом не освобождается
+		if err := store.ReleaseIdempotencyKey(ctx, rec.Scope, rec.Key); err != nil {
+			t.Fatalf("ReleaseIdempotencyKey: %v", err)
+		}
+		existing, reserved = reserve(rec, time.Hour)
+		if reserved || existing.StatusCode != 201 || existing.ContentType != "application/json" || string(existing.Body) != `{"id":1}` {
+			t.Fatalf("повтор после ответа: %+v, %v", existing, reserved)
+		}
+	})
+}
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		rec := IdempotencyRecord{Scope: "user:" + testUser, Key: "create-1", Fingerprint: "a"}
+
+		if _, _, err := store.ReserveIdempotencyKey(ctx, rec, time.Millisecond); err != nil {
+			t.Fatalf("ReserveIdempotencyKey: %v", err)
+		}
+		if _, _, err := store.ReserveIdempotencyKey(ctx, IdempotencyRecord{Scope: rec.Scope, Key: "create-2"}, time.Hour); err != nil {
+			t.Fatalf("ReserveIdempotencyKey: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		// истёкший ключ занимается заново даже с другим запросом
+		rec.Fingerprint = "b"
+		got, reserved, err := store.ReserveIdempotencyKey(ctx, rec, time.Millisecond)
+		if err != nil || !reserved || got.Fingerprint != "b" {
+			t.Fatalf("истёкший ключ: %+v, %v, %v", got, reserved, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		n, err := store.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+		if err != nil || n != 1 {
+			t.Errorf("PurgeExpiredIdempotencyKeys = %d, %v, want 1", n, err)
+		}
+	})
+}
@@ -0,0 +1,1062 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore — реализация SubscriptionStore в памяти процесса.
+// Семантика фильтров и подсчёта стоимости совпадает с PostgresStore,
+// поэтому её удобно использовать во встраиваемых сценариях и в тестах.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	nextID        int
+	subscriptions map[int]Subscription
+	prices        map[int][]PriceChange    // история цен по ID подписки, по возрастанию даты
+	deletions     map[int][]DeletionRecord // история удалений по ID подписки
+	rates         rateTable
+	apiKeys       map[int]memoryAPIKey
+	nextAPIKeyID  int
+	reminders     map[string]ReminderSettings  // настройки напоминаний по ID пользователя
+	sentReminders map[sentReminderKey]struct{} // отправленные напоминания
+	webhooks      map[int]WebhookEndpoint
+	nextWebhookID int
+	deliveries    []WebhookDelivery   // журнал доставок, ID доставки — её номер в журнале
+	outbox        []memoryOutboxEvent // события по возрастанию ID
+	nextOutboxID  int64
+	idempotency   map[idempotencyKey]IdempotencyRecord
+}
+
+// idempotencyKey — ключ идемпотентности в пределах вызывающего
+type idempotencyKey struct {
+	scope, key string
+}
+
+// memoryOutboxEvent — событие outbox вместе с состоянием его публикации
+type memoryOutboxEvent struct {
+	OutboxEvent
+	nextAttemptAt time.Time
+	publishedAt   *time.Time
+}
+
+// sentReminderKey — напоминание, отправленное в канал
+type sentReminderKey struct {
+	subscriptionID int
+	kind           string
+	date           time.Time
+	channel        string
+}
+
+// memoryAPIKey — API-ключ вместе с хешем, по которому его ищут
+type memoryAPIKey struct {
+	APIKey
+	hash string
+}
+
+// NewMemoryStore создаёт пустое хранилище подписок в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nextID:        1,
+		subscriptions: make(map[int]Subscription),
+		prices:        make(map[int][]PriceChange),
+		deletions:     make(map[int][]DeletionRecord),
+		rates:         rateTable{},
+		apiKeys:       make(map[int]memoryAPIKey),
+		nextAPIKeyID:  1,
+		reminders:     make(map[string]ReminderSettings),
+		sentReminders: make(map[sentReminderKey]struct{}),
+		webhooks:      make(map[int]WebhookEndpoint),
+		nextWebhookID: 1,
+		nextOutboxID:  1,
+		idempotency:   make(map[idempotencyKey]IdempotencyRecord),
+	}
+}
+
+func (m *MemoryStore) InsertSubscription(_ context.Context, subscription Subscription) (int, error) {
+	if err := ValidateSubscription(subscription); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insert(subscription), nil
+}
+
+// InsertSubscriptions добавляет подписки разом: либо все, либо ни одной
+func (m *MemoryStore) InsertSubscriptions(_ context.Context, subscriptions []Subscription) ([]int, error) {
+	for i, subscription := range subscriptions {
+		if err := ValidateSubscription(subscription); err != nil {
+			return nil, WithFieldPrefix(err, fmt.Sprintf("[%d]", i))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]int, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		ids = append(ids, m.insert(subscription))
+	}
+	return ids, nil
+}
+
+// insert сохраняет проверенную подписку с начальной ценой; вызывается под m.mu
+func (m *MemoryStore) insert(subscription Subscription) int {
+	subscription.ID = m.nextID
+	subscription.Currency = normalizeCurrency(subscription.Currency)
+	subscription.BillingPeriod = normalizeBillingPeriod(subscription.BillingPeriod)
+	m.subscriptions[subscription.ID] = subscription
+	m.prices[subscription.ID] = []PriceChange{{
+		SubscriptionID: subscription.ID,
+		Price:          subscription.Price,
+		EffectiveFrom:  monthStart(subscription.StartDate),
+	}}
+	m.nextID++
+	m.writeOutbox(EventSubscriptionCreated, subscription)
+
+	return subscription.ID
+}
+
+// SelectSubscriptionByID позволяет получить подписку по номеру в хранилище.
+// Удалённые подписки возвращаются только при includeDeleted.
+func (m *MemoryStore) SelectSubscriptionByID(_ context.Context, id string, includeDeleted bool) (Subscription, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.subscriptions[key]
+	if !ok || (s.DeletedAt != nil && !includeDeleted) {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+
+	return withMonthlyPrice(s), nil
+}
+
+// SelectUsersSubscriptions возвращает страницу подписок пользователя с учётом фильтров и сортировки
+func (m *MemoryStore) SelectUsersSubscriptions(_ context.Context, filter SubscriptionFilter) (SubscriptionPage, error) {
+	filter = filter.normalize()
+
+	cursor, cursorValue, err := filter.decodeCursor()
+	if err != nil {
+		return SubscriptionPage{Subscriptions: []Subscription{}}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subscriptions := []Subscription{}
+	for _, s := range m.subscriptions {
+		// как и в PostgresStore, user_id обязателен
+		if s.UserID != filter.UserID || !filter.matches(s) {
+			continue
+		}
+		if cursor != nil {
+			c := compareSortKey(s, filter.SortBy, cursorValue, cursor.ID)
+			if filter.SortDesc {
+				c = -c
+			}
+			if c <= 0 {
+				continue
+			}
+		}
+		subscriptions = append(subscriptions, withMonthlyPrice(s))
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		c := compareSortKey(a, filter.SortBy, sortValue(b, filter.SortBy), b.ID)
+		if filter.SortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if len(subscriptions) > filter.Limit+1 {
+		subscriptions = subscriptions[:filter.Limit+1]
+	}
+
+	return filter.cutPage(subscriptions), nil
+}
+
+// StreamSubscriptions передаёт fn подписки по фильтру; fn вызывается без блокировки хранилища
+func (m *MemoryStore) StreamSubscriptions(_ context.Context, filter SubscriptionFilter, fn func(Subscription) error) error {
+	if filter.SortBy == "" {
+		filter.SortBy = SortByID
+	}
+
+	m.mu.RLock()
+	var subscriptions []Subscription
+	for _, s := range m.subscriptions {
+		if filter.matches(s) {
+			subscriptions = append(subscriptions, withMonthlyPrice(s))
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		c := compareSortKey(a, filter.SortBy, sortValue(b, filter.SortBy), b.ID)
+		if filter.SortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	for _, s := range subscriptions {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSubscription мягко удаляет подписку: помечает её временем удаления и записывает это в историю
+func (m *MemoryStore) DeleteSubscription(_ context.Context, id string) error {
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.subscriptions[key]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	if s.DeletedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	s.DeletedAt = &now
+	m.subscriptions[key] = s
+	m.deletions[key] = append(m.deletions[key], DeletionRecord{SubscriptionID: key, DeletedAt: now})
+	m.writeOutbox(EventSubscriptionDeleted, s)
+
+	return nil
+}
+
+// RestoreSubscription снимает пометку об удалении. Если подписки нет, возвращает ErrSubscriptionNotFound.
+func (m *MemoryStore) RestoreSubscription(_ context.Context, id string) error {
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.subscriptions[key]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	if s.DeletedAt == nil {
+		return nil
+	}
+	s.DeletedAt = nil
+	m.subscriptions[key] = s
+
+	now := time.Now()
+	for i := range m.deletions[key] {
+		if m.deletions[key][i].RestoredAt == nil {
+			m.deletions[key][i].RestoredAt = &now
+		}
+	}
+	m.writeOutbox(EventSubscriptionRestored, s)
+
+	return nil
+}
+
+// SelectDeletionHistory возвращает историю удалений и восстановлений подписки
+func (m *MemoryStore) SelectDeletionHistory(_ context.Context, id string) ([]DeletionRecord, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.subscriptions[key]; !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return append([]DeletionRecord{}, m.deletions[key]...), nil
+}
+
+// PurgeDeletedSubscriptions окончательно удаляет подписки, мягко удалённые раньше before
+func (m *MemoryStore) PurgeDeletedSubscriptions(_ context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int
+	for key, s := range m.subscriptions {
+		if s.DeletedAt == nil || !s.DeletedAt.Before(before) {
+			continue
+		}
+		delete(m.subscriptions, key)
+		delete(m.prices, key)
+		delete(m.deletions, key)
+		for sent := range m.sentReminders {
+			if sent.subscriptionID == key {
+				delete(m.sentReminders, sent)
+			}
+		}
+		m.writeOutbox(EventSubscriptionPurged, s)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// CountActiveSubscriptions считает неудалённые подписки, действующие в день at
+func (m *MemoryStore) CountActiveSubscriptions(_ context.Context, at time.Time) (int, error) {
+	day := dayStart(at)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var n int
+	for _, s := range m.subscriptions {
+		if s.DeletedAt == nil && !s.StartDate.After(day) && !s.EndDate.Before(day) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) UpdateSubscription(_ context.Context, subscription Subscription) error {
+	if err := ValidateSubscription(subscription); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.subscriptions[subscription.ID]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	if old.DeletedAt != nil {
+		return ErrSubscriptionDeleted
+	}
+	subscription.Currency = normalizeCurrency(subscription.Currency)
+	subscription.BillingPeriod = normalizeBillingPeriod(subscription.BillingPeriod)
+	m.subscriptions[subscription.ID] = subscription
+
+	// изменение цены не переписывает историю, а действует с текущего месяца
+	if subscription.Price != old.Price {
+		m.upsertPriceChange(PriceChange{
+			SubscriptionID: subscription.ID,
+			Price:          subscription.Price,
+			EffectiveFrom:  priceChangeDate(subscription.StartDate),
+		})
+	}
+	m.writeOutbox(EventSubscriptionUpdated, m.subscriptions[subscription.ID])
+
+	return nil
+}
+
+// AddPriceChange записывает новую цену подписки, не затрагивая прошлые месяцы
+func (m *MemoryStore) AddPriceChange(_ context.Context, change PriceChange) (PriceChange, error) {
+	if change.Price <= 0 {
+		return change, InvalidField("price", "должна быть положительной")
+	}
+	change.EffectiveFrom = monthStart(change.EffectiveFrom)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.subscriptions[change.SubscriptionID]
+	if !ok {
+		return change, ErrSubscriptionNotFound
+	}
+	if s.DeletedAt != nil {
+		return change, ErrSubscriptionDeleted
+	}
+	m.upsertPriceChange(change)
+	m.writeOutbox(EventSubscriptionPriceChanged, m.subscriptions[change.SubscriptionID])
+
+	return change, nil
+}
+
+// SelectPriceHistory возвращает историю цен подписки по возрастанию даты
+func (m *MemoryStore) SelectPriceHistory(_ context.Context, id string) ([]PriceChange, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.subscriptions[key]; !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return append([]PriceChange{}, m.prices[key]...), nil
+}
+
+// upsertPriceChange добавляет или заменяет цену на месяц и пересчитывает текущую цену подписки.
+// Вызывается под m.mu.
+func (m *MemoryStore) upsertPriceChange(change PriceChange) {
+	history := m.prices[change.SubscriptionID]
+	replaced := false
+	for i := range history {
+		if history[i].EffectiveFrom.Equal(change.EffectiveFrom) {
+			history[i].Price = change.Price
+			replaced = true
+		}
+	}
+	if !replaced {
+		history = append(history, change)
+		sortPriceHistory(history)
+	}
+	m.prices[change.SubscriptionID] = history
+
+	if price, ok := priceAt(history, time.Now()); ok {
+		s := m.subscriptions[change.SubscriptionID]
+		s.Price = price
+		m.subscriptions[change.SubscriptionID] = s
+	}
+}
+
+// CountSubscriptionsCost считает суммарную стоимость подписок по фильтру
+func (m *MemoryStore) CountSubscriptionsCost(_ context.Context, filter CostFilter) (CostReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var subscriptions []Subscription
+	for _, s := range m.subscriptions {
+		// те же условия, что и в WHERE запроса PostgresStore
+		if s.StartDate.After(filter.EndDate) || s.EndDate.Before(filter.StartDate) {
+			continue
+		}
+		if filter.UserID != "" && s.UserID != filter.UserID {
+			continue
+		}
+		if filter.ServiceName != "" && s.Service != filter.ServiceName {
+			continue
+		}
+		if !filter.IncludeDeleted && s.DeletedAt != nil {
+			continue
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+
+	return buildCostReport(subscriptions, m.prices, m.rates, filter), nil
+}
+
+// UpsertExchangeRates сохраняет курсы, заменяя уже загруженные на те же месяцы
+func (m *MemoryStore) UpsertExchangeRates(_ context.Context, rates []ExchangeRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rate := range rates {
+		m.rates.add(rate)
+	}
+	return nil
+}
+
+// SelectExchangeRates возвращает загруженные курсы, опционально только для одной валюты
+func (m *MemoryStore) SelectExchangeRates(_ context.Context, currency string) ([]ExchangeRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := []ExchangeRate{}
+	for c, months := range m.rates {
+		if currency != "" && c != currency {
+			continue
+		}
+		for month, rate := range months {
+			rates = append(rates, ExchangeRate{Currency: c, Month: month, Rate: rate})
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Currency != rates[j].Currency {
+			return rates[i].Currency < rates[j].Currency
+		}
+		return rates[i].Month.Before(rates[j].Month)
+	})
+
+	return rates, nil
+}
+
+// sortValue возвращает значение поля сортировки в том же типе, что и decodeCursor
+func sortValue(s Subscription, sortBy string) interface{} {
+	switch sortBy {
+	case SortByPrice:
+		return s.Price
+	case SortByStartDate:
+		return s.StartDate
+	case SortByServiceName:
+		return s.Service
+	}
+	return s.ID
+}
+
+// InsertAPIKey сохраняет новый ключ по его хешу
+func (m *MemoryStore) InsertAPIKey(_ context.Context, key APIKey, hash string) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key.ID = m.nextAPIKeyID
+	key.CreatedAt = time.Now()
+	key.Scopes = append([]string{}, key.Scopes...)
+	m.apiKeys[key.ID] = memoryAPIKey{APIKey: key, hash: hash}
+	m.nextAPIKeyID++
+
+	return key, nil
+}
+
+// SelectAPIKeys возвращает все ключи, включая отозванные и просроченные
+func (m *MemoryStore) SelectAPIKeys(_ context.Context) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(m.apiKeys))
+	for _, k := range m.apiKeys {
+		keys = append(keys, k.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// SelectAPIKeyByHash ищет ключ по хешу
+func (m *MemoryStore) SelectAPIKeyByHash(_ context.Context, hash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.apiKeys {
+		if k.hash == hash {
+			return k.APIKey, nil
+		}
+	}
+	return APIKey{}, ErrAPIKeyNotFound
+}
+
+// RevokeAPIKey отзывает ключ. Повторный отзыв ничего не меняет.
+func (m *MemoryStore) RevokeAPIKey(_ context.Context, id string) error {
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.apiKeys[key]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	if k.RevokedAt == nil {
+		now := time.Now()
+		k.RevokedAt = &now
+		m.apiKeys[key] = k
+	}
+	return nil
+}
+
+// TouchAPIKey запоминает время последнего использования ключа
+func (m *MemoryStore) TouchAPIKey(_ context.Context, id int, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if k, ok := m.apiKeys[id]; ok {
+		k.LastUsedAt = &usedAt
+		m.apiKeys[id] = k
+	}
+	return nil
+}
+
+// SelectReminderSettings возвращает настройки пользователя или ErrReminderSettingsNotFound
+func (m *MemoryStore) SelectReminderSettings(_ context.Context, userID string) (ReminderSettings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.reminders[userID]
+	if !ok {
+		return ReminderSettings{}, ErrReminderSettingsNotFound
+	}
+	return s, nil
+}
+
+// SelectAllReminderSettings возвращает настройки всех пользователей, которые их меняли
+func (m *MemoryStore) SelectAllReminderSettings(_ context.Context) ([]ReminderSettings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	settings := make([]ReminderSettings, 0, len(m.reminders))
+	for _, s := range m.reminders {
+		settings = append(settings, s)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].UserID < settings[j].UserID })
+	return settings, nil
+}
+
+// UpsertReminderSettings сохраняет настройки пользователя, заменяя прежние
+func (m *MemoryStore) UpsertReminderSettings(_ context.Context, settings ReminderSettings) (ReminderSettings, error) {
+	if err := ValidateReminderSettings(settings); err != nil {
+		return ReminderSettings{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	settings.UpdatedAt = &now
+	m.reminders[settings.UserID] = settings
+	return settings, nil
+}
+
+// ClaimReminder отмечает напоминание отправленным в канал channel; false — оно уже отправлено
+func (m *MemoryStore) ClaimReminder(_ context.Context, reminder Reminder, channel string) (bool, error) {
+	key := sentReminderKey{reminder.SubscriptionID, reminder.Kind, dayStart(reminder.Date), channel}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sentReminders[key]; ok {
+		return false, nil
+	}
+	m.sentReminders[key] = struct{}{}
+	return true, nil
+}
+
+// ReleaseReminder снимает отметку ClaimReminder
+func (m *MemoryStore) ReleaseReminder(_ context.Context, reminder Reminder, channel string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sentReminders, sentReminderKey{reminder.SubscriptionID, reminder.Kind, dayStart(reminder.Date), channel})
+	return nil
+}
+
+// InsertWebhookEndpoint сохраняет новый вебхук
+func (m *MemoryStore) InsertWebhookEndpoint(_ context.Context, e WebhookEndpoint) (WebhookEndpoint, error) {
+	if err := ValidateWebhookEndpoint(e); err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = m.nextWebhookID
+	e.Enabled = true
+	e.ConsecutiveFailures = 0
+	e.DisabledAt, e.DisabledReason = nil, ""
+	e.CreatedAt = time.Now()
+	if e.EventTypes == nil {
+		e.EventTypes = []string{}
+	}
+	m.webhooks[e.ID] = e
+	m.nextWebhookID++
+	return e, nil
+}
+
+// SelectWebhookEndpoints возвращает вебхуки пользователя userID, а при пустом userID — все вебхуки
+func (m *MemoryStore) SelectWebhookEndpoints(_ context.Context, userID string) ([]WebhookEndpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	endpoints := []WebhookEndpoint{}
+	for _, e := range m.webhooks {
+		if userID == "" || e.UserID == userID {
+			endpoints = append(endpoints, e)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+	return endpoints, nil
+}
+
+// SelectWebhookEndpoint возвращает вебхук по ID или ErrWebhookNotFound
+func (m *MemoryStore) SelectWebhookEndpoint(_ context.Context, id string) (WebhookEndpoint, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.webhooks[key]
+	if !ok {
+		return WebhookEndpoint{}, ErrWebhookNotFound
+	}
+	return e, nil
+}
+
+// DeleteWebhookEndpoint удаляет вебхук вместе с журналом его доставок
+func (m *MemoryStore) DeleteWebhookEndpoint(_ context.Context, id string) error {
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[key]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(m.webhooks, key)
+	// ID доставок — номера в журнале, поэтому доставки удалённого вебхука не вырезаются, а только отвязываются
+	for i := range m.deliveries {
+		if m.deliveries[i].EndpointID == key {
+			m.deliveries[i].EndpointID = 0
+		}
+	}
+	return nil
+}
+
+// EnableWebhookEndpoint включает вебхук и обнуляет счётчик ошибок подряд
+func (m *MemoryStore) EnableWebhookEndpoint(_ context.Context, id string) (WebhookEndpoint, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.webhooks[key]
+	if !ok {
+		return WebhookEndpoint{}, ErrWebhookNotFound
+	}
+	e.Enabled = true
+	e.ConsecutiveFailures = 0
+	e.DisabledAt, e.DisabledReason = nil, ""
+	m.webhooks[key] = e
+	return e, nil
+}
+
+// EnqueueWebhookEvent ставит событие в очередь доставки всем включённым вебхукам, подписанным на него,
+// кроме тех, кому событие с тем же ID уже поставлено
+func (m *MemoryStore) EnqueueWebhookEvent(_ context.Context, event WebhookEvent) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := make(map[int]bool)
+	for _, d := range m.deliveries {
+		if d.EventID == event.ID && d.ReplayOf == 0 {
+			queued[d.EndpointID] = true
+		}
+	}
+	ids := make([]int, 0, len(m.webhooks))
+	for id, e := range m.webhooks {
+		if e.Enabled && e.Accepts(event.Data.UserID, event.Type) && !queued[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		m.enqueueDelivery(id, event.ID, event.Type, payload, 0)
+	}
+	return len(ids), nil
+}
+
+// enqueueDelivery добавляет ожидающую доставку в журнал; replayOf — исходная доставка повтора или 0. Вызывается под m.mu
+func (m *MemoryStore) enqueueDelivery(endpointID int, eventID, eventType string, payload json.RawMessage, replayOf int) WebhookDelivery {
+	now := time.Now()
+	d := WebhookDelivery{
+		ID:            len(m.deliveries) + 1,
+		EndpointID:    endpointID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		ReplayOf:      replayOf,
+	}
+	m.deliveries = append(m.deliveries, d)
+	return d
+}
+
+// ClaimWebhookDeliveries забирает до limit доставок, которым пора выполнить попытку, и откладывает их на lease
+func (m *MemoryStore) ClaimWebhookDeliveries(_ context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []WebhookDelivery{}
+	for i := range m.deliveries {
+		if len(deliveries) == limit {
+			break
+		}
+		d := &m.deliveries[i]
+		e, ok := m.webhooks[d.EndpointID]
+		if d.Status != DeliveryPending || d.NextAttemptAt.After(now) || !ok || !e.Enabled {
+			continue
+		}
+		next := now.Add(lease)
+		d.NextAttemptAt = &next
+
+		claimed := *d
+		claimed.URL, claimed.Secret = e.URL, e.Secret
+		deliveries = append(deliveries, claimed)
+	}
+	return deliveries, nil
+}
+
+// FinishWebhookAttempt записывает итог попытки и отключает вебхук после disableAfter ошибок подряд (0 — никогда)
+func (m *MemoryStore) FinishWebhookAttempt(_ context.Context, a WebhookAttempt, disableAfter int) (bool, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a.DeliveryID >= 1 && a.DeliveryID <= len(m.deliveries) {
+		d := &m.deliveries[a.DeliveryID-1]
+		d.Status = a.Status
+		d.Attempts++
+		d.NextAttemptAt = nil
+		if a.Status == DeliveryPending {
+			next := a.NextAttemptAt
+			d.NextAttemptAt = &next
+		}
+		d.LastError = a.Error
+		d.ResponseStatus = a.ResponseStatus
+		d.DeliveredAt = nil
+		if a.Status == DeliverySucceeded {
+			d.DeliveredAt = &now
+		}
+	}
+
+	e, ok := m.webhooks[a.EndpointID]
+	if !ok {
+		return false, nil
+	}
+	if a.Status == DeliverySucceeded {
+		e.ConsecutiveFailures = 0
+		m.webhooks[a.EndpointID] = e
+		return false, nil
+	}
+
+	e.ConsecutiveFailures++
+	disabled := e.Enabled && disableAfter > 0 && e.ConsecutiveFailures >= disableAfter
+	if disabled {
+		e.Enabled = false
+		e.DisabledAt = &now
+		e.DisabledReason = fmt.Sprintf("отключён после %d ошибок доставки подряд", e.ConsecutiveFailures)
+		for i := range m.deliveries {
+			if d := &m.deliveries[i]; d.EndpointID == a.EndpointID && d.Status == DeliveryPending {
+				d.Status = DeliveryFailed
+				d.NextAttemptAt = nil
+				d.LastError = "вебхук " + e.DisabledReason
+			}
+		}
+	}
+	m.webhooks[a.EndpointID] = e
+	return disabled, nil
+}
+
+// SelectWebhookDeliveries возвращает последние limit доставок вебхука, новые первыми, опционально только со статусом status
+func (m *MemoryStore) SelectWebhookDeliveries(_ context.Context, endpointID string, status string, limit int) ([]WebhookDelivery, error) {
+	key, err := parseID(endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []WebhookDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := m.deliveries[i]
+		if d.EndpointID == key && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery ставит событие доставки deliveryID вебхука endpointID в очередь заново новой доставкой
+func (m *MemoryStore) ReplayWebhookDelivery(_ context.Context, endpointID, deliveryID string) (WebhookDelivery, error) {
+	endpointKey, err := parseID(endpointID)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	deliveryKey, err := parseID(deliveryID)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if deliveryKey > len(m.deliveries) || m.deliveries[deliveryKey-1].EndpointID != endpointKey {
+		return WebhookDelivery{}, ErrWebhookDeliveryNotFound
+	}
+	d := m.deliveries[deliveryKey-1]
+	return m.enqueueDelivery(endpointKey, d.EventID, d.EventType, d.Payload, d.ID), nil
+}
+
+// writeOutbox записывает событие eventType о подписке s; вызывается под m.mu вместе с изменением
+func (m *MemoryStore) writeOutbox(eventType string, s Subscription) {
+	// подписка состоит из строк, чисел и дат, поэтому кодирование не может завершиться ошибкой
+	data, _ := json.Marshal(withMonthlyPrice(s))
+	now := time.Now()
+	m.outbox = append(m.outbox, memoryOutboxEvent{
+		OutboxEvent:   OutboxEvent{ID: m.nextOutboxID, Type: eventType, SubscriptionID: s.ID, Data: data, CreatedAt: now},
+		nextAttemptAt: now,
+	})
+	m.nextOutboxID++
+}
+
+// ClaimOutboxEvents забирает до limit самых ранних неопубликованных событий подписок и откладывает их на lease
+func (m *MemoryStore) ClaimOutboxEvents(_ context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []OutboxEvent{}
+	blocked := make(map[int]bool) // подписки, у которых есть более раннее неопубликованное событие
+	for i := range m.outbox {
+		if len(events) == limit {
+			break
+		}
+		e := &m.outbox[i]
+		if e.publishedAt != nil || blocked[e.SubscriptionID] {
+			continue
+		}
+		blocked[e.SubscriptionID] = true
+		if e.nextAttemptAt.After(now) {
+			continue
+		}
+		e.nextAttemptAt = now.Add(lease)
+		events = append(events, e.OutboxEvent)
+	}
+	return events, nil
+}
+
+// MarkOutboxEventPublished отмечает событие опубликованным
+func (m *MemoryStore) MarkOutboxEventPublished(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e := m.outboxEvent(id); e != nil {
+		now := time.Now()
+		e.publishedAt = &now
+		e.Attempts++
+	}
+	return nil
+}
+
+// RetryOutboxEvent откладывает следующую попытку публикации до nextAttemptAt
+func (m *MemoryStore) RetryOutboxEvent(_ context.Context, id int64, _ string, nextAttemptAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e := m.outboxEvent(id); e != nil {
+		e.nextAttemptAt = nextAttemptAt
+		e.Attempts++
+	}
+	return nil
+}
+
+// PurgePublishedOutboxEvents удаляет события, опубликованные раньше before
+func (m *MemoryStore) PurgePublishedOutboxEvents(_ context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.outbox[:0]
+	for _, e := range m.outbox {
+		if e.publishedAt == nil || !e.publishedAt.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	purged := len(m.outbox) - len(kept)
+	m.outbox = kept
+	return purged, nil
+}
+
+// outboxEvent ищет событие по ID; вызывается под m.mu
+func (m *MemoryStore) outboxEvent(id int64) *memoryOutboxEvent {
+	i := sort.Search(len(m.outbox), func(i int) bool { return m.outbox[i].ID >= id })
+	if i < len(m.outbox) && m.outbox[i].ID == id {
+		return &m.outbox[i]
+	}
+	return nil
+}
+
+// ReserveIdempotencyKey занимает ключ на ttl или возвращает сохранённую запись, если ключ занят и не истёк
+func (m *MemoryStore) ReserveIdempotencyKey(_ context.Context, rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	now := time.Now()
+	k := idempotencyKey{rec.Scope, rec.Key}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.idempotency[k]; ok && existing.ExpiresAt.After(now) {
+		return existing, false, nil
+	}
+	rec.StatusCode, rec.ContentType, rec.Body = 0, "", nil
+	rec.CreatedAt, rec.ExpiresAt = now, now.Add(ttl)
+	m.idempotency[k] = rec
+	return rec, true, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с занятым ключом
+func (m *MemoryStore) CompleteIdempotencyKey(_ context.Context, rec IdempotencyRecord) error {
+	k := idempotencyKey{rec.Scope, rec.Key}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.idempotency[k]; ok {
+		existing.StatusCode, existing.ContentType = rec.StatusCode, rec.ContentType
+		existing.Body = append([]byte(nil), rec.Body...)
+		m.idempotency[k] = existing
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ, ответ на который ещё не сохранён
+func (m *MemoryStore) ReleaseIdempotencyKey(_ context.Context, scope, key string) error {
+	k := idempotencyKey{scope, key}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.idempotency[k]; ok && !existing.Completed() {
+		delete(m.idempotency, k)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys удаляет ключи, истёкшие раньше before
+func (m *MemoryStore) PurgeExpiredIdempotencyKeys(_ context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int
+	for k, rec := range m.idempotency {
+		if rec.ExpiresAt.Before(before) {
+			delete(m.idempotency, k)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,250 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID — ключ advisory lock, под которым выполняются миграции,
+// чтобы несколько одновременно стартующих реплик не применяли их параллельно
+const migrationLockID = 7_270_736_901
+
+// Migration — одна версия схемы с SQL для наката и отката
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations читает встроенные файлы вида 0001_name.up.sql / 0001_name.down.sql
+// и возвращает миграции, упорядоченные по версии
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		fileName := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("миграция %s: ожидается суффикс .up.sql или .down.sql", fileName)
+		}
+
+		versionStr, name, ok := strings.Cut(strings.TrimSuffix(fileName, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("миграция %s: ожидается имя вида 0001_name", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("миграция %s: некорректная версия: %w", fileName, err)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("миграция %04d_%s: отсутствует up-скрипт", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp применяет все ещё не применённые миграции по порядку
+func MigrateUp(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			err := runInTx(conn, m.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("миграция %04d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("Применена миграция", "version", m.Version, "name", m.Name)
+		}
+		return nil
+	})
+}
+
+// MigrateDown откатывает steps последних применённых миграций
+func MigrateDown(db *sql.DB, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if !applied[m.Version] {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("миграция %04d_%s: отсутствует down-скрипт", m.Version, m.Name)
+			}
+			err := runInTx(conn, m.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("откат миграции %04d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("Откачена миграция", "version", m.Version, "name", m.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// PendingMigrations возвращает версии встроенных миграций, ещё не применённых к БД.
+// Блокировку миграций не берёт и таблицу schema_migrations не создаёт, поэтому подходит для частых проверок готовности.
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []int
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m.Version)
+		}
+	}
+	return pending, nil
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под advisory lock.
+// Блокировка сессионная, поэтому все запросы должны идти через одно и то же соединение.
+func withMigrationLock(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("не удалось взять блокировку миграций: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			slog.Error("Не удалось снять блокировку миграций", "error", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// queryer — общее у *sql.DB и *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, q queryer) (map[int]bool, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// runInTx выполняет скрипт миграции и запись в schema_migrations одной транзакцией
+func runInTx(conn *sql.Conn, script string, bookkeeping string, args ...interface{}) error {
+	ctx := context.Background()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,51 @@
+package base
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("нет встроенных миграций")
+	}
+
+	for i, m := range migrations {
+		// версии идут подряд с 1: пропуск обычно означает потерянный или переименованный файл
+		if m.Version != i+1 {
+			t.Errorf("миграция %04d_%s на месте версии %d", m.Version, m.Name, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("миграция %04d_%s: пустой up-скрипт", m.Version, m.Name)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("миграция %04d_%s: отсутствует down-скрипт", m.Version, m.Name)
+		}
+	}
+
+	// у каждой пары одинаковое имя, иначе loadMigrations возьмёт имя только одного из файлов
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	files := map[string]bool{}
+	for _, e := range entries {
+		files[e.Name()] = true
+	}
+	for _, m := range migrations {
+		for _, suffix := range []string{".up.sql", ".down.sql"} {
+			if name := fmt.Sprintf("%04d_%s%s", m.Version, m.Name, suffix); !files[name] {
+				t.Errorf("нет файла %s", name)
+			}
+		}
+	}
+	if len(files) != 2*len(migrations) {
+		t.Errorf("%d файлов на %d миграций", len(files), len(migrations))
+	}
+}
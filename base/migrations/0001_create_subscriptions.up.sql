@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+	id SERIAL PRIMARY KEY,
+	user_id UUID NOT NULL,
+	service_name TEXT NOT NULL,
+	price INTEGER NOT NULL CHECK (price >= 0),
+	start_date DATE NOT NULL,
+	end_date DATE
+);
+
+-- индексы под выборки подписок пользователя и подсчёт стоимости за период
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_id ON subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_name ON subscriptions (service_name);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_dates ON subscriptions (start_date, end_date);
@@ -0,0 +1,11 @@
+CREATE TABLE subscription_prices (
+	subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+	price INTEGER NOT NULL CHECK (price >= 0),
+	effective_from DATE NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (subscription_id, effective_from)
+);
+
+-- текущая цена существующих подписок действует с даты их начала
+INSERT INTO subscription_prices (subscription_id, price, effective_from)
+SELECT id, price, date_trunc('month', start_date)::date FROM subscriptions;
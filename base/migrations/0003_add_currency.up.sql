@@ -0,0 +1,10 @@
+-- цены существующих подписок были указаны в рублях
+ALTER TABLE subscriptions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- курс валюты к рублю на месяц: сколько рублей стоит одна единица валюты
+CREATE TABLE exchange_rates (
+	currency CHAR(3) NOT NULL,
+	month DATE NOT NULL,
+	rate NUMERIC(18, 6) NOT NULL CHECK (rate > 0),
+	PRIMARY KEY (currency, month)
+);
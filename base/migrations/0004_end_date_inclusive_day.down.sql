@@ -0,0 +1,3 @@
+UPDATE subscriptions
+SET end_date = date_trunc('month', end_date)::date
+WHERE end_date IS NOT NULL AND end_date < DATE '9999-12-31';
@@ -0,0 +1,5 @@
+-- end_date теперь хранит последний активный день подписки.
+-- Раньше даты были помесячными и хранились первым числом месяца, поэтому переносим их на конец месяца.
+UPDATE subscriptions
+SET end_date = (date_trunc('month', end_date) + INTERVAL '1 month - 1 day')::date
+WHERE end_date IS NOT NULL AND EXTRACT(DAY FROM end_date) = 1;
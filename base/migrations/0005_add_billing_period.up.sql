@@ -0,0 +1,3 @@
+ALTER TABLE subscriptions
+	ADD COLUMN billing_period TEXT NOT NULL DEFAULT 'monthly'
+	CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'annual'));
@@ -0,0 +1,16 @@
+-- откат уничтожил бы мягко удалённые подписки, которые ещё можно восстановить,
+-- поэтому он прерывается, пока они есть: их нужно восстановить или очистить явно
+DO $$
+DECLARE
+	deleted INTEGER;
+BEGIN
+	SELECT count(*) INTO deleted FROM subscriptions WHERE deleted_at IS NOT NULL;
+	IF deleted > 0 THEN
+		RAISE EXCEPTION 'есть мягко удалённые подписки (%), откат удалил бы их безвозвратно', deleted
+			USING HINT = 'восстановите их или удалите вручную: DELETE FROM subscriptions WHERE deleted_at IS NOT NULL';
+	END IF;
+END
+$$;
+
+DROP TABLE IF EXISTS subscription_deletions;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS deleted_at;
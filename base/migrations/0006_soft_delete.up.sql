@@ -0,0 +1,13 @@
+ALTER TABLE subscriptions ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- выборки по умолчанию смотрят только на неудалённые подписки, а задача очистки — только на удалённые
+CREATE INDEX idx_subscriptions_deleted_at ON subscriptions (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- история удалений и восстановлений подписки
+CREATE TABLE subscription_deletions (
+	id SERIAL PRIMARY KEY,
+	subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+	deleted_at TIMESTAMPTZ NOT NULL,
+	restored_at TIMESTAMPTZ
+);
+CREATE INDEX idx_subscription_deletions_subscription_id ON subscription_deletions (subscription_id);
@@ -0,0 +1,13 @@
+-- ключи доступа для сервисов; сам ключ не хранится, только его SHA-256
+CREATE TABLE api_keys (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	user_id TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
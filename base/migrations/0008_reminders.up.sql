@@ -0,0 +1,18 @@
+-- окно напоминаний пользователя; без записи действует окно по умолчанию из настроек сервиса
+CREATE TABLE reminder_settings (
+	user_id TEXT PRIMARY KEY,
+	window_days INTEGER NOT NULL CHECK (window_days BETWEEN 1 AND 30),
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- отправленные напоминания; первичный ключ не даёт отправить одно напоминание в канал дважды,
+-- в том числе после перезапуска и с нескольких экземпляров сервиса
+CREATE TABLE sent_reminders (
+	subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+	kind TEXT NOT NULL,
+	due_date DATE NOT NULL,
+	channel TEXT NOT NULL,
+	sent_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (subscription_id, kind, due_date, channel)
+);
@@ -0,0 +1,32 @@
+-- получатели событий подписок; без user_id вебхук получает события всех пользователей
+CREATE TABLE webhook_endpoints (
+	id SERIAL PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	user_id TEXT,
+	event_types TEXT[] NOT NULL DEFAULT '{}',
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	consecutive_failures INTEGER NOT NULL DEFAULT 0,
+	disabled_at TIMESTAMPTZ,
+	disabled_reason TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_webhook_endpoints_user_id ON webhook_endpoints (user_id);
+
+-- журнал доставок; он же очередь: ожидающие доставки выбираются по next_attempt_at
+CREATE TABLE webhook_deliveries (
+	id SERIAL PRIMARY KEY,
+	endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ DEFAULT now(),
+	last_error TEXT,
+	response_status INTEGER,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	delivered_at TIMESTAMPTZ
+);
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_endpoint_id ON webhook_deliveries (endpoint_id, id);
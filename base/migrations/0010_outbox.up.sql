@@ -0,0 +1,15 @@
+-- исходящие события об изменениях подписок; пишутся в той же транзакции, что и само изменение,
+-- и пересылаются публикаторам фоновым процессом. Внешнего ключа нет: события переживают очистку подписки.
+CREATE TABLE outbox_events (
+	id BIGSERIAL PRIMARY KEY,
+	subscription_id INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error TEXT,
+	published_at TIMESTAMPTZ
+);
+CREATE INDEX idx_outbox_events_pending ON outbox_events (subscription_id, id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_events_published_at ON outbox_events (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- ответы на запросы с заголовком Idempotency-Key; ключ уникален в пределах вызывающего (scope).
+-- Пока запрос выполняется, status_code пуст, и повтор с тем же ключом получает 409.
+CREATE TABLE idempotency_keys (
+	scope TEXT NOT NULL,
+	key TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	status_code INTEGER,
+	content_type TEXT,
+	body BYTEA,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (scope, key)
+);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
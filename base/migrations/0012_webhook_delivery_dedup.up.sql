@@ -0,0 +1,13 @@
+-- повтор доставки через replay ссылается на исходную доставку и сохраняет ID события
+ALTER TABLE webhook_deliveries ADD COLUMN replay_of INTEGER;
+
+-- дубли, созданные повторной публикацией события из outbox, становятся повторами первой доставки
+UPDATE webhook_deliveries d SET replay_of = f.first_id
+FROM (
+	SELECT endpoint_id, event_id, min(id) AS first_id FROM webhook_deliveries
+	GROUP BY endpoint_id, event_id HAVING count(*) > 1
+) f
+WHERE d.endpoint_id = f.endpoint_id AND d.event_id = f.event_id AND d.id <> f.first_id;
+
+-- событие ставится в очередь вебхуку только один раз, сколько бы раз его ни публиковали
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries (endpoint_id, event_id) WHERE replay_of IS NULL;
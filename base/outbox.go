@@ -0,0 +1,145 @@
+package base
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Типы событий outbox, на которые нельзя подписать вебхук
+const (
+	EventSubscriptionRestored     = "subscription.restored"
+	EventSubscriptionPriceChanged = "subscription.price_changed"
+	EventSubscriptionPurged       = "subscription.purged" // подписка окончательно удалена после мягкого удаления
+)
+
+// OutboxEvent — событие об изменении подписки из таблицы outbox_events.
+// Оно записывается в той же транзакции, что и изменение, поэтому не теряется при падении сервиса
+// между записью и публикацией, но может быть опубликовано повторно.
+type OutboxEvent struct {
+	ID             int64           `json:"id"` // растёт вместе с порядком изменений; по нему получатель отбрасывает повторы
+	Type           string          `json:"type" example:"subscription.created"`
+	SubscriptionID int             `json:"subscription_id"`
+	Data           json.RawMessage `json:"data"` // подписка после изменения, для purged — перед удалением
+	CreatedAt      time.Time       `json:"occurred_at"`
+	Attempts       int             `json:"-"` // неудачных попыток публикации до этой
+}
+
+// scanOutboxEvent читает колонки id, event_type, subscription_id, payload, created_at, attempts
+func scanOutboxEvent(row rowScanner) (OutboxEvent, error) {
+	var e OutboxEvent
+	var payload []byte
+	err := row.Scan(&e.ID, &e.Type, &e.SubscriptionID, &payload, &e.CreatedAt, &e.Attempts)
+	e.Data = payload
+	return e, err
+}
+
+// writeOutboxEvent записывает событие eventType о подписке s в транзакции tx, которая её изменила
+func writeOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, s Subscription) error {
+	payload, err := json.Marshal(withMonthlyPrice(s))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox_events (subscription_id, event_type, payload) VALUES ($1, $2, $3::jsonb)
+	`, s.ID, eventType, string(payload))
+	return err
+}
+
+// writeOutboxEventFor перечитывает подписку id внутри tx и записывает о ней событие eventType
+func writeOutboxEventFor(ctx context.Context, tx *sql.Tx, eventType string, id int) error {
+	s, err := scanSubscription(tx.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1`, id))
+	if err != nil {
+		return err
+	}
+	return writeOutboxEvent(ctx, tx, eventType, s)
+}
+
+// ClaimOutboxEvents забирает до limit неопубликованных событий, которым пора выполнить попытку, и откладывает их на lease.
+// Берётся только самое раннее неопубликованное событие каждой подписки, поэтому следующее событие подписки
+// не уйдёт раньше предыдущего ни с этого, ни с другого экземпляра сервиса.
+func (p *PostgresStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (_ []OutboxEvent, err error) {
+	ctx, span := startQuery(ctx, "ClaimOutboxEvents")
+	defer span.end(&err)
+
+	rows, err := p.db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT o.id FROM outbox_events o
+			WHERE o.published_at IS NULL AND o.next_attempt_at <= now()
+			  AND NOT EXISTS (
+				SELECT 1 FROM outbox_events e
+				WHERE e.subscription_id = o.subscription_id AND e.published_at IS NULL AND e.id < o.id
+			  )
+			ORDER BY o.id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox_events o SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.event_type, o.subscription_id, o.payload, o.created_at, o.attempts
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []OutboxEvent{}
+	for rows.Next() {
+		e, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	span.rows(len(events))
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// UPDATE … RETURNING не сохраняет порядок подзапроса
+	sortOutboxEvents(events)
+	return events, nil
+}
+
+// MarkOutboxEventPublished отмечает событие опубликованным
+func (p *PostgresStore) MarkOutboxEventPublished(ctx context.Context, id int64) (err error) {
+	ctx, span := startQuery(ctx, "MarkOutboxEventPublished")
+	defer span.end(&err)
+
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE outbox_events SET published_at = now(), attempts = attempts + 1, last_error = NULL WHERE id = $1
+	`, id)
+	return err
+}
+
+// RetryOutboxEvent записывает ошибку публикации и откладывает следующую попытку до nextAttemptAt
+func (p *PostgresStore) RetryOutboxEvent(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) (err error) {
+	ctx, span := startQuery(ctx, "RetryOutboxEvent")
+	defer span.end(&err)
+
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE outbox_events SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1
+	`, id, lastError, nextAttemptAt)
+	return err
+}
+
+// PurgePublishedOutboxEvents удаляет события, опубликованные раньше before, и возвращает их количество
+func (p *PostgresStore) PurgePublishedOutboxEvents(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := startQuery(ctx, "PurgePublishedOutboxEvents")
+	defer span.end(&err)
+
+	res, err := p.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	span.affected(n)
+	return int(n), err
+}
+
+func sortOutboxEvents(events []OutboxEvent) {
+	slices.SortFunc(events, func(a, b OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+}
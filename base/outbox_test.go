@@ -0,0 +1,143 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// claimTypes забирает события outbox и возвращает их типы с ID подписок
+func claimTypes(t *testing.T, store SubscriptionStore, limit int) ([]OutboxEvent, []string) {
+	t.Helper()
+
+	events, err := store.ClaimOutboxEvents(context.Background(), limit, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutboxEvents: %v", err)
+	}
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type + "/" + strconv.Itoa(e.SubscriptionID)
+	}
+	return events, types
+}
+
+func publishAll(t *testing.T, store SubscriptionStore, events []OutboxEvent) {
+	t.Helper()
+
+	for _, e := range events {
+		if err := store.MarkOutboxEventPublished(context.Background(), e.ID); err != nil {
+			t.Fatalf("MarkOutboxEventPublished: %v", err)
+		}
+	}
+}
+
+func TestOutboxEventsFollowChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		s := Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd}
+		s.ID = insertAll(t, store, s)[0]
+		id := strconv.Itoa(s.ID)
+
+		s.Service = "netflix premium"
+		if err := store.UpdateSubscription(ctx, s); err != nil {
+			t.Fatalf("UpdateSubscription: %v", err)
+		}
+		if _, err := store.AddPriceChange(ctx, PriceChange{SubscriptionID: s.ID, Price: 500, EffectiveFrom: date("2024-06-01")}); err != nil {
+			t.Fatalf("AddPriceChange: %v", err)
+		}
+		deleteSubscription(t, store, s.ID)
+		if err := store.RestoreSubscription(ctx, id); err != nil {
+			t.Fatalf("RestoreSubscription: %v", err)
+		}
+		deleteSubscription(t, store, s.ID)
+		if _, err := store.PurgeDeletedSubscriptions(ctx, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("PurgeDeletedSubscriptions: %v", err)
+		}
+
+		// события одной подписки выдаются по одному и строго по порядку
+		var got []string
+		var last OutboxEvent
+		for i := 0; i < 10; i++ {
+			events, types := claimTypes(t, store, 10)
+			if len(events) == 0 {
+				break
+			}
+			if len(events) != 1 {
+				t.Fatalf("за раз выдано %v, want одно событие подписки", types)
+			}
+			got = append(got, events[0].Type)
+			last = events[0]
+			publishAll(t, store, events)
+		}
+		want := []string{
+			EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionPriceChanged,
+			EventSubscriptionDeleted, EventSubscriptionRestored, EventSubscriptionDeleted, EventSubscriptionPurged,
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("события %v, want %v", got, want)
+		}
+
+		var data Subscription
+		if err := json.Unmarshal(last.Data, &data); err != nil {
+			t.Fatalf("данные события: %v", err)
+		}
+		if data.ID != s.ID || data.Service != "netflix premium" || data.DeletedAt == nil {
+			t.Errorf("данные события purged: %+v", data)
+		}
+	})
+}
+
+func TestClaimOutboxEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		ids := insertAll(t, store,
+			Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: openEnd},
+			Subscription{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-01-01"), EndDate: openEnd},
+			Subscription{UserID: testUser, Service: "youtube", Price: 300, StartDate: date("2024-01-01"), EndDate: openEnd},
+		)
+		deleteSubscription(t, store, ids[0])
+		created := func(i int) string { return EventSubscriptionCreated + "/" + strconv.Itoa(ids[i]) }
+
+		// по одному самому раннему событию каждой подписки, не больше limit
+		events, types := claimTypes(t, store, 2)
+		if want := []string{created(0), created(1)}; !slices.Equal(types, want) {
+			t.Fatalf("первая пачка %v, want %v", types, want)
+		}
+
+		// забранные события отложены на lease
+		_, types = claimTypes(t, store, 10)
+		if want := []string{created(2)}; !slices.Equal(types, want) {
+			t.Fatalf("вторая пачка %v, want %v", types, want)
+		}
+
+		// ошибка публикации откладывает событие и не пропускает вперёд следующие события подписки
+		if err := store.RetryOutboxEvent(ctx, events[0].ID, "nats: timeout", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("RetryOutboxEvent: %v", err)
+		}
+		publishAll(t, store, events[1:])
+		if _, types = claimTypes(t, store, 10); len(types) != 0 {
+			t.Fatalf("выданы %v, хотя первое событие подписки ещё не опубликовано", types)
+		}
+
+		if err := store.RetryOutboxEvent(ctx, events[0].ID, "nats: timeout", time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("RetryOutboxEvent: %v", err)
+		}
+		retried, types := claimTypes(t, store, 10)
+		if want := []string{created(0)}; !slices.Equal(types, want) || retried[0].Attempts != 2 {
+			t.Fatalf("после повтора %v с %d попытками, want %v после 2 попыток", types, retried[0].Attempts, want)
+		}
+		publishAll(t, store, retried)
+		if _, types = claimTypes(t, store, 10); !slices.Equal(types, []string{EventSubscriptionDeleted + "/" + strconv.Itoa(ids[0])}) {
+			t.Fatalf("после публикации created: %v", types)
+		}
+
+		// очищаются только опубликованные события
+		n, err := store.PurgePublishedOutboxEvents(ctx, time.Now().Add(time.Hour))
+		if err != nil || n != 2 {
+			t.Errorf("PurgePublishedOutboxEvents = %d, %v, want 2", n, err)
+		}
+	})
+}
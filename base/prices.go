@@ -0,0 +1,251 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PriceChange — цена подписки, действующая начиная с месяца EffectiveFrom
+type PriceChange struct {
+	SubscriptionID int       `json:"subscription_id"`
+	Price          int       `json:"price"`          //Стоимость месячной подписки в валюте подписки
+	EffectiveFrom  time.Time `json:"effective_from"` //Месяц, с которого действует цена
+}
+
+// pricedPeriod — отрезок месяцев, в течение которого действовала одна цена
+type pricedPeriod struct {
+	Start time.Time
+	End   time.Time
+	Price int
+}
+
+// AddPriceChange записывает новую цену подписки, не затрагивая прошлые месяцы.
+// Повторная запись на тот же месяц заменяет цену. Если подписки нет, возвращает ErrSubscriptionNotFound,
+// а если она удалена — ErrSubscriptionDeleted.
+func (p *PostgresStore) AddPriceChange(ctx context.Context, change PriceChange) (_ PriceChange, err error) {
+	ctx, span := startQuery(ctx, "AddPriceChange")
+	defer span.end(&err)
+
+	if change.Price <= 0 {
+		return change, InvalidField("price", "должна быть положительной")
+	}
+	change.EffectiveFrom = monthStart(change.EffectiveFrom)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return change, err
+	}
+	defer tx.Rollback()
+
+	// блокируем подписку, чтобы параллельные изменения цены не разошлись с subscriptions.price
+	var deletedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT deleted_at FROM subscriptions WHERE id = $1 FOR UPDATE
+	`, change.SubscriptionID).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return change, ErrSubscriptionNotFound
+	} else if err != nil {
+		return change, err
+	}
+	if deletedAt.Valid {
+		return change, ErrSubscriptionDeleted
+	}
+
+	if err := upsertPriceChange(ctx, tx, change); err != nil {
+		return change, err
+	}
+	if err := syncCurrentPrice(ctx, tx, change.SubscriptionID); err != nil {
+		return change, err
+	}
+	if err := writeOutboxEventFor(ctx, tx, EventSubscriptionPriceChanged, change.SubscriptionID); err != nil {
+		return change, err
+	}
+
+	return change, tx.Commit()
+}
+
+// SelectPriceHistory возвращает историю цен подписки по возрастанию даты.
+// Если подписки нет, возвращает ErrSubscriptionNotFound.
+func (p *PostgresStore) SelectPriceHistory(ctx context.Context, id string) (_ []PriceChange, err error) {
+	ctx, span := startQuery(ctx, "SelectPriceHistory")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.ensureSubscriptionExists(ctx, key); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT subscription_id, price, effective_from
+		FROM subscription_prices
+		WHERE subscription_id = $1
+		ORDER BY effective_from
+	`, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка запроса истории цен", "subscription_id", key, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PriceChange{}
+	for rows.Next() {
+		var c PriceChange
+		if err := rows.Scan(&c.SubscriptionID, &c.Price, &c.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	span.rows(len(history))
+
+	return history, rows.Err()
+}
+
+// selectPriceHistories загружает истории цен сразу для набора подписок
+func (p *PostgresStore) selectPriceHistories(ctx context.Context, ids []int) (_ map[int][]PriceChange, err error) {
+	ctx, span := startQuery(ctx, "selectPriceHistories")
+	defer span.end(&err)
+
+	histories := map[int][]PriceChange{}
+	if len(ids) == 0 {
+		return histories, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT subscription_id, price, effective_from
+		FROM subscription_prices
+		WHERE subscription_id = ANY($1)
+		ORDER BY subscription_id, effective_from
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var n int
+	for rows.Next() {
+		var c PriceChange
+		if err := rows.Scan(&c.SubscriptionID, &c.Price, &c.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		histories[c.SubscriptionID] = append(histories[c.SubscriptionID], c)
+		n++
+	}
+	span.rows(n)
+
+	return histories, rows.Err()
+}
+
+func upsertPriceChange(ctx context.Context, tx *sql.Tx, change PriceChange) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO subscription_prices (subscription_id, price, effective_from)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (subscription_id, effective_from) DO UPDATE SET price = EXCLUDED.price
+	`, change.SubscriptionID, change.Price, change.EffectiveFrom)
+	return err
+}
+
+// syncCurrentPrice обновляет subscriptions.price до цены, действующей в текущем месяце
+func syncCurrentPrice(ctx context.Context, tx *sql.Tx, id int) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT subscription_id, price, effective_from
+		FROM subscription_prices
+		WHERE subscription_id = $1
+		ORDER BY effective_from
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	var history []PriceChange
+	for rows.Next() {
+		var c PriceChange
+		if err := rows.Scan(&c.SubscriptionID, &c.Price, &c.EffectiveFrom); err != nil {
+			rows.Close()
+			return err
+		}
+		history = append(history, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	price, ok := priceAt(history, time.Now())
+	if !ok {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE subscriptions SET price = $1 WHERE id = $2`, price, id)
+	return err
+}
+
+// priceChangeDate возвращает месяц, с которого действует цена, изменённая через UpdateSubscription:
+// текущий месяц, но не раньше начала подписки
+func priceChangeDate(startDate time.Time) time.Time {
+	return maxDate(monthStart(time.Now()), monthStart(startDate))
+}
+
+// priceAt возвращает цену, действующую в месяце date.
+// До первой записи истории действует первая известная цена.
+func priceAt(history []PriceChange, date time.Time) (int, bool) {
+	if len(history) == 0 {
+		return 0, false
+	}
+	price := history[0].Price
+	for _, c := range history {
+		if c.EffectiveFrom.After(date) {
+			break
+		}
+		price = c.Price
+	}
+	return price, true
+}
+
+// pricedPeriods разбивает отрезок [start, end] на периоды с постоянной ценой.
+// Без истории весь отрезок считается по s.Price.
+func pricedPeriods(s Subscription, history []PriceChange, start, end time.Time) []pricedPeriod {
+	if len(history) == 0 {
+		return []pricedPeriod{{Start: start, End: end, Price: s.Price}}
+	}
+
+	var periods []pricedPeriod
+	for i, c := range history {
+		from := start
+		if i > 0 {
+			from = maxDate(start, c.EffectiveFrom)
+		}
+		to := end
+		if i+1 < len(history) {
+			// цена действует до последнего дня перед следующим изменением
+			to = minDate(end, history[i+1].EffectiveFrom.AddDate(0, 0, -1))
+		}
+		if from.After(to) {
+			continue
+		}
+		periods = append(periods, pricedPeriod{Start: from, End: to, Price: c.Price})
+	}
+	return periods
+}
+
+func sortPriceHistory(history []PriceChange) {
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].EffectiveFrom.Before(history[j].EffectiveFrom)
+	})
+}
+
+// monthStart возвращает первое число месяца даты t
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// dayStart возвращает начало дня даты t
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
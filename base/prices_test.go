@@ -0,0 +1,88 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestPriceHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		id := insertAll(t, store, Subscription{UserID: testUser, Service: "netflix", Price: 100, StartDate: date("2024-01-15"), EndDate: openEnd})[0]
+
+		for _, change := range []PriceChange{
+			{SubscriptionID: id, Price: 150, EffectiveFrom: date("2024-03-10")},
+			// повторная запись на тот же месяц заменяет цену
+			{SubscriptionID: id, Price: 160, EffectiveFrom: date("2024-03-20")},
+			// будущая цена не меняет текущую
+			{SubscriptionID: id, Price: 999, EffectiveFrom: date("2999-01-01")},
+		} {
+			if _, err := store.AddPriceChange(ctx, change); err != nil {
+				t.Fatalf("AddPriceChange(%+v): %v", change, err)
+			}
+		}
+		_, err := store.AddPriceChange(ctx, PriceChange{SubscriptionID: id, Price: 0, EffectiveFrom: date("2024-05-01")})
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("нулевая цена: err = %v, want ErrValidation", err)
+		}
+
+		history, err := store.SelectPriceHistory(ctx, strconv.Itoa(id))
+		if err != nil {
+			t.Fatalf("SelectPriceHistory: %v", err)
+		}
+		want := []PriceChange{
+			{SubscriptionID: id, Price: 100, EffectiveFrom: date("2024-01-01")},
+			{SubscriptionID: id, Price: 160, EffectiveFrom: date("2024-03-01")},
+			{SubscriptionID: id, Price: 999, EffectiveFrom: date("2999-01-01")},
+		}
+		if len(history) != len(want) {
+			t.Fatalf("история %+v, want %+v", history, want)
+		}
+		for i := range want {
+			if history[i].SubscriptionID != want[i].SubscriptionID || history[i].Price != want[i].Price ||
+				!history[i].EffectiveFrom.Equal(want[i].EffectiveFrom) {
+				t.Errorf("запись %d = %+v, want %+v", i, history[i], want[i])
+			}
+		}
+
+		s, err := store.SelectSubscriptionByID(ctx, strconv.Itoa(id), false)
+		if err != nil {
+			t.Fatalf("SelectSubscriptionByID: %v", err)
+		}
+		if s.Price != 160 {
+			t.Errorf("текущая цена = %d, want 160", s.Price)
+		}
+	})
+}
+
+func TestCountSubscriptionsCostPriceHistory(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "история цен",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 100, StartDate: date("2024-01-01"), EndDate: openEnd},
+			},
+			prices: []PriceChange{
+				{SubscriptionID: 0, Price: 150, EffectiveFrom: date("2024-03-10")},
+				{SubscriptionID: 0, Price: 120, EffectiveFrom: date("2024-05-01")},
+			},
+			filter:     CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-05-31"), Breakdown: true},
+			want:       100 + 100 + 150 + 150 + 120,
+			wantMonths: []int{100, 100, 150, 150, 120},
+		},
+		{
+			name: "новая цена действует с месяца изменения",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 100, StartDate: date("2024-01-01"), EndDate: date("2024-03-31")},
+			},
+			prices: []PriceChange{
+				{SubscriptionID: 0, Price: 200, EffectiveFrom: date("2024-02-01")},
+			},
+			filter:     CostFilter{StartDate: date("2023-12-01"), EndDate: date("2024-03-31"), Breakdown: true},
+			want:       100 + 200 + 200,
+			wantMonths: []int{0, 100, 200, 200},
+		},
+	})
+}
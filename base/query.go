@@ -0,0 +1,224 @@
+package base
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля, по которым можно сортировать список подписок
+const (
+	SortByID          = "id"
+	SortByPrice       = "price"
+	SortByStartDate   = "start_date"
+	SortByServiceName = "service_name"
+)
+
+const (
+	DefaultPageLimit = 50  // размер страницы, если limit не указан
+	MaxPageLimit     = 500 // максимальный размер страницы
+)
+
+// ErrInvalidCursor возвращается, если курсор повреждён или получен при другой сортировке
+var ErrInvalidCursor = &Error{
+	Kind:    ErrValidation,
+	Code:    CodeInvalidCursor,
+	Message: "некорректный курсор",
+	Fields:  []FieldError{{Field: "cursor", Message: "повреждён или получен при другой сортировке"}},
+}
+
+// SubscriptionFilter описывает выборку подписок пользователя: фильтры, сортировку и страницу.
+// Нулевые значения полей означают «без фильтра».
+type SubscriptionFilter struct {
+	UserID       string
+	ServiceNames []string  // подписка должна относиться к одному из сервисов
+	MinPrice     *int      // цена не меньше
+	MaxPrice     *int      // цена не больше
+	ActiveAt     time.Time // подписка активна на эту дату
+	StartFrom    time.Time // start_date не раньше
+	StartTo      time.Time // start_date не позже
+	EndFrom      time.Time // end_date не раньше
+	EndTo        time.Time // end_date не позже
+
+	IncludeDeleted bool // возвращать и мягко удалённые подписки
+
+	SortBy   string // одно из SortBy*, по умолчанию SortByID
+	SortDesc bool
+	Limit    int    // по умолчанию DefaultPageLimit, не больше MaxPageLimit
+	Cursor   string // NextCursor предыдущей страницы
+}
+
+// SubscriptionPage — одна страница выборки подписок
+type SubscriptionPage struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	NextCursor    string         `json:"next_cursor,omitempty"` // пустой, если страница последняя
+}
+
+// pageCursor — позиция последней строки страницы для keyset-пагинации
+type pageCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+	Value  string `json:"v"`
+	ID     int    `json:"id"`
+}
+
+// IsSortField сообщает, можно ли сортировать подписки по полю name
+func IsSortField(name string) bool {
+	switch name {
+	case SortByID, SortByPrice, SortByStartDate, SortByServiceName:
+		return true
+	}
+	return false
+}
+
+// normalize подставляет значения по умолчанию для сортировки и размера страницы
+func (f SubscriptionFilter) normalize() SubscriptionFilter {
+	if f.SortBy == "" {
+		f.SortBy = SortByID
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageLimit
+	}
+	if f.Limit > MaxPageLimit {
+		f.Limit = MaxPageLimit
+	}
+	return f
+}
+
+// decodeCursor разбирает курсор и возвращает значение поля сортировки в типе колонки
+func (f SubscriptionFilter) decodeCursor() (*pageCursor, interface{}, error) {
+	if f.Cursor == "" {
+		return nil, nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	if c.SortBy != f.SortBy || c.Desc != f.SortDesc {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	var value interface{}
+	switch c.SortBy {
+	case SortByID:
+		value = c.ID
+	case SortByPrice:
+		value, err = strconv.Atoi(c.Value)
+	case SortByStartDate:
+		value, err = time.Parse(time.DateOnly, c.Value)
+	case SortByServiceName:
+		value = c.Value
+	default:
+		return nil, nil, ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	return &c, value, nil
+}
+
+// encodeCursor строит курсор, указывающий на подписку s
+func (f SubscriptionFilter) encodeCursor(s Subscription) string {
+	c := pageCursor{SortBy: f.SortBy, Desc: f.SortDesc, ID: s.ID}
+	switch f.SortBy {
+	case SortByPrice:
+		c.Value = strconv.Itoa(s.Price)
+	case SortByStartDate:
+		c.Value = s.StartDate.Format(time.DateOnly)
+	case SortByServiceName:
+		c.Value = s.Service
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cutPage обрезает выборку из limit+1 строк до страницы и выставляет курсор на следующую
+func (f SubscriptionFilter) cutPage(subscriptions []Subscription) SubscriptionPage {
+	page := SubscriptionPage{Subscriptions: subscriptions}
+	if len(subscriptions) > f.Limit {
+		page.Subscriptions = subscriptions[:f.Limit]
+		page.NextCursor = f.encodeCursor(page.Subscriptions[f.Limit-1])
+	}
+	return page
+}
+
+// compareSortKey сравнивает подписку с позицией курсора по (поле сортировки, id)
+// без учёта направления: -1, если s идёт раньше, 0 — совпадает, 1 — позже
+func compareSortKey(s Subscription, sortBy string, value interface{}, id int) int {
+	var c int
+	switch sortBy {
+	case SortByPrice:
+		c = compareInts(s.Price, value.(int))
+	case SortByStartDate:
+		c = s.StartDate.Compare(value.(time.Time))
+	case SortByServiceName:
+		c = strings.Compare(s.Service, value.(string))
+	}
+	if c != 0 {
+		return c
+	}
+	return compareInts(s.ID, id)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matches проверяет подписку на соответствие фильтрам (без учёта страницы)
+func (f SubscriptionFilter) matches(s Subscription) bool {
+	if !f.IncludeDeleted && s.DeletedAt != nil {
+		return false
+	}
+	if f.UserID != "" && s.UserID != f.UserID {
+		return false
+	}
+	if len(f.ServiceNames) > 0 && !containsString(f.ServiceNames, s.Service) {
+		return false
+	}
+	if f.MinPrice != nil && s.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && s.Price > *f.MaxPrice {
+		return false
+	}
+	if !f.ActiveAt.IsZero() && (s.StartDate.After(f.ActiveAt) || s.EndDate.Before(f.ActiveAt)) {
+		return false
+	}
+	if !f.StartFrom.IsZero() && s.StartDate.Before(f.StartFrom) {
+		return false
+	}
+	if !f.StartTo.IsZero() && s.StartDate.After(f.StartTo) {
+		return false
+	}
+	if !f.EndFrom.IsZero() && s.EndDate.Before(f.EndFrom) {
+		return false
+	}
+	if !f.EndTo.IsZero() && s.EndDate.After(f.EndTo) {
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package base
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSelectUsersSubscriptionsFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter SubscriptionFilter
+		want   []string
+	}{
+		{
+			name:   "по сервисам",
+			filter: SubscriptionFilter{UserID: testUser, ServiceNames: []string{"netflix", "apple"}},
+			want:   []string{"netflix", "apple"},
+		},
+		{
+			name:   "минимальная цена",
+			filter: SubscriptionFilter{UserID: testUser, MinPrice: intPtr(400)},
+			want:   []string{"netflix", "apple"},
+		},
+		{
+			name:   "максимальная цена",
+			filter: SubscriptionFilter{UserID: testUser, MaxPrice: intPtr(300)},
+			want:   []string{"spotify", "youtube"},
+		},
+		{
+			name:   "диапазон цен",
+			filter: SubscriptionFilter{UserID: testUser, MinPrice: intPtr(300), MaxPrice: intPtr(400)},
+			want:   []string{"netflix", "spotify", "youtube"},
+		},
+		{
+			name:   "активные на дату",
+			filter: SubscriptionFilter{UserID: testUser, ActiveAt: date("2024-02-15")},
+			want:   []string{"netflix", "youtube"},
+		},
+		{
+			name:   "активные в последний день подписки",
+			filter: SubscriptionFilter{UserID: testUser, ActiveAt: date("2024-06-30")},
+			want:   []string{"netflix", "spotify", "apple"},
+		},
+		{
+			name:   "начало не раньше",
+			filter: SubscriptionFilter{UserID: testUser, StartFrom: date("2024-01-01")},
+			want:   []string{"netflix", "spotify", "apple"},
+		},
+		{
+			name:   "начало не позже",
+			filter: SubscriptionFilter{UserID: testUser, StartTo: date("2024-01-01")},
+			want:   []string{"netflix", "youtube"},
+		},
+		{
+			name:   "окончание не раньше",
+			filter: SubscriptionFilter{UserID: testUser, EndFrom: date("2024-07-01")},
+			want:   []string{"spotify", "apple"},
+		},
+		{
+			name:   "окончание не позже",
+			filter: SubscriptionFilter{UserID: testUser, EndTo: date("2024-06-30")},
+			want:   []string{"netflix", "youtube"},
+		},
+		{
+			name:   "по цене, одинаковые цены по id",
+			filter: SubscriptionFilter{UserID: testUser, SortBy: SortByPrice},
+			want:   []string{"spotify", "youtube", "netflix", "apple"},
+		},
+		{
+			name:   "по цене по убыванию",
+			filter: SubscriptionFilter{UserID: testUser, SortBy: SortByPrice, SortDesc: true},
+			want:   []string{"apple", "netflix", "youtube", "spotify"},
+		},
+		{
+			name:   "по названию сервиса",
+			filter: SubscriptionFilter{UserID: testUser, SortBy: SortByServiceName},
+			want:   []string{"apple", "netflix", "spotify", "youtube"},
+		},
+		{
+			name:   "по дате начала по убыванию",
+			filter: SubscriptionFilter{UserID: testUser, SortBy: SortByStartDate, SortDesc: true},
+			want:   []string{"apple", "spotify", "netflix", "youtube"},
+		},
+		{
+			name:   "по id по убыванию",
+			filter: SubscriptionFilter{UserID: testUser, SortDesc: true},
+			want:   []string{"apple", "youtube", "spotify", "netflix"},
+		},
+	}
+
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := store.SelectUsersSubscriptions(context.Background(), tt.filter)
+				if err != nil {
+					t.Fatalf("SelectUsersSubscriptions: %v", err)
+				}
+				if got := serviceNames(page.Subscriptions); !slices.Equal(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				if page.NextCursor != "" {
+					t.Errorf("NextCursor = %q на единственной странице", page.NextCursor)
+				}
+			})
+		}
+	})
+}
+
+func TestSelectUsersSubscriptionsPagination(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+		ctx := context.Background()
+
+		for _, sortBy := range []string{SortByID, SortByPrice, SortByServiceName, SortByStartDate} {
+			for _, desc := range []bool{false, true} {
+				filter := SubscriptionFilter{UserID: testUser, SortBy: sortBy, SortDesc: desc}
+
+				all, err := store.SelectUsersSubscriptions(ctx, filter)
+				if err != nil {
+					t.Fatalf("%s desc=%v: %v", sortBy, desc, err)
+				}
+
+				// страницы по две подписки вместе должны дать ту же выборку
+				var walked []string
+				filter.Limit = 2
+				for pages := 0; ; pages++ {
+					if pages > len(all.Subscriptions) {
+						t.Fatalf("%s desc=%v: страницы не заканчиваются", sortBy, desc)
+					}
+					page, err := store.SelectUsersSubscriptions(ctx, filter)
+					if err != nil {
+						t.Fatalf("%s desc=%v: %v", sortBy, desc, err)
+					}
+					if len(page.Subscriptions) > filter.Limit {
+						t.Fatalf("%s desc=%v: на странице %d подписок, больше limit", sortBy, desc, len(page.Subscriptions))
+					}
+					walked = append(walked, serviceNames(page.Subscriptions)...)
+					if page.NextCursor == "" {
+						break
+					}
+					filter.Cursor = page.NextCursor
+				}
+
+				if want := serviceNames(all.Subscriptions); !slices.Equal(walked, want) {
+					t.Errorf("%s desc=%v: по страницам %v, want %v", sortBy, desc, walked, want)
+				}
+			}
+		}
+	})
+}
+
+func TestSelectUsersSubscriptionsInvalidCursor(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+		ctx := context.Background()
+
+		page, err := store.SelectUsersSubscriptions(ctx, SubscriptionFilter{UserID: testUser, SortBy: SortByPrice, Limit: 1})
+		if err != nil {
+			t.Fatalf("SelectUsersSubscriptions: %v", err)
+		}
+
+		cursor := func(raw string) string {
+			return base64.RawURLEncoding.EncodeToString([]byte(raw))
+		}
+		for name, filter := range map[string]SubscriptionFilter{
+			"не base64":             {UserID: testUser, SortBy: SortByPrice, Cursor: "!!!"},
+			"не JSON":               {UserID: testUser, Cursor: cursor("not json")},
+			"другая сортировка":     {UserID: testUser, SortBy: SortByStartDate, Cursor: page.NextCursor},
+			"другое направление":    {UserID: testUser, SortBy: SortByPrice, SortDesc: true, Cursor: page.NextCursor},
+			"некорректное значение": {UserID: testUser, SortBy: SortByPrice, Cursor: cursor(`{"s":"price","v":"x"}`)},
+		} {
+			if _, err := store.SelectUsersSubscriptions(ctx, filter); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("%s: err = %v, want ErrInvalidCursor", name, err)
+			}
+		}
+	})
+}
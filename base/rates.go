@@ -0,0 +1,233 @@
+package base
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultCurrency — базовая валюта: в ней указаны цены подписок без валюты и к ней заданы курсы
+const DefaultCurrency = "RUB"
+
+// ExchangeRate — курс валюты к DefaultCurrency на месяц
+type ExchangeRate struct {
+	Currency string    `json:"currency" example:"USD"`
+	Month    time.Time `json:"month"`
+	Rate     float64   `json:"rate" example:"92.5"` // сколько единиц DefaultCurrency стоит одна единица Currency
+}
+
+// MissingRate — месяц, для которого не нашлось курса валюты, и стоимость подписок в этой валюте не вошла в итог
+type MissingRate struct {
+	Month    string `json:"month" example:"01-2024"` // месяц в формате MM-YYYY
+	Currency string `json:"currency" example:"USD"`
+}
+
+// IsCurrencyCode проверяет, что code похож на код валюты ISO 4217 (три латинские буквы)
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCurrency приводит код валюты к верхнему регистру и подставляет DefaultCurrency для пустого
+func normalizeCurrency(code string) string {
+	if code == "" {
+		return DefaultCurrency
+	}
+	return strings.ToUpper(code)
+}
+
+// ValidateExchangeRate проверяет курс перед сохранением
+func ValidateExchangeRate(rate ExchangeRate) error {
+	if !IsCurrencyCode(rate.Currency) {
+		return InvalidField("currency", fmt.Sprintf("некорректный код валюты %q", rate.Currency))
+	}
+	if rate.Currency == DefaultCurrency {
+		return InvalidField("currency", fmt.Sprintf("курс %s к самой себе всегда равен 1", DefaultCurrency))
+	}
+	if rate.Rate <= 0 || math.IsInf(rate.Rate, 0) || math.IsNaN(rate.Rate) {
+		return InvalidField("rate", "должен быть положительным")
+	}
+	return nil
+}
+
+// ParseExchangeRatesCSV читает курсы из CSV со строками вида currency,month,rate
+// (month в формате MM-YYYY). Строка заголовка, если есть, пропускается.
+// Ошибки в данных возвращаются как ошибки валидации с полями вида line[3].rate.
+func ParseExchangeRatesCSV(r io.Reader) ([]ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var rates []ExchangeRate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, InvalidField("csv", err.Error())
+		}
+		if line == 1 && strings.EqualFold(record[0], "currency") {
+			continue
+		}
+
+		prefix := fmt.Sprintf("line[%d]", line)
+		month, err := time.Parse("01-2006", record[1])
+		if err != nil {
+			return nil, InvalidField(prefix+".month", "неверный формат месяца, используйте MM-YYYY")
+		}
+		value, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, InvalidField(prefix+".rate", "ожидается число")
+		}
+
+		rate := ExchangeRate{Currency: strings.ToUpper(record[0]), Month: month, Rate: value}
+		if err := ValidateExchangeRate(rate); err != nil {
+			return nil, WithFieldPrefix(err, prefix)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+// UpsertExchangeRates сохраняет курсы, заменяя уже загруженные на те же месяцы
+func (p *PostgresStore) UpsertExchangeRates(ctx context.Context, rates []ExchangeRate) (err error) {
+	ctx, span := startQuery(ctx, "UpsertExchangeRates")
+	defer span.end(&err)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO exchange_rates (currency, month, rate)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (currency, month) DO UPDATE SET rate = EXCLUDED.rate
+		`, rate.Currency, monthStart(rate.Month), rate.Rate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SelectExchangeRates возвращает загруженные курсы, опционально только для одной валюты
+func (p *PostgresStore) SelectExchangeRates(ctx context.Context, currency string) (_ []ExchangeRate, err error) {
+	ctx, span := startQuery(ctx, "SelectExchangeRates")
+	defer span.end(&err)
+
+	query := `SELECT currency, month, rate FROM exchange_rates`
+	args := []interface{}{}
+	if currency != "" {
+		query += " WHERE currency = $1"
+		args = append(args, currency)
+	}
+	query += " ORDER BY currency, month"
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Month, &rate.Rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	span.rows(len(rates))
+
+	return rates, rows.Err()
+}
+
+// selectRateTable загружает курсы нужных валют за период
+func (p *PostgresStore) selectRateTable(ctx context.Context, currencies []string, start, end time.Time) (_ rateTable, err error) {
+	ctx, span := startQuery(ctx, "selectRateTable")
+	defer span.end(&err)
+
+	table := rateTable{}
+	if len(currencies) == 0 {
+		return table, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT currency, month, rate
+		FROM exchange_rates
+		WHERE currency = ANY($1) AND month BETWEEN $2 AND $3
+	`, pq.Array(currencies), monthStart(start), monthStart(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var n int
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Month, &rate.Rate); err != nil {
+			return nil, err
+		}
+		table.add(rate)
+		n++
+	}
+	span.rows(n)
+
+	return table, rows.Err()
+}
+
+// rateTable — курсы к DefaultCurrency по валюте и месяцу
+type rateTable map[string]map[time.Time]float64
+
+func (t rateTable) add(rate ExchangeRate) {
+	if t[rate.Currency] == nil {
+		t[rate.Currency] = map[time.Time]float64{}
+	}
+	t[rate.Currency][monthStart(rate.Month)] = rate.Rate
+}
+
+func (t rateTable) rate(currency string, month time.Time) (float64, bool) {
+	if currency == DefaultCurrency {
+		return 1, true
+	}
+	rate, ok := t[currency][monthStart(month)]
+	return rate, ok
+}
+
+// convert переводит сумму из валюты from в валюту to по курсам месяца month, округляя до целого.
+// Если на этот месяц нет курса, возвращает код валюты, для которой его не хватило.
+func (t rateTable) convert(amount float64, from, to string, month time.Time) (int, string) {
+	if from == to {
+		return int(math.Round(amount)), ""
+	}
+	fromRate, ok := t.rate(from, month)
+	if !ok {
+		return 0, from
+	}
+	toRate, ok := t.rate(to, month)
+	if !ok {
+		return 0, to
+	}
+	return int(math.Round(amount * fromRate / toRate)), ""
+}
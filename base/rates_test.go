@@ -0,0 +1,158 @@
+package base
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseExchangeRatesCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		csv    string
+		want   []ExchangeRate
+		fields []string
+	}{
+		{
+			name: "с заголовком",
+			csv:  "currency,month,rate\nusd,01-2024,90.5\nEUR, 02-2024, 99\n",
+			want: []ExchangeRate{
+				{Currency: "USD", Month: date("2024-01-01"), Rate: 90.5},
+				{Currency: "EUR", Month: date("2024-02-01"), Rate: 99},
+			},
+		},
+		{
+			name: "без заголовка",
+			csv:  "USD,01-2024,90\n",
+			want: []ExchangeRate{{Currency: "USD", Month: date("2024-01-01"), Rate: 90}},
+		},
+		{name: "пустой файл", csv: ""},
+		{name: "неверный месяц", csv: "USD,2024-01,90\n", fields: []string{"line[1].month"}},
+		{name: "курс не число", csv: "currency,month,rate\nUSD,01-2024,abc\n", fields: []string{"line[2].rate"}},
+		{name: "отрицательный курс", csv: "USD,01-2024,-1\n", fields: []string{"line[1].rate"}},
+		{name: "курс базовой валюты", csv: "RUB,01-2024,1\n", fields: []string{"line[1].currency"}},
+		{name: "некорректный код валюты", csv: "DOLLAR,01-2024,90\n", fields: []string{"line[1].currency"}},
+		{name: "лишняя колонка", csv: "USD,01-2024,90,x\n", fields: []string{"csv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := ParseExchangeRatesCSV(strings.NewReader(tt.csv))
+			if tt.fields != nil {
+				assertFieldErrors(t, err, tt.fields...)
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseExchangeRatesCSV: %v", err)
+			}
+			if !slices.EqualFunc(rates, tt.want, equalRates) {
+				t.Errorf("got %+v, want %+v", rates, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeRates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+
+		for _, batch := range [][]ExchangeRate{
+			{
+				{Currency: "USD", Month: date("2024-02-01"), Rate: 91},
+				{Currency: "USD", Month: date("2024-01-01"), Rate: 90},
+				{Currency: "EUR", Month: date("2024-01-01"), Rate: 99},
+			},
+			// курс на тот же месяц заменяет загруженный
+			{{Currency: "USD", Month: date("2024-02-01"), Rate: 92}},
+		} {
+			if err := store.UpsertExchangeRates(ctx, batch); err != nil {
+				t.Fatalf("UpsertExchangeRates: %v", err)
+			}
+		}
+
+		tests := []struct {
+			currency string
+			want     []ExchangeRate
+		}{
+			{
+				currency: "",
+				want: []ExchangeRate{
+					{Currency: "EUR", Month: date("2024-01-01"), Rate: 99},
+					{Currency: "USD", Month: date("2024-01-01"), Rate: 90},
+					{Currency: "USD", Month: date("2024-02-01"), Rate: 92},
+				},
+			},
+			{
+				currency: "USD",
+				want: []ExchangeRate{
+					{Currency: "USD", Month: date("2024-01-01"), Rate: 90},
+					{Currency: "USD", Month: date("2024-02-01"), Rate: 92},
+				},
+			},
+			{currency: "GBP", want: []ExchangeRate{}},
+		}
+		for _, tt := range tests {
+			rates, err := store.SelectExchangeRates(ctx, tt.currency)
+			if err != nil {
+				t.Fatalf("SelectExchangeRates(%q): %v", tt.currency, err)
+			}
+			if !slices.EqualFunc(rates, tt.want, equalRates) {
+				t.Errorf("SelectExchangeRates(%q) = %+v, want %+v", tt.currency, rates, tt.want)
+			}
+		}
+	})
+}
+
+func TestCountSubscriptionsCostCurrencies(t *testing.T) {
+	runCostCases(t, []costCase{
+		{
+			name: "перевод в рубли по курсу месяца",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "github", Price: 10, Currency: "USD", StartDate: date("2024-01-01"), EndDate: date("2024-02-29")},
+				{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+			},
+			rates: []ExchangeRate{
+				{Currency: "USD", Month: date("2024-01-01"), Rate: 90},
+				{Currency: "USD", Month: date("2024-02-01"), Rate: 100.5},
+			},
+			filter: CostFilter{StartDate: date("2024-01-01"), EndDate: date("2024-02-29"), Breakdown: true},
+			// 10 × 100.5 = 1005
+			want:       900 + 400 + 1005,
+			wantMonths: []int{1300, 1005},
+		},
+		{
+			name: "отчёт в другой валюте",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "netflix", Price: 1000, StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+				{UserID: testUser, Service: "spotify", Price: 12, Currency: "EUR", StartDate: date("2024-01-01"), EndDate: date("2024-01-31")},
+			},
+			rates: []ExchangeRate{
+				{Currency: "USD", Month: date("2024-01-01"), Rate: 100},
+				{Currency: "EUR", Month: date("2024-01-01"), Rate: 110},
+			},
+			filter: withFilter(year2024, func(f *CostFilter) { f.Currency = "USD" }),
+			// 1000 RUB = 10 USD, 12 EUR = 1320 RUB = 13.2 USD
+			want: 10 + 13,
+		},
+		{
+			name: "месяцы без курса не входят в итог",
+			subscriptions: []Subscription{
+				{UserID: testUser, Service: "github", Price: 10, Currency: "USD", StartDate: date("2024-01-01"), EndDate: date("2024-03-31")},
+			},
+			rates: []ExchangeRate{
+				{Currency: "USD", Month: date("2024-02-01"), Rate: 90},
+			},
+			filter: year2024,
+			want:   900,
+			wantMissing: []MissingRate{
+				{Month: "01-2024", Currency: "USD"},
+				{Month: "03-2024", Currency: "USD"},
+			},
+		},
+	})
+}
+
+func equalRates(a, b ExchangeRate) bool {
+	return a.Currency == b.Currency && a.Month.Equal(b.Month) && a.Rate == b.Rate
+}
@@ -0,0 +1,189 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Виды напоминаний
+const (
+	ReminderRenewal = "renewal" // предстоящее списание
+	ReminderExpiry  = "expiry"  // последний день подписки
+)
+
+// MaxReminderWindowDays — самое длинное окно напоминаний
+const MaxReminderWindowDays = 30
+
+// ReminderSettings — за сколько дней до списания или окончания подписки напоминать пользователю
+type ReminderSettings struct {
+	UserID     string     `json:"user_id"`
+	WindowDays int        `json:"window_days" example:"3"`
+	Enabled    bool       `json:"enabled"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"` // пусто, если действуют настройки по умолчанию
+}
+
+// Reminder — напоминание о предстоящем списании или окончании подписки
+type Reminder struct {
+	Kind           string    `json:"kind" example:"renewal"` // renewal или expiry
+	SubscriptionID int       `json:"subscription_id"`
+	UserID         string    `json:"user_id"`
+	Service        string    `json:"service_name"`
+	Price          int       `json:"price"`
+	Currency       string    `json:"currency"`
+	BillingPeriod  string    `json:"billing_period"`
+	Date           time.Time `json:"date"` // день списания или последний день подписки
+}
+
+// CodeReminderSettingsNotFound — стабильный код ошибки для пользователя без своих настроек напоминаний
+const CodeReminderSettingsNotFound = "reminder_settings_not_found"
+
+// ErrReminderSettingsNotFound — пользователь не менял настройки напоминаний
+var ErrReminderSettingsNotFound = &Error{Kind: ErrNotFound, Code: CodeReminderSettingsNotFound, Message: "настройки напоминаний не заданы"}
+
+// ValidateReminderSettings проверяет настройки напоминаний перед записью
+func ValidateReminderSettings(s ReminderSettings) error {
+	var fields []FieldError
+	if s.UserID == "" {
+		fields = append(fields, FieldError{Field: "user_id", Message: "обязательное поле"})
+	}
+	if s.WindowDays < 1 || s.WindowDays > MaxReminderWindowDays {
+		fields = append(fields, FieldError{Field: "window_days", Message: "ожидается число дней от 1 до 30"})
+	}
+	if len(fields) > 0 {
+		return NewValidationError(fields...)
+	}
+	return nil
+}
+
+// UpcomingReminders возвращает напоминания о списаниях и окончании подписки, приходящихся на дни [from, to].
+// Первое списание в день начала подписки продлением не считается, а списаний после её окончания не бывает.
+func UpcomingReminders(s Subscription, from, to time.Time) []Reminder {
+	reminder := func(kind string, date time.Time) Reminder {
+		return Reminder{
+			Kind:           kind,
+			SubscriptionID: s.ID,
+			UserID:         s.UserID,
+			Service:        s.Service,
+			Price:          s.Price,
+			Currency:       s.Currency,
+			BillingPeriod:  normalizeBillingPeriod(s.BillingPeriod),
+			Date:           date,
+		}
+	}
+
+	start, end := dayStart(s.StartDate), dayStart(s.EndDate)
+	last := dayStart(to)
+	if end.Before(last) {
+		last = end
+	}
+	var reminders []Reminder
+	for _, date := range billingDates(s, from, last) {
+		if date.After(start) {
+			reminders = append(reminders, reminder(ReminderRenewal, date))
+		}
+	}
+	// бессрочная подписка хранится с концом 9999-12-31
+	if end.Year() < 9999 && !end.Before(dayStart(from)) && !end.After(dayStart(to)) {
+		reminders = append(reminders, reminder(ReminderExpiry, end))
+	}
+	return reminders
+}
+
+const reminderSettingsColumns = "user_id, window_days, enabled, updated_at"
+
+func scanReminderSettings(row rowScanner) (ReminderSettings, error) {
+	var s ReminderSettings
+	var updatedAt time.Time
+	err := row.Scan(&s.UserID, &s.WindowDays, &s.Enabled, &updatedAt)
+	s.UpdatedAt = &updatedAt
+	return s, err
+}
+
+// SelectReminderSettings возвращает настройки пользователя или ErrReminderSettingsNotFound
+func (p *PostgresStore) SelectReminderSettings(ctx context.Context, userID string) (_ ReminderSettings, err error) {
+	ctx, span := startQuery(ctx, "SelectReminderSettings")
+	defer span.end(&err)
+
+	query := `SELECT ` + reminderSettingsColumns + ` FROM reminder_settings WHERE user_id = $1`
+	s, err := scanReminderSettings(p.db.QueryRowContext(ctx, query, userID))
+	if err == sql.ErrNoRows {
+		return s, ErrReminderSettingsNotFound
+	}
+	return s, err
+}
+
+// SelectAllReminderSettings возвращает настройки всех пользователей, которые их меняли
+func (p *PostgresStore) SelectAllReminderSettings(ctx context.Context) (_ []ReminderSettings, err error) {
+	ctx, span := startQuery(ctx, "SelectAllReminderSettings")
+	defer span.end(&err)
+
+	rows, err := p.db.QueryContext(ctx, `SELECT `+reminderSettingsColumns+` FROM reminder_settings ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := []ReminderSettings{}
+	for rows.Next() {
+		s, err := scanReminderSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, s)
+	}
+	span.rows(len(settings))
+	return settings, rows.Err()
+}
+
+// UpsertReminderSettings сохраняет настройки пользователя, заменяя прежние
+func (p *PostgresStore) UpsertReminderSettings(ctx context.Context, settings ReminderSettings) (_ ReminderSettings, err error) {
+	ctx, span := startQuery(ctx, "UpsertReminderSettings")
+	defer span.end(&err)
+
+	if err := ValidateReminderSettings(settings); err != nil {
+		return ReminderSettings{}, err
+	}
+
+	query := `
+		INSERT INTO reminder_settings (user_id, window_days, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET window_days = EXCLUDED.window_days, enabled = EXCLUDED.enabled, updated_at = now()
+		RETURNING ` + reminderSettingsColumns
+	return scanReminderSettings(p.db.QueryRowContext(ctx, query, settings.UserID, settings.WindowDays, settings.Enabled))
+}
+
+// ClaimReminder отмечает напоминание отправленным в канал channel. false означает, что его уже отправил
+// этот или другой экземпляр сервиса; вставка атомарна, поэтому отправить напоминание может только один из них.
+func (p *PostgresStore) ClaimReminder(ctx context.Context, reminder Reminder, channel string) (_ bool, err error) {
+	ctx, span := startQuery(ctx, "ClaimReminder")
+	defer span.end(&err)
+
+	res, err := p.db.ExecContext(ctx, `
+		INSERT INTO sent_reminders (subscription_id, kind, due_date, channel)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, reminder.SubscriptionID, reminder.Kind, dayStart(reminder.Date), channel)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	span.affected(n)
+	return n == 1, err
+}
+
+// ReleaseReminder снимает отметку ClaimReminder, чтобы напоминание, которое не удалось отправить, ушло при следующем проходе
+func (p *PostgresStore) ReleaseReminder(ctx context.Context, reminder Reminder, channel string) (err error) {
+	ctx, span := startQuery(ctx, "ReleaseReminder")
+	defer span.end(&err)
+
+	res, err := p.db.ExecContext(ctx, `
+		DELETE FROM sent_reminders WHERE subscription_id = $1 AND kind = $2 AND due_date = $3 AND channel = $4
+	`, reminder.SubscriptionID, reminder.Kind, dayStart(reminder.Date), channel)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	span.affected(n)
+	return err
+}
@@ -0,0 +1,145 @@
+package base
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestUpcomingReminders(t *testing.T) {
+	tests := []struct {
+		name     string
+		sub      Subscription
+		from, to string
+		want     []string // вид и дата напоминаний
+	}{
+		{
+			name: "ежемесячное списание в окне",
+			sub:  Subscription{StartDate: date("2024-01-15"), EndDate: openEnd},
+			from: "2024-02-13", to: "2024-02-16",
+			want: []string{"renewal 2024-02-15"},
+		},
+		{
+			name: "первое списание в день начала — не продление",
+			sub:  Subscription{StartDate: date("2024-03-01"), EndDate: openEnd},
+			from: "2024-02-28", to: "2024-03-03",
+		},
+		{
+			name: "бессрочная подписка в последние дни календаря",
+			sub:  Subscription{StartDate: date("2024-01-15"), EndDate: openEnd},
+			from: "9999-12-29", to: "9999-12-31",
+		},
+		{
+			name: "бессрочная подписка без окончания в окне",
+			sub:  Subscription{StartDate: date("2024-01-15"), EndDate: openEnd},
+			from: "2024-03-14", to: "2024-03-16",
+			want: []string{"renewal 2024-03-15"},
+		},
+		{
+			name: "окончание без списаний после него",
+			sub:  Subscription{StartDate: date("2024-01-01"), EndDate: date("2024-03-31")},
+			from: "2024-03-29", to: "2024-04-02",
+			want: []string{"expiry 2024-03-31"},
+		},
+		{
+			name: "еженедельные списания",
+			sub:  Subscription{BillingPeriod: BillingWeekly, StartDate: date("2024-01-01"), EndDate: openEnd},
+			from: "2024-01-14", to: "2024-01-22",
+			want: []string{"renewal 2024-01-15", "renewal 2024-01-22"},
+		},
+		{
+			name: "ежегодное списание",
+			sub:  Subscription{BillingPeriod: BillingAnnual, StartDate: date("2023-04-01"), EndDate: openEnd},
+			from: "2024-03-30", to: "2024-04-02",
+			want: []string{"renewal 2024-04-01"},
+		},
+		{
+			name: "подписка закончилась до окна",
+			sub:  Subscription{StartDate: date("2023-01-01"), EndDate: date("2024-01-31")},
+			from: "2024-02-01", to: "2024-02-29",
+		},
+		{
+			name: "подписка начинается после окна",
+			sub:  Subscription{StartDate: date("2024-05-01"), EndDate: date("2024-05-31")},
+			from: "2024-04-01", to: "2024-04-30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.sub.ID, tt.sub.UserID, tt.sub.Service, tt.sub.Price, tt.sub.Currency = 7, testUser, "netflix", 400, "RUB"
+			var got []string
+			for _, r := range UpcomingReminders(tt.sub, date(tt.from), date(tt.to)) {
+				got = append(got, r.Kind+" "+r.Date.Format("2006-01-02"))
+				if r.SubscriptionID != 7 || r.UserID != testUser || r.Service != "netflix" || r.Price != 400 || r.Currency != "RUB" ||
+					r.BillingPeriod != normalizeBillingPeriod(tt.sub.BillingPeriod) {
+					t.Errorf("напоминание без данных подписки: %+v", r)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminderSettings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+
+		if _, err := store.SelectReminderSettings(ctx, testUser); err != ErrReminderSettingsNotFound {
+			t.Errorf("настройки до записи: err = %v, want ErrReminderSettingsNotFound", err)
+		}
+		_, err := store.UpsertReminderSettings(ctx, ReminderSettings{UserID: testUser, WindowDays: MaxReminderWindowDays + 1})
+		assertFieldErrors(t, err, "window_days")
+
+		for _, s := range []ReminderSettings{
+			{UserID: testUser, WindowDays: 3, Enabled: true},
+			{UserID: testUser, WindowDays: 7},
+			{UserID: otherUser, WindowDays: 1, Enabled: true},
+		} {
+			if _, err := store.UpsertReminderSettings(ctx, s); err != nil {
+				t.Fatalf("UpsertReminderSettings(%+v): %v", s, err)
+			}
+		}
+
+		got, err := store.SelectReminderSettings(ctx, testUser)
+		if err != nil || got.WindowDays != 7 || got.Enabled || got.UpdatedAt == nil {
+			t.Errorf("настройки после замены: %+v, %v", got, err)
+		}
+		all, err := store.SelectAllReminderSettings(ctx)
+		if err != nil || len(all) != 2 || all[0].UserID != otherUser || all[1].UserID != testUser {
+			t.Errorf("все настройки: %+v, %v", all, err)
+		}
+	})
+}
+
+func TestClaimReminder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		id := insertAll(t, store, Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-15"), EndDate: openEnd})[0]
+		renewal := Reminder{Kind: ReminderRenewal, SubscriptionID: id, Date: date("2024-02-15")}
+
+		claim := func(r Reminder, channel string, want bool) {
+			t.Helper()
+			got, err := store.ClaimReminder(ctx, r, channel)
+			if err != nil || got != want {
+				t.Errorf("ClaimReminder(%s %s, %s) = %v, %v, want %v", r.Kind, r.Date.Format("2006-01-02"), channel, got, err, want)
+			}
+		}
+
+		claim(renewal, "log", true)
+		// повторная отметка того же напоминания не проходит: его уже отправили
+		claim(renewal, "log", false)
+		// другой канал, вид и дата — отдельные напоминания
+		claim(renewal, "webhook", true)
+		claim(Reminder{Kind: ReminderExpiry, SubscriptionID: id, Date: date("2024-02-15")}, "log", true)
+		claim(Reminder{Kind: ReminderRenewal, SubscriptionID: id, Date: date("2024-03-15")}, "log", true)
+
+		if err := store.ReleaseReminder(ctx, renewal, "log"); err != nil {
+			t.Fatalf("ReleaseReminder: %v", err)
+		}
+		claim(renewal, "log", true)
+		claim(renewal, "webhook", false)
+	})
+}
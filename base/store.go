@@ -0,0 +1,122 @@
+package base
+
+import (
+	"context"
+	"time"
+)
+
+// SubscriptionStore описывает хранилище подписок: CRUD-операции и подсчёт стоимости.
+// Обработчики зависят только от этого интерфейса, поэтому сервис можно
+// запускать как поверх PostgreSQL (PostgresStore), так и в памяти (MemoryStore).
+// Ошибки предметной области возвращаются как *Error (см. errors.go).
+type SubscriptionStore interface {
+	// InsertSubscription добавляет подписку и возвращает её ID; некорректная подписка — ошибка ErrValidation
+	InsertSubscription(ctx context.Context, subscription Subscription) (int, error)
+	// InsertSubscriptions добавляет подписки одной транзакцией и возвращает их ID в том же порядке.
+	// Если хотя бы одна подписка некорректна, не добавляется ни одна, а в ошибке ErrValidation поля получают префикс [i].
+	InsertSubscriptions(ctx context.Context, subscriptions []Subscription) ([]int, error)
+	// SelectSubscriptionByID возвращает подписку по ID или ErrSubscriptionNotFound, если её нет.
+	// Мягко удалённые подписки возвращаются только при includeDeleted.
+	SelectSubscriptionByID(ctx context.Context, id string, includeDeleted bool) (Subscription, error)
+	// SelectUsersSubscriptions возвращает страницу подписок пользователя по фильтру.
+	// Некорректный курсор приводит к ErrInvalidCursor.
+	SelectUsersSubscriptions(ctx context.Context, filter SubscriptionFilter) (SubscriptionPage, error)
+	// StreamSubscriptions передаёт fn подписки по фильтру по одной, в порядке сортировки фильтра, не собирая их в память.
+	// Пагинация фильтра (Limit и Cursor) не учитывается, пустой UserID означает подписки всех пользователей.
+	// Ошибка fn прерывает выборку и возвращается как есть.
+	StreamSubscriptions(ctx context.Context, filter SubscriptionFilter, fn func(Subscription) error) error
+	// UpdateSubscription перезаписывает подписку с ID subscription.ID.
+	// Возвращает ErrSubscriptionNotFound, если её нет, и ErrSubscriptionDeleted, если она удалена.
+	UpdateSubscription(ctx context.Context, subscription Subscription) error
+	// DeleteSubscription мягко удаляет подписку по ID: она пропадает из выборок и подсчёта стоимости,
+	// но её можно восстановить до окончательной очистки. Если подписки нет, возвращает ErrSubscriptionNotFound.
+	DeleteSubscription(ctx context.Context, id string) error
+	// RestoreSubscription восстанавливает мягко удалённую подписку или возвращает ErrSubscriptionNotFound, если её нет
+	RestoreSubscription(ctx context.Context, id string) error
+	// SelectDeletionHistory возвращает историю удалений подписки или ErrSubscriptionNotFound, если её нет
+	SelectDeletionHistory(ctx context.Context, id string) ([]DeletionRecord, error)
+	// PurgeDeletedSubscriptions окончательно удаляет подписки, мягко удалённые раньше before
+	PurgeDeletedSubscriptions(ctx context.Context, before time.Time) (int, error)
+	// CountActiveSubscriptions возвращает число неудалённых подписок, действующих в день at
+	CountActiveSubscriptions(ctx context.Context, at time.Time) (int, error)
+	// AddPriceChange записывает цену, действующую с месяца change.EffectiveFrom.
+	// Если подписки нет, возвращает ErrSubscriptionNotFound, а если она удалена — ErrSubscriptionDeleted.
+	AddPriceChange(ctx context.Context, change PriceChange) (PriceChange, error)
+	// SelectPriceHistory возвращает историю цен подписки или ErrSubscriptionNotFound, если её нет
+	SelectPriceHistory(ctx context.Context, id string) ([]PriceChange, error)
+	// UpsertExchangeRates сохраняет курсы валют, заменяя загруженные ранее на те же месяцы
+	UpsertExchangeRates(ctx context.Context, rates []ExchangeRate) error
+	// SelectExchangeRates возвращает курсы валют, опционально только для одной валюты
+	SelectExchangeRates(ctx context.Context, currency string) ([]ExchangeRate, error)
+	// InsertAPIKey сохраняет новый API-ключ; хранится только хеш ключа
+	InsertAPIKey(ctx context.Context, key APIKey, hash string) (APIKey, error)
+	// SelectAPIKeys возвращает все API-ключи, включая отозванные
+	SelectAPIKeys(ctx context.Context) ([]APIKey, error)
+	// SelectAPIKeyByHash ищет API-ключ по хешу или возвращает ErrAPIKeyNotFound
+	SelectAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	// RevokeAPIKey отзывает API-ключ или возвращает ErrAPIKeyNotFound, если его нет
+	RevokeAPIKey(ctx context.Context, id string) error
+	// TouchAPIKey запоминает время последнего использования API-ключа
+	TouchAPIKey(ctx context.Context, id int, usedAt time.Time) error
+	// SelectReminderSettings возвращает настройки напоминаний пользователя или ErrReminderSettingsNotFound, если он их не менял
+	SelectReminderSettings(ctx context.Context, userID string) (ReminderSettings, error)
+	// SelectAllReminderSettings возвращает настройки напоминаний всех пользователей, которые их меняли
+	SelectAllReminderSettings(ctx context.Context) ([]ReminderSettings, error)
+	// UpsertReminderSettings сохраняет настройки напоминаний пользователя; некорректные настройки — ошибка ErrValidation
+	UpsertReminderSettings(ctx context.Context, settings ReminderSettings) (ReminderSettings, error)
+	// ClaimReminder атомарно отмечает напоминание отправленным в канал channel и возвращает false,
+	// если его уже отметил этот или другой экземпляр сервиса
+	ClaimReminder(ctx context.Context, reminder Reminder, channel string) (bool, error)
+	// ReleaseReminder снимает отметку ClaimReminder, если напоминание не удалось отправить
+	ReleaseReminder(ctx context.Context, reminder Reminder, channel string) error
+	// InsertWebhookEndpoint сохраняет новый вебхук; некорректный вебхук — ошибка ErrValidation
+	InsertWebhookEndpoint(ctx context.Context, endpoint WebhookEndpoint) (WebhookEndpoint, error)
+	// SelectWebhookEndpoints возвращает вебхуки пользователя userID, а при пустом userID — все вебхуки
+	SelectWebhookEndpoints(ctx context.Context, userID string) ([]WebhookEndpoint, error)
+	// SelectWebhookEndpoint возвращает вебхук по ID или ErrWebhookNotFound, если его нет
+	SelectWebhookEndpoint(ctx context.Context, id string) (WebhookEndpoint, error)
+	// DeleteWebhookEndpoint удаляет вебхук вместе с журналом доставок или возвращает ErrWebhookNotFound, если его нет
+	DeleteWebhookEndpoint(ctx context.Context, id string) error
+	// EnableWebhookEndpoint включает отключённый вебхук и обнуляет счётчик ошибок или возвращает ErrWebhookNotFound
+	EnableWebhookEndpoint(ctx context.Context, id string) (WebhookEndpoint, error)
+	// EnqueueWebhookEvent ставит событие в очередь доставки всем включённым вебхукам, подписанным на него,
+	// и возвращает число созданных доставок; вебхукам, которым событие с тем же ID уже поставлено, оно не дублируется
+	EnqueueWebhookEvent(ctx context.Context, event WebhookEvent) (int, error)
+	// ClaimWebhookDeliveries забирает до limit ожидающих доставок, которым пора выполнить попытку, вместе с адресом
+	// и ключом вебхука и откладывает их на lease, чтобы их не взял другой экземпляр сервиса
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error)
+	// FinishWebhookAttempt записывает итог попытки доставки и возвращает true, если вебхук отключён,
+	// потому что число ошибок доставки подряд достигло disableAfter (0 — не отключать)
+	FinishWebhookAttempt(ctx context.Context, attempt WebhookAttempt, disableAfter int) (bool, error)
+	// SelectWebhookDeliveries возвращает последние limit доставок вебхука, опционально только со статусом status
+	SelectWebhookDeliveries(ctx context.Context, endpointID string, status string, limit int) ([]WebhookDelivery, error)
+	// ReplayWebhookDelivery ставит событие доставки в очередь заново новой доставкой
+	// или возвращает ErrWebhookDeliveryNotFound, если у вебхука нет такой доставки
+	ReplayWebhookDelivery(ctx context.Context, endpointID, deliveryID string) (WebhookDelivery, error)
+	// ClaimOutboxEvents забирает до limit неопубликованных событий, которым пора выполнить попытку, и откладывает их на lease.
+	// У каждой подписки берётся только самое раннее неопубликованное событие, чтобы события подписки публиковались по порядку.
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error)
+	// MarkOutboxEventPublished отмечает событие опубликованным
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	// RetryOutboxEvent записывает ошибку публикации события и откладывает следующую попытку до nextAttemptAt
+	RetryOutboxEvent(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	// PurgePublishedOutboxEvents удаляет события, опубликованные раньше before, и возвращает их количество
+	PurgePublishedOutboxEvents(ctx context.Context, before time.Time) (int, error)
+	// ReserveIdempotencyKey занимает ключ идемпотентности rec.Scope/rec.Key на ttl и возвращает (rec, true).
+	// Если ключ уже занят и не истёк, возвращает сохранённую запись и false.
+	ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord, ttl time.Duration) (IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey сохраняет ответ rec.StatusCode, rec.ContentType и rec.Body для занятого ключа
+	CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) error
+	// ReleaseIdempotencyKey освобождает занятый ключ, ответ для которого не сохранён
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+	// PurgeExpiredIdempotencyKeys удаляет ключи идемпотентности, истёкшие раньше before
+	PurgeExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+	// CountSubscriptionsCost считает суммарную стоимость подписок по фильтру в валюте filter.Currency,
+	// при filter.Breakdown — с помесячной разбивкой
+	CountSubscriptionsCost(ctx context.Context, filter CostFilter) (CostReport, error)
+}
+
+var (
+	_ SubscriptionStore = (*PostgresStore)(nil)
+	_ SubscriptionStore = (*MemoryStore)(nil)
+)
@@ -0,0 +1,141 @@
+package base
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// storeFactories создают пустые хранилища, на которых прогоняются общие тесты.
+// PostgresStore добавляется в postgres_test.go при сборке с тегом postgres.
+var storeFactories = map[string]func(t *testing.T) SubscriptionStore{
+	"memory": func(*testing.T) SubscriptionStore { return NewMemoryStore() },
+}
+
+// forEachStore запускает test на каждом хранилище из storeFactories, каждый раз на пустом
+func forEachStore(t *testing.T, test func(t *testing.T, store SubscriptionStore)) {
+	t.Helper()
+
+	names := make([]string, 0, len(storeFactories))
+	for name := range storeFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			test(t, storeFactories[name](t))
+		})
+	}
+}
+
+const (
+	testUser  = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	otherUser = "0b2d6c3e-8f4a-4d6e-9a1b-2c3d4e5f6a7b"
+)
+
+// openEnd — дата окончания бессрочной подписки, как её записывает обработчик
+var openEnd = date("9999-12-31")
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// insertAll добавляет подписки и возвращает их ID в том же порядке
+func insertAll(t *testing.T, store SubscriptionStore, subscriptions ...Subscription) []int {
+	t.Helper()
+
+	ids, err := store.InsertSubscriptions(context.Background(), subscriptions)
+	if err != nil {
+		t.Fatalf("InsertSubscriptions: %v", err)
+	}
+	return ids
+}
+
+func deleteSubscription(t *testing.T, store SubscriptionStore, id int) {
+	t.Helper()
+
+	if err := store.DeleteSubscription(context.Background(), strconv.Itoa(id)); err != nil {
+		t.Fatalf("DeleteSubscription(%d): %v", id, err)
+	}
+}
+
+func serviceNames(subscriptions []Subscription) []string {
+	names := make([]string, len(subscriptions))
+	for i, s := range subscriptions {
+		names[i] = s.Service
+	}
+	return names
+}
+
+// seedFilterFixture добавляет подписки, на которых проверяются фильтры и сортировки.
+// Названия сервисов testUser различаются, поэтому по ним видно и состав, и порядок выборки.
+func seedFilterFixture(t *testing.T, store SubscriptionStore) {
+	t.Helper()
+
+	ids := insertAll(t, store,
+		Subscription{UserID: testUser, Service: "netflix", Price: 400, StartDate: date("2024-01-01"), EndDate: date("2024-06-30")},
+		Subscription{UserID: testUser, Service: "spotify", Price: 300, StartDate: date("2024-03-15"), EndDate: openEnd},
+		Subscription{UserID: testUser, Service: "youtube", Price: 300, StartDate: date("2023-11-01"), EndDate: date("2024-02-29")},
+		Subscription{UserID: testUser, Service: "apple", Price: 500, StartDate: date("2024-05-01"), EndDate: date("2024-12-31")},
+		Subscription{UserID: otherUser, Service: "netflix", Price: 250, StartDate: date("2024-01-01"), EndDate: openEnd},
+		Subscription{UserID: testUser, Service: "zoom", Price: 100, StartDate: date("2024-02-01"), EndDate: openEnd},
+	)
+	deleteSubscription(t, store, ids[5])
+}
+
+func TestSelectUsersSubscriptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter SubscriptionFilter
+		want   []string
+	}{
+		{
+			name:   "все подписки пользователя",
+			filter: SubscriptionFilter{UserID: testUser},
+			want:   []string{"netflix", "spotify", "youtube", "apple"},
+		},
+		{
+			name:   "другой пользователь",
+			filter: SubscriptionFilter{UserID: otherUser},
+			want:   []string{"netflix"},
+		},
+		{
+			name:   "неизвестный пользователь",
+			filter: SubscriptionFilter{UserID: "7a1e4a52-0000-4000-8000-000000000000"},
+			want:   []string{},
+		},
+		{
+			name:   "по сервису",
+			filter: SubscriptionFilter{UserID: testUser, ServiceNames: []string{"spotify"}},
+			want:   []string{"spotify"},
+		},
+	}
+
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := store.SelectUsersSubscriptions(context.Background(), tt.filter)
+				if err != nil {
+					t.Fatalf("SelectUsersSubscriptions: %v", err)
+				}
+				if got := serviceNames(page.Subscriptions); !slices.Equal(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestStreamSubscriptions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		seedFilterFixture(t, store)
+
+		var got []string
+		err := store.StreamSubscriptions(context.Background(), SubscriptionFilter{SortBy: SortByPrice, Limit: 1}, func(s Subscription) error {
+			got = append(got, s.Service+"/"+s.UserID[:4])
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StreamSubscriptions: %v", err)
+		}
+		want := []string{"netflix/0b2d", "spotify/6060", "youtube/6060", "netflix/6060", "apple/6060"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		stop := errors.New("стоп")
+		var calls int
+		err = store.StreamSubscriptions(context.Background(), SubscriptionFilter{}, func(Subscription) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("err = %v после %d вызовов, want ошибку fn после первого", err, calls)
+		}
+	})
+}
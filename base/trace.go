@@ -0,0 +1,61 @@
+package base
+
+import (
+	"context"
+	"effective_mobile/metrics"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("effective_mobile/base")
+
+// querySpan — span функции хранилища PostgreSQL вместе с замером её времени для метрик
+type querySpan struct {
+	span    trace.Span
+	observe func()
+}
+
+// startQuery начинает span функции хранилища name. Завершать его нужно через end:
+//
+//	ctx, span := startQuery(ctx, "SelectAPIKeys")
+//	defer span.end(&err)
+func startQuery(ctx context.Context, name string) (context.Context, *querySpan) {
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", name),
+		),
+	)
+	return ctx, &querySpan{span: span, observe: metrics.ObserveQuery(name)}
+}
+
+// rows записывает, сколько строк вернул запрос
+func (q *querySpan) rows(n int) {
+	q.span.SetAttributes(attribute.Int("db.response.returned_rows", n))
+}
+
+// affected записывает, сколько строк изменил запрос
+func (q *querySpan) affected(n int64) {
+	q.span.SetAttributes(attribute.Int64("db.response.affected_rows", n))
+}
+
+// end завершает span. Ошибки БД помечают span как ошибочный,
+// а ожидаемые ошибки предметной области (например, «подписка не найдена») лишь записываются кодом.
+func (q *querySpan) end(err *error) {
+	q.observe()
+	if err != nil && *err != nil {
+		var domainErr *Error
+		if errors.As(*err, &domainErr) {
+			q.span.SetAttributes(attribute.String("error.code", domainErr.Code))
+		} else {
+			q.span.RecordError(*err)
+			q.span.SetStatus(codes.Error, (*err).Error())
+		}
+	}
+	q.span.End()
+}
@@ -0,0 +1,470 @@
+package base
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Типы событий подписок. Первые три пишутся в outbox_events при изменении подписки, expiring — только вебхукам.
+const (
+	EventSubscriptionCreated  = "subscription.created"
+	EventSubscriptionUpdated  = "subscription.updated"
+	EventSubscriptionDeleted  = "subscription.deleted"
+	EventSubscriptionExpiring = "subscription.expiring" // подписка скоро закончится, по окну напоминаний пользователя
+)
+
+// WebhookEventTypes — все типы событий, на которые можно подписать вебхук
+var WebhookEventTypes = []string{EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionDeleted, EventSubscriptionExpiring}
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"   // ждёт первой или повторной попытки
+	DeliverySucceeded = "succeeded" // получатель ответил 2xx
+	DeliveryFailed    = "failed"    // попытки исчерпаны или вебхук отключён
+)
+
+// WebhookEvent — событие подписки, которое отправляется вебхукам
+type WebhookEvent struct {
+	ID        string       `json:"id" example:"6f1c2a9e4b7d4e0f9a3b5c8d1e2f3a4b"` // одинаков во всех доставках и повторах события
+	Type      string       `json:"type" example:"subscription.created"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      Subscription `json:"data"` // подписка после изменения
+}
+
+// NewWebhookEvent создаёт событие eventType о подписке s со случайным ID.
+// Валюта и период списания подставляются по умолчанию так же, как при записи подписки.
+func NewWebhookEvent(eventType string, s Subscription) WebhookEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	s.Currency = normalizeCurrency(s.Currency)
+	s.BillingPeriod = normalizeBillingPeriod(s.BillingPeriod)
+	return WebhookEvent{ID: hex.EncodeToString(id), Type: eventType, CreatedAt: time.Now().UTC(), Data: withMonthlyPrice(s)}
+}
+
+// WebhookEndpoint — получатель событий подписок
+type WebhookEndpoint struct {
+	ID                  int        `json:"id"`
+	URL                 string     `json:"url" example:"https://billing.example.com/hooks/subscriptions"`
+	Secret              string     `json:"secret,omitempty"`                                                // ключ подписи HMAC-SHA256, показывается только при создании
+	UserID              string     `json:"user_id,omitempty"`                                               // пусто — события всех пользователей
+	EventTypes          []string   `json:"event_types" example:"subscription.created,subscription.deleted"` // пусто — все события
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// Accepts сообщает, подписан ли вебхук на события пользователя userID типа eventType
+func (e WebhookEndpoint) Accepts(userID, eventType string) bool {
+	return (e.UserID == "" || e.UserID == userID) && (len(e.EventTypes) == 0 || slices.Contains(e.EventTypes, eventType))
+}
+
+// WebhookDelivery — доставка одного события одному вебхуку вместе с итогом последней попытки
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	EndpointID     int             `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type" example:"subscription.created"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"` // тело запроса, WebhookEvent
+	Status         string          `json:"status" example:"failed"`      // pending, succeeded или failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	ReplayOf       int             `json:"replay_of,omitempty"` // исходная доставка, если эта создана через replay
+
+	// адрес и ключ вебхука заполняются только в ClaimWebhookDeliveries
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt — итог попытки доставки
+type WebhookAttempt struct {
+	DeliveryID     int
+	EndpointID     int
+	Status         string    // новый статус доставки: succeeded, pending (будет повтор) или failed
+	NextAttemptAt  time.Time // время повтора для pending
+	ResponseStatus int       // код ответа получателя, 0 — ответа не было
+	Error          string
+}
+
+const (
+	CodeWebhookNotFound         = "webhook_not_found"
+	CodeWebhookDeliveryNotFound = "webhook_delivery_not_found"
+)
+
+var (
+	// ErrWebhookNotFound — вебхука нет
+	ErrWebhookNotFound = &Error{Kind: ErrNotFound, Code: CodeWebhookNotFound, Message: "вебхук не найден"}
+	// ErrWebhookDeliveryNotFound — доставки нет у этого вебхука
+	ErrWebhookDeliveryNotFound = &Error{Kind: ErrNotFound, Code: CodeWebhookDeliveryNotFound, Message: "доставка вебхука не найдена"}
+)
+
+// ValidateWebhookEndpoint проверяет вебхук перед записью
+func ValidateWebhookEndpoint(e WebhookEndpoint) error {
+	var fields []FieldError
+	if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fields = append(fields, FieldError{Field: "url", Message: "ожидается абсолютный адрес http или https"})
+	}
+	if len(e.Secret) < 16 {
+		fields = append(fields, FieldError{Field: "secret", Message: "не короче 16 символов"})
+	}
+	for i, t := range e.EventTypes {
+		if !slices.Contains(WebhookEventTypes, t) {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("event_types[%d]", i), Message: "неизвестный тип события"})
+		}
+	}
+	if len(fields) > 0 {
+		return NewValidationError(fields...)
+	}
+	return nil
+}
+
+const webhookEndpointColumns = "id, url, secret, user_id, event_types, enabled, consecutive_failures, disabled_at, disabled_reason, created_at"
+
+func scanWebhookEndpoint(row rowScanner) (WebhookEndpoint, error) {
+	var e WebhookEndpoint
+	var userID, disabledReason sql.NullString
+	var disabledAt sql.NullTime
+	err := row.Scan(&e.ID, &e.URL, &e.Secret, &userID, pq.Array(&e.EventTypes), &e.Enabled, &e.ConsecutiveFailures,
+		&disabledAt, &disabledReason, &e.CreatedAt)
+	e.UserID = userID.String
+	e.DisabledAt = nullTimePtr(disabledAt)
+	e.DisabledReason = disabledReason.String
+	if e.EventTypes == nil {
+		e.EventTypes = []string{}
+	}
+	return e, err
+}
+
+const webhookDeliveryColumns = "d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, " +
+	"d.last_error, d.response_status, d.created_at, d.delivered_at, d.replay_of"
+
+func scanWebhookDelivery(row rowScanner, extra ...any) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var lastError sql.NullString
+	var responseStatus, replayOf sql.NullInt64
+	var nextAttemptAt, deliveredAt sql.NullTime
+	dest := []any{&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &nextAttemptAt,
+		&lastError, &responseStatus, &d.CreatedAt, &deliveredAt, &replayOf}
+	err := row.Scan(append(dest, extra...)...)
+	d.NextAttemptAt = nullTimePtr(nextAttemptAt)
+	d.LastError = lastError.String
+	d.ResponseStatus = int(responseStatus.Int64)
+	d.DeliveredAt = nullTimePtr(deliveredAt)
+	d.ReplayOf = int(replayOf.Int64)
+	return d, err
+}
+
+// InsertWebhookEndpoint сохраняет новый вебхук
+func (p *PostgresStore) InsertWebhookEndpoint(ctx context.Context, e WebhookEndpoint) (_ WebhookEndpoint, err error) {
+	ctx, span := startQuery(ctx, "InsertWebhookEndpoint")
+	defer span.end(&err)
+
+	if err := ValidateWebhookEndpoint(e); err != nil {
+		return WebhookEndpoint{}, err
+	}
+
+	query := `
+		INSERT INTO webhook_endpoints (url, secret, user_id, event_types)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		RETURNING ` + webhookEndpointColumns
+	return scanWebhookEndpoint(p.db.QueryRowContext(ctx, query, e.URL, e.Secret, e.UserID, pq.Array(e.EventTypes)))
+}
+
+// SelectWebhookEndpoints возвращает вебхуки пользователя userID, а при пустом userID — все вебхуки
+func (p *PostgresStore) SelectWebhookEndpoints(ctx context.Context, userID string) (_ []WebhookEndpoint, err error) {
+	ctx, span := startQuery(ctx, "SelectWebhookEndpoints")
+	defer span.end(&err)
+
+	query := `SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints`
+	args := []interface{}{}
+	if userID != "" {
+		query += " WHERE user_id = $1"
+		args = append(args, userID)
+	}
+	query += " ORDER BY id"
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	span.rows(len(endpoints))
+	return endpoints, rows.Err()
+}
+
+// SelectWebhookEndpoint возвращает вебхук по ID или ErrWebhookNotFound
+func (p *PostgresStore) SelectWebhookEndpoint(ctx context.Context, id string) (_ WebhookEndpoint, err error) {
+	ctx, span := startQuery(ctx, "SelectWebhookEndpoint")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+	query := `SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints WHERE id = $1`
+	e, err := scanWebhookEndpoint(p.db.QueryRowContext(ctx, query, key))
+	if err == sql.ErrNoRows {
+		return e, ErrWebhookNotFound
+	}
+	return e, err
+}
+
+// DeleteWebhookEndpoint удаляет вебхук вместе с журналом его доставок
+func (p *PostgresStore) DeleteWebhookEndpoint(ctx context.Context, id string) (err error) {
+	ctx, span := startQuery(ctx, "DeleteWebhookEndpoint")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	span.affected(n)
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// EnableWebhookEndpoint включает вебхук и обнуляет счётчик ошибок подряд
+func (p *PostgresStore) EnableWebhookEndpoint(ctx context.Context, id string) (_ WebhookEndpoint, err error) {
+	ctx, span := startQuery(ctx, "EnableWebhookEndpoint")
+	defer span.end(&err)
+
+	key, err := parseID(id)
+	if err != nil {
+		return WebhookEndpoint{}, err
+	}
+	query := `
+		UPDATE webhook_endpoints
+		SET enabled = TRUE, consecutive_failures = 0, disabled_at = NULL, disabled_reason = NULL
+		WHERE id = $1
+		RETURNING ` + webhookEndpointColumns
+	e, err := scanWebhookEndpoint(p.db.QueryRowContext(ctx, query, key))
+	if err == sql.ErrNoRows {
+		return e, ErrWebhookNotFound
+	}
+	return e, err
+}
+
+// EnqueueWebhookEvent ставит событие в очередь доставки всем включённым вебхукам, подписанным на него,
+// и возвращает число созданных доставок. Вебхук, которому событие с тем же ID уже поставлено, пропускается:
+// outbox может опубликовать событие повторно, если после этого публикатора ошибся следующий.
+func (p *PostgresStore) EnqueueWebhookEvent(ctx context.Context, event WebhookEvent) (_ int, err error) {
+	ctx, span := startQuery(ctx, "EnqueueWebhookEvent")
+	defer span.end(&err)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	res, err := p.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3::jsonb FROM webhook_endpoints
+		WHERE enabled AND (user_id IS NULL OR user_id = $4) AND (cardinality(event_types) = 0 OR $2 = ANY (event_types))
+		ON CONFLICT (endpoint_id, event_id) WHERE replay_of IS NULL DO NOTHING
+	`, event.ID, event.Type, string(payload), event.Data.UserID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	span.affected(n)
+	return int(n), err
+}
+
+// ClaimWebhookDeliveries забирает до limit доставок, которым пора выполнить попытку, и откладывает их на lease:
+// другие экземпляры сервиса их не возьмут, а если этот упадёт, доставки вернутся в очередь по истечении lease
+func (p *PostgresStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (_ []WebhookDelivery, err error) {
+	ctx, span := startQuery(ctx, "ClaimWebhookDeliveries")
+	defer span.end(&err)
+
+	rows, err := p.db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhook_endpoints e ON e.id = d.endpoint_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND e.enabled
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, webhook_endpoints e
+		WHERE d.id = due.id AND e.id = d.endpoint_id
+		RETURNING `+webhookDeliveryColumns+`, e.url, e.secret
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var url, secret string
+		d, err := scanWebhookDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, d)
+	}
+	span.rows(len(deliveries))
+	return deliveries, rows.Err()
+}
+
+// FinishWebhookAttempt записывает итог попытки и ведёт счётчик ошибок вебхука подряд. Когда он достигает
+// disableAfter (0 — никогда), вебхук отключается, а его ожидающие доставки помечаются failed; тогда возвращается true.
+func (p *PostgresStore) FinishWebhookAttempt(ctx context.Context, a WebhookAttempt, disableAfter int) (_ bool, err error) {
+	ctx, span := startQuery(ctx, "FinishWebhookAttempt")
+	defer span.end(&err)
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var nextAttemptAt *time.Time
+	if a.Status == DeliveryPending {
+		nextAttemptAt = &a.NextAttemptAt
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_error = NULLIF($4, ''),
+			response_status = NULLIF($5, 0), delivered_at = CASE WHEN $2 = 'succeeded' THEN now() END
+		WHERE id = $1
+	`, a.DeliveryID, a.Status, nextAttemptAt, a.Error, a.ResponseStatus)
+	if err != nil {
+		return false, err
+	}
+
+	if a.Status == DeliverySucceeded {
+		if _, err := tx.ExecContext(ctx, `UPDATE webhook_endpoints SET consecutive_failures = 0 WHERE id = $1`, a.EndpointID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	var failures int
+	var enabled bool
+	err = tx.QueryRowContext(ctx, `
+		UPDATE webhook_endpoints SET consecutive_failures = consecutive_failures + 1
+		WHERE id = $1
+		RETURNING consecutive_failures, enabled
+	`, a.EndpointID).Scan(&failures, &enabled)
+	if err == sql.ErrNoRows {
+		// вебхук удалили во время попытки
+		return false, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	disabled := enabled && disableAfter > 0 && failures >= disableAfter
+	if disabled {
+		reason := fmt.Sprintf("отключён после %d ошибок доставки подряд", failures)
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE webhook_endpoints SET enabled = FALSE, disabled_at = now(), disabled_reason = $2 WHERE id = $1
+		`, a.EndpointID, reason); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE webhook_deliveries SET status = 'failed', next_attempt_at = NULL, last_error = $2
+			WHERE endpoint_id = $1 AND status = 'pending'
+		`, a.EndpointID, "вебхук "+reason); err != nil {
+			return false, err
+		}
+	}
+	return disabled, tx.Commit()
+}
+
+// SelectWebhookDeliveries возвращает последние limit доставок вебхука, новые первыми, опционально только со статусом status
+func (p *PostgresStore) SelectWebhookDeliveries(ctx context.Context, endpointID string, status string, limit int) (_ []WebhookDelivery, err error) {
+	ctx, span := startQuery(ctx, "SelectWebhookDeliveries")
+	defer span.end(&err)
+
+	key, err := parseID(endpointID)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d WHERE d.endpoint_id = $1`
+	args := []interface{}{key}
+	if status != "" {
+		query += " AND d.status = $2"
+		args = append(args, status)
+	}
+	query += fmt.Sprintf(" ORDER BY d.id DESC LIMIT %d", limit)
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	span.rows(len(deliveries))
+	return deliveries, rows.Err()
+}
+
+// ReplayWebhookDelivery ставит событие доставки deliveryID вебхука endpointID в очередь заново новой доставкой.
+// ID события сохраняется, чтобы получатель мог отбросить повтор, который уже обработал; новая доставка
+// ссылается на исходную через replay_of и поэтому не считается дублем события.
+func (p *PostgresStore) ReplayWebhookDelivery(ctx context.Context, endpointID, deliveryID string) (_ WebhookDelivery, err error) {
+	ctx, span := startQuery(ctx, "ReplayWebhookDelivery")
+	defer span.end(&err)
+
+	endpointKey, err := parseID(endpointID)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	deliveryKey, err := parseID(deliveryID)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	d, err := scanWebhookDelivery(p.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries AS d (endpoint_id, event_id, event_type, payload, replay_of)
+		SELECT endpoint_id, event_id, event_type, payload, id FROM webhook_deliveries
+		WHERE id = $1 AND endpoint_id = $2
+		RETURNING `+webhookDeliveryColumns,
+		deliveryKey, endpointKey))
+	if err == sql.ErrNoRows {
+		return d, ErrWebhookDeliveryNotFound
+	}
+	return d, err
+}
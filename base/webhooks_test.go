@@ -0,0 +1,171 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_0123456789abcdef"
+
+func insertWebhook(t *testing.T, store SubscriptionStore, e WebhookEndpoint) WebhookEndpoint {
+	t.Helper()
+
+	if e.URL == "" {
+		e.URL = "https://hooks.example.com/subscriptions"
+	}
+	e.Secret = testWebhookSecret
+	e, err := store.InsertWebhookEndpoint(context.Background(), e)
+	if err != nil {
+		t.Fatalf("InsertWebhookEndpoint: %v", err)
+	}
+	return e
+}
+
+func TestInsertWebhookEndpointValidation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		_, err := store.InsertWebhookEndpoint(context.Background(), WebhookEndpoint{
+			URL:        "ftp://hooks.example.com",
+			Secret:     "short",
+			EventTypes: []string{EventSubscriptionCreated, "subscription.renamed"},
+		})
+		assertFieldErrors(t, err, "url", "secret", "event_types[1]")
+	})
+}
+
+func TestEnqueueWebhookEvent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		all := insertWebhook(t, store, WebhookEndpoint{})
+		own := insertWebhook(t, store, WebhookEndpoint{UserID: testUser})
+		other := insertWebhook(t, store, WebhookEndpoint{UserID: otherUser})
+		deletions := insertWebhook(t, store, WebhookEndpoint{EventTypes: []string{EventSubscriptionDeleted}})
+
+		event := NewWebhookEvent(EventSubscriptionCreated, Subscription{ID: 1, UserID: testUser, Service: "netflix", Price: 400})
+		n, err := store.EnqueueWebhookEvent(ctx, event)
+		if err != nil {
+			t.Fatalf("EnqueueWebhookEvent: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("поставлено %d доставок, want 2", n)
+		}
+		for _, tt := range []struct {
+			endpoint WebhookEndpoint
+			want     int
+		}{{all, 1}, {own, 1}, {other, 0}, {deletions, 0}} {
+			if got := deliveries(t, store, tt.endpoint.ID, ""); len(got) != tt.want {
+				t.Errorf("вебхук %d: %d доставок, want %d", tt.endpoint.ID, len(got), tt.want)
+			}
+		}
+
+		// повторная публикация того же события, например после ошибки другого публикатора outbox, не дублирует доставки
+		n, err = store.EnqueueWebhookEvent(ctx, event)
+		if err != nil || n != 0 {
+			t.Errorf("повторная постановка: %d, %v, want 0", n, err)
+		}
+
+		// повтор вручную создаёт новую доставку того же события
+		original := deliveries(t, store, own.ID, "")[0]
+		replay, err := store.ReplayWebhookDelivery(ctx, strconv.Itoa(own.ID), strconv.Itoa(original.ID))
+		if err != nil {
+			t.Fatalf("ReplayWebhookDelivery: %v", err)
+		}
+		if replay.ID == original.ID || replay.EventID != event.ID || replay.ReplayOf != original.ID || replay.Status != DeliveryPending {
+			t.Errorf("повтор %+v исходной доставки %d", replay, original.ID)
+		}
+		if _, err := store.ReplayWebhookDelivery(ctx, strconv.Itoa(other.ID), strconv.Itoa(original.ID)); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+			t.Errorf("повтор чужой доставки: err = %v, want ErrWebhookDeliveryNotFound", err)
+		}
+		if n, err := store.EnqueueWebhookEvent(ctx, event); err != nil || n != 0 {
+			t.Errorf("постановка после повтора: %d, %v, want 0", n, err)
+		}
+	})
+}
+
+func TestWebhookDeliveryAttempts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store SubscriptionStore) {
+		ctx := context.Background()
+		endpoint := insertWebhook(t, store, WebhookEndpoint{})
+		for i := 1; i <= 3; i++ {
+			event := NewWebhookEvent(EventSubscriptionUpdated, Subscription{ID: i, UserID: testUser, Service: "netflix", Price: 400})
+			if _, err := store.EnqueueWebhookEvent(ctx, event); err != nil {
+				t.Fatalf("EnqueueWebhookEvent: %v", err)
+			}
+		}
+
+		claimed, err := store.ClaimWebhookDeliveries(ctx, 2, time.Minute)
+		if err != nil {
+			t.Fatalf("ClaimWebhookDeliveries: %v", err)
+		}
+		if len(claimed) != 2 || claimed[0].URL != endpoint.URL || claimed[0].Secret != testWebhookSecret {
+			t.Fatalf("забраны доставки %+v", claimed)
+		}
+		// забранные доставки отложены на lease, поэтому остаётся только третья
+		rest, err := store.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+		if err != nil || len(rest) != 1 {
+			t.Fatalf("повторная выборка: %d доставок, %v, want 1", len(rest), err)
+		}
+
+		disabled, err := store.FinishWebhookAttempt(ctx, WebhookAttempt{
+			DeliveryID: claimed[0].ID, EndpointID: endpoint.ID, Status: DeliverySucceeded, ResponseStatus: 204,
+		}, 2)
+		if err != nil || disabled {
+			t.Fatalf("успешная попытка: %v, %v", disabled, err)
+		}
+		disabled, err = store.FinishWebhookAttempt(ctx, WebhookAttempt{
+			DeliveryID: claimed[1].ID, EndpointID: endpoint.ID, Status: DeliveryPending, ResponseStatus: 500,
+			Error: "получатель ответил 500", NextAttemptAt: time.Now().Add(time.Hour),
+		}, 2)
+		if err != nil || disabled {
+			t.Fatalf("первая ошибка: %v, %v", disabled, err)
+		}
+
+		succeeded := deliveries(t, store, endpoint.ID, DeliverySucceeded)
+		if len(succeeded) != 1 || succeeded[0].Attempts != 1 || succeeded[0].DeliveredAt == nil || succeeded[0].ResponseStatus != 204 {
+			t.Errorf("успешные доставки: %+v", succeeded)
+		}
+		pending := deliveries(t, store, endpoint.ID, DeliveryPending)
+		if len(pending) != 2 || pending[1].LastError == "" || pending[1].ResponseStatus != 500 {
+			t.Errorf("ожидающие доставки: %+v", pending)
+		}
+
+		// вторая ошибка подряд отключает вебхук, и его ожидающие доставки завершаются ошибкой
+		disabled, err = store.FinishWebhookAttempt(ctx, WebhookAttempt{
+			DeliveryID: rest[0].ID, EndpointID: endpoint.ID, Status: DeliveryPending, Error: "timeout",
+			NextAttemptAt: time.Now().Add(time.Hour),
+		}, 2)
+		if err != nil || !disabled {
+			t.Fatalf("вторая ошибка: %v, %v, want disabled", disabled, err)
+		}
+		e, err := store.SelectWebhookEndpoint(ctx, strconv.Itoa(endpoint.ID))
+		if err != nil {
+			t.Fatalf("SelectWebhookEndpoint: %v", err)
+		}
+		if e.Enabled || e.DisabledAt == nil || e.ConsecutiveFailures != 2 {
+			t.Errorf("вебхук после ошибок: %+v", e)
+		}
+		if got := deliveries(t, store, endpoint.ID, DeliveryFailed); len(got) != 2 {
+			t.Errorf("%d доставок failed, want 2", len(got))
+		}
+		if n, err := store.EnqueueWebhookEvent(ctx, NewWebhookEvent(EventSubscriptionCreated, Subscription{UserID: testUser})); err != nil || n != 0 {
+			t.Errorf("постановка отключённому вебхуку: %d, %v, want 0", n, err)
+		}
+
+		e, err = store.EnableWebhookEndpoint(ctx, strconv.Itoa(endpoint.ID))
+		if err != nil || !e.Enabled || e.ConsecutiveFailures != 0 || e.DisabledAt != nil {
+			t.Errorf("EnableWebhookEndpoint: %+v, %v", e, err)
+		}
+	})
+}
+
+func deliveries(t *testing.T, store SubscriptionStore, endpointID int, status string) []WebhookDelivery {
+	t.Helper()
+
+	d, err := store.SelectWebhookDeliveries(context.Background(), strconv.Itoa(endpointID), status, 100)
+	if err != nil {
+		t.Fatalf("SelectWebhookDeliveries: %v", err)
+	}
+	return d
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateWebhooksAndOutbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string // подстрока ошибки, пусто — настройки корректны
+	}{
+		{name: "по умолчанию", modify: func(*Config) {}},
+		{
+			name:   "вебхуки выключены вместе с outbox",
+			modify: func(c *Config) { c.Webhooks.PollInterval, c.Outbox.PollInterval = 0, 0 },
+		},
+		{
+			name:    "вебхуки без outbox",
+			modify:  func(c *Config) { c.Outbox.PollInterval = 0 },
+			wantErr: "WEBHOOK_POLL_INTERVAL",
+		},
+		{
+			name:    "вебхуки без публикатора webhooks",
+			modify:  func(c *Config) { c.Outbox.Publishers = "file" },
+			wantErr: "WEBHOOK_POLL_INTERVAL",
+		},
+		{
+			name:   "публикатор webhooks среди других",
+			modify: func(c *Config) { c.Outbox.Publishers = " file , webhooks" },
+		},
+		{
+			name:    "неизвестный публикатор",
+			modify:  func(c *Config) { c.Outbox.Publishers = "webhooks,kafka" },
+			wantErr: "OUTBOX_PUBLISHERS",
+		},
+		{
+			name:    "nats без адреса",
+			modify:  func(c *Config) { c.Outbox.Publishers = "webhooks,nats" },
+			wantErr: "OUTBOX_NATS_URL",
+		},
+		{
+			name:    "предел задержки меньше первой",
+			modify:  func(c *Config) { c.Outbox.MaxRetryBackoff = c.Outbox.RetryBackoff - time.Millisecond },
+			wantErr: "OUTBOX_MAX_RETRY_BACKOFF",
+		},
+		{
+			name:   "разрешённые внутренние сети",
+			modify: func(c *Config) { c.Webhooks.AllowPrivate = "10.20.0.0/16, fd00::/8," },
+		},
+		{
+			name:    "внутренняя сеть без маски",
+			modify:  func(c *Config) { c.Webhooks.AllowPrivate = "10.20.0.1" },
+			wantErr: "WEBHOOK_ALLOW_PRIVATE",
+		},
+	}
+
+	for _, tt := range tests {
+		c := Default()
+		c.DB.Host, c.DB.User, c.DB.Name = "localhost", "postgres", "subscriptions"
+		tt.modify(&c)
+
+		err := c.Validate()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: err = %v, want ошибку %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAllowedPrivateNetworks(t *testing.T) {
+	c := WebhookConfig{AllowPrivate: " 10.20.0.0/16, ,fd00::/8 "}
+	got := c.AllowedPrivateNetworks()
+	if len(got) != 2 || got[0] != "10.20.0.0/16" || got[1] != "fd00::/8" {
+		t.Errorf("AllowedPrivateNetworks() = %q", got)
+	}
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"effective_mobile/ratelimit"
+)
+
+// redacted подставляется вместо секретов при выводе настроек
+const redacted = "***"
+
+// configFlag — флаг с путём к файлу конфигурации; без него используется CONFIG_FILE
+const configFlag = "config"
+
+// param — одно поле Config вместе с описанием из тегов
+type param struct {
+	path   string // ключ в файле, например db.host
+	env    string
+	flag   string
+	desc   string
+	secret string // "" — не секрет, "true" — скрывается целиком, "url" — скрывается только пароль в адресе
+	value  reflect.Value
+}
+
+// params перечисляет поля c в порядке объявления; значения можно менять через value
+func params(c *Config) []param {
+	var out []param
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := prefix + f.Tag.Get("json")
+			env := f.Tag.Get("env")
+			if env == "" {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			out = append(out, param{
+				path:   key,
+				env:    env,
+				flag:   strings.ReplaceAll(strings.ToLower(env), "_", "-"),
+				desc:   f.Tag.Get("desc"),
+				secret: f.Tag.Get("secret"),
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return out
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	limitType    = reflect.TypeOf(ratelimit.Limit{})
+)
+
+// set разбирает строковое значение s в поле p
+func (p param) set(s string) error {
+	switch {
+	case p.value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("некорректная длительность %q", s)
+		}
+		p.value.SetInt(int64(d))
+	case p.value.Type() == limitType:
+		limit, err := ratelimit.ParseLimit(s)
+		if err != nil {
+			return err
+		}
+		p.value.Set(reflect.ValueOf(limit))
+	case p.value.Kind() == reflect.String:
+		p.value.SetString(s)
+	case p.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", s)
+		}
+		p.value.SetInt(int64(n))
+	case p.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("ожидается true или false, получено %q", s)
+		}
+		p.value.SetBool(b)
+	default:
+		return fmt.Errorf("неподдерживаемый тип %s", p.value.Type())
+	}
+	return nil
+}
+
+// display возвращает значение поля для вывода: длительности и лимиты строками, секреты скрыты
+func (p param) display() any {
+	switch p.secret {
+	case "true":
+		if p.value.String() != "" {
+			return redacted
+		}
+	case "url":
+		if p.value.String() != "" {
+			return redactURL(p.value.String())
+		}
+	}
+
+	switch p.value.Type() {
+	case durationType:
+		return formatDuration(time.Duration(p.value.Int()))
+	case limitType:
+		return p.value.Interface().(ratelimit.Limit).String()
+	}
+	return p.value.Interface()
+}
+
+// formatDuration печатает длительность без нулевых хвостов: 1h0m0s -> 1h, 1m0s -> 1m
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// BindFlags регистрирует в fs флаг -config и по флагу на каждый параметр (DB_HOST -> -db-host).
+// У флагов нет значений по умолчанию: незаданный флаг не перекрывает файл и окружение.
+func BindFlags(fs *flag.FlagSet) {
+	fs.String(configFlag, "", "файл конфигурации JSON (по умолчанию CONFIG_FILE)")
+
+	def := Default()
+	for _, p := range params(&def) {
+		usage := fmt.Sprintf("%s (%s", p.desc, p.env)
+		if v := p.display(); v != "" && v != false {
+			usage += fmt.Sprintf(", по умолчанию %v", v)
+		}
+		fs.String(p.flag, "", usage+")")
+	}
+}
+
+// Load собирает настройки: значения по умолчанию, затем файл конфигурации, переменные окружения
+// и явно заданные флаги fs (fs должен быть разобран; nil — без флагов).
+// Ошибки разбора всех источников возвращаются вместе; обязательные поля проверяет Validate.
+func Load(fs *flag.FlagSet) (Config, error) {
+	cfg := Default()
+	ps := params(&cfg)
+
+	var flags map[string]string
+	if fs != nil {
+		flags = make(map[string]string)
+		fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+	}
+
+	var errs []error
+	path := os.Getenv("CONFIG_FILE")
+	if v, ok := flags[configFlag]; ok {
+		path = v
+	}
+	if path != "" {
+		if err := loadFile(path, ps); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, p := range ps {
+		if v := os.Getenv(p.env); v != "" {
+			if err := p.set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", p.env, err))
+			}
+		}
+	}
+
+	for _, p := range ps {
+		if v, ok := flags[p.flag]; ok {
+			if err := p.set(v); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", p.flag, err))
+			}
+		}
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// loadFile применяет файл конфигурации: JSON-объект с разделами, как в выводе Print.
+// Длительности и лимиты записываются строками ("30s", "300/1m"); неизвестные ключи — ошибка, чтобы опечатки не терялись молча.
+func loadFile(path string, ps []param) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("файл конфигурации: %w", err)
+	}
+
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("файл конфигурации %s: %w", path, err)
+	}
+
+	values := make(map[string]any)
+	flatten(doc, "", values)
+
+	var errs []error
+	for _, p := range ps {
+		v, ok := values[p.path]
+		if !ok {
+			continue
+		}
+		delete(values, p.path)
+
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		case bool:
+			s = strconv.FormatBool(v)
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s: ожидается строка, число или логическое значение", path, p.path))
+			continue
+		}
+		if err := p.set(s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, p.path, err))
+		}
+	}
+
+	unknown := make([]string, 0, len(values))
+	for key := range values {
+		unknown = append(unknown, key)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("%s: неизвестный параметр %s", path, key))
+	}
+	return errors.Join(errs...)
+}
+
+// flatten раскладывает вложенные объекты в ключи вида db.host
+func flatten(doc map[string]any, prefix string, out map[string]any) {
+	for key, v := range doc {
+		if nested, ok := v.(map[string]any); ok {
+			flatten(nested, prefix+key+".", out)
+			continue
+		}
+		out[prefix+key] = v
+	}
+}
+
+// Print выводит настройки в формате файла конфигурации, скрывая секреты
+func Print(w io.Writer, c Config) error {
+	doc := object{}
+	for _, p := range params(&c) {
+		doc = doc.set(strings.Split(p.path, "."), p.display())
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// object — JSON-объект, сохраняющий порядок ключей, чтобы вывод повторял порядок полей Config
+type object []member
+
+type member struct {
+	key   string
+	value any
+}
+
+// set записывает value по пути keys, создавая вложенные объекты
+func (o object) set(keys []string, value any) object {
+	if len(keys) == 1 {
+		return append(o, member{keys[0], value})
+	}
+	for i, m := range o {
+		if m.key == keys[0] {
+			o[i].value = m.value.(object).set(keys[1:], value)
+			return o
+		}
+	}
+	return append(o, member{keys[0], object{}.set(keys[1:], value)})
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,183 @@
+// Package export записывает таблицы в CSV, NDJSON и XLSX построчно, не накапливая строки в памяти.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Форматы выгрузки
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Writer пишет таблицу построчно. Значения ячеек — string, int, float64 или nil (пустая ячейка).
+type Writer interface {
+	// WriteRow записывает строку; значения идут в порядке колонок
+	WriteRow(values []any) error
+	// Flush передаёт накопленные данные в нижележащий io.Writer
+	Flush() error
+	// Close дописывает окончание файла; нижележащий io.Writer не закрывается
+	Close() error
+}
+
+// Options — параметры выгрузки
+type Options struct {
+	Columns []string // названия колонок: заголовок CSV и XLSX, ключи объектов NDJSON
+	Sheet   string   // название листа XLSX
+}
+
+// IsFormat сообщает, поддерживается ли формат
+func IsFormat(format string) bool {
+	switch format {
+	case FormatCSV, FormatNDJSON, FormatXLSX:
+		return true
+	}
+	return false
+}
+
+// ContentType возвращает MIME-тип формата
+func ContentType(format string) string {
+	switch format {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=UTF-8"
+}
+
+// NewWriter начинает выгрузку в формате format; заголовок пишется сразу
+func NewWriter(w io.Writer, format string, opts Options) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, opts.Columns)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, opts.Columns), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, opts)
+	}
+	return nil, fmt.Errorf("неизвестный формат выгрузки %q", format)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (c *csvWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			record[i] = escapeFormula(v)
+		case int:
+			record[i] = strconv.Itoa(v)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	return c.Flush()
+}
+
+// escapeFormula защищает от CSV-инъекций: строку, которую табличный редактор принял бы за формулу, предваряет апостроф
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	keys [][]byte // заранее закодированные ключи объекта
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) *ndjsonWriter {
+	keys := make([][]byte, len(columns))
+	for i, c := range columns {
+		keys[i], _ = json.Marshal(c)
+	}
+	return &ndjsonWriter{w: bufio.NewWriter(w), keys: keys}
+}
+
+// WriteRow пишет объект с ключами в порядке колонок
+func (n *ndjsonWriter) WriteRow(values []any) error {
+	n.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.w.Write(n.keys[i])
+		n.w.WriteByte(':')
+		n.w.Write(value)
+	}
+	n.w.WriteByte('}')
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
+
+// ParseDateFormat переводит формат даты из токенов YYYY, MM и DD (например DD.MM.YYYY) в раскладку time.Format.
+// Между токенами допускаются разделители - . / и пробел.
+func ParseDateFormat(format string) (string, error) {
+	var layout strings.Builder
+	for rest := format; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, "YYYY"):
+			layout.WriteString("2006")
+			rest = rest[4:]
+		case strings.HasPrefix(rest, "MM"):
+			layout.WriteString("01")
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "DD"):
+			layout.WriteString("02")
+			rest = rest[2:]
+		case strings.ContainsRune("-./ ", rune(rest[0])):
+			layout.WriteByte(rest[0])
+			rest = rest[1:]
+		default:
+			return "", fmt.Errorf("формат даты %q: допустимы YYYY, MM, DD и разделители - . / пробел", format)
+		}
+	}
+	if !strings.Contains(layout.String(), "2006") {
+		return "", fmt.Errorf("формат даты %q: должен содержать год YYYY", format)
+	}
+	return layout.String(), nil
+}
@@ -0,0 +1,247 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeTable записывает строки rows в формате format и возвращает файл целиком
+func writeTable(t *testing.T, format string, opts Options, rows ...[]any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, opts)
+	if err != nil {
+		t.Fatalf("NewWriter(%s): %v", format, err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+79990000000", "'+79990000000"},
+		{"-1+1", "'-1+1"},
+		{"@cmd", "'@cmd"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"netflix", "netflix"},
+		{"a=b", "a=b"},
+		{" =1", " =1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeFormula(tt.in); got != tt.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	data := writeTable(t, FormatCSV, Options{Columns: []string{"service_name", "price", "share", "end_date"}},
+		[]any{"=HYPERLINK(\"x\")", 400, 0.5, nil},
+		[]any{"yandex, плюс", -1, 2.0, "2024-12-31"},
+	)
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV не читается: %v\n%s", err, data)
+	}
+	want := [][]string{
+		{"service_name", "price", "share", "end_date"},
+		{"'=HYPERLINK(\"x\")", "400", "0.5", ""},
+		// числа не экранируются: минус у отрицательного числа — не формула
+		{"yandex, плюс", "-1", "2", "2024-12-31"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("строк %d, want %d: %q", len(records), len(want), records)
+	}
+	for i := range want {
+		if !slices.Equal(records[i], want[i]) {
+			t.Errorf("строка %d: %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	data := writeTable(t, FormatNDJSON, Options{Columns: []string{"user_id", "price", "amount", "end_date", "id"}},
+		[]any{"alice", 400, 133.33, nil, 1},
+		[]any{"=bob", 300, 300.0, "2024-12-31", 2},
+	)
+
+	// ключи идут в порядке колонок, а не по алфавиту, как у json.Marshal для map
+	want := `{"user_id":"alice","price":400,"amount":133.33,"end_date":null,"id":1}` + "\n" +
+		`{"user_id":"=bob","price":300,"amount":300,"end_date":"2024-12-31","id":2}` + "\n"
+	if string(data) != want {
+		t.Errorf("NDJSON:\n%s\nwant\n%s", data, want)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("строка не JSON: %s", line)
+		}
+	}
+}
+
+// xlsxCell — ячейка листа XLSX
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Ref   string     `xml:"r,attr"`
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestXLSXWriter(t *testing.T) {
+	columns := make([]string, 28)
+	for i := range columns {
+		columns[i] = "c" + columnName(i)
+	}
+	row := make([]any, 28)
+	row[0], row[1], row[2], row[27] = "<Netflix & Co>", 400, 0.25, "=1+1"
+	data := writeTable(t, FormatXLSX, Options{Columns: columns, Sheet: "Подписки: 2024/01 [все]"}, row)
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("XLSX не открывается как zip: %v", err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		parts[f.Name] = body
+
+		// каждая часть книги — корректный XML
+		dec := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: некорректный XML: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("в книге нет %s", name)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatalf("workbook.xml: %v", err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != "Подписки_ 2024_01 _все_" {
+		t.Errorf("листы %+v", workbook.Sheets)
+	}
+
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("sheet1.xml: %v", err)
+	}
+	if len(sheet.Rows) != 2 || sheet.Rows[0].Ref != "1" || sheet.Rows[1].Ref != "2" {
+		t.Fatalf("строки листа %+v", sheet.Rows)
+	}
+	header := sheet.Rows[0].Cells
+	if len(header) != 28 || header[0].Inline != "cA" || header[0].Style != "1" || header[27].Ref != "AB1" || header[27].Inline != "cAB" {
+		t.Errorf("заголовок %+v", header)
+	}
+	// пустые ячейки пропускаются, ссылки остальных сохраняют свои колонки
+	want := []xlsxCell{
+		{Ref: "A2", Type: "inlineStr", Inline: "<Netflix & Co>"},
+		{Ref: "B2", Value: "400"},
+		{Ref: "C2", Value: "0.25"},
+		// в XLSX строка остаётся текстом, поэтому формулу не нужно экранировать
+		{Ref: "AB2", Type: "inlineStr", Inline: "=1+1"},
+	}
+	if got := sheet.Rows[1].Cells; !slices.Equal(got, want) {
+		t.Errorf("строка данных %+v, want %+v", got, want)
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(io.Discard, "pdf", Options{}); err == nil {
+		t.Error("NewWriter(pdf) без ошибки")
+	}
+	for _, format := range []string{FormatCSV, FormatNDJSON, FormatXLSX} {
+		if !IsFormat(format) || ContentType(format) == "" {
+			t.Errorf("формат %s не поддерживается", format)
+		}
+	}
+	if IsFormat("xls") {
+		t.Error("IsFormat(xls) = true")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestParseDateFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: "YYYY-MM-DD", want: "2006-01-02"},
+		{format: "DD.MM.YYYY", want: "02.01.2006"},
+		{format: "MM/YYYY", want: "01/2006"},
+		{format: "YYYY MM", want: "2006 01"},
+		{format: "YYYY", want: "2006"},
+		{format: "DD.MM.YY", wantErr: true},
+		{format: "MM-DD", wantErr: true},
+		{format: "YYYY-MM-DDTHH", wantErr: true},
+		{format: "yyyy-mm-dd", wantErr: true},
+		{format: "YYYY_MM", wantErr: true},
+		{format: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDateFormat(tt.format)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDateFormat(%q) = %q без ошибки", tt.format, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDateFormat(%q) = %q, %v, want %q", tt.format, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// APIKeyRequest описывает создаваемый API-ключ
+type APIKeyRequest struct {
+	// Название, по которому ключ легко узнать в списке
+	Name string `json:"name" example:"billing-export"`
+	// Области доступа: subscriptions:read, subscriptions:write, cost:read, webhooks, admin
+	Scopes []string `json:"scopes" example:"subscriptions:read,cost:read"`
+	// Если задан, ключ даёт доступ только к данным этого пользователя
+	UserID string `json:"user_id,omitempty"`
+	// Срок действия в формате RFC 3339; без него ключ бессрочный
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2026-01-01T00:00:00Z"`
+}
+
+// APIKeyResponse возвращается при создании ключа. Сам ключ показывается только здесь.
+type APIKeyResponse struct {
+	Key    string      `json:"key" example:"sk_3fQ9x..."`
+	APIKey base.APIKey `json:"api_key"`
+}
+
+// HandlerCreateAPIKey создаёт API-ключ
+// @Summary Создать API-ключ
+// @Description Создаёт ключ для доступа сервисов без пользовательской сессии. Ключ передаётся в заголовке X-API-Key и возвращается только в этом ответе: в БД хранится лишь его хеш.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key body APIKeyRequest true "Параметры ключа"
+// @Success 201 {object} APIKeyResponse
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Требуется роль администратора"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при создании ключа"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /admin/api-keys [post]
+func HandlerCreateAPIKey(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		var reqData APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+			writeError(w, r, invalidJSON(err))
+			return
+		}
+		if err := validateAPIKeyRequest(reqData); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		key, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		apiKey, err := store.InsertAPIKey(r.Context(), base.APIKey{
+			Name:      reqData.Name,
+			Prefix:    key[:len(auth.APIKeyPrefix)+5],
+			Scopes:    reqData.Scopes,
+			UserID:    reqData.UserID,
+			ExpiresAt: reqData.ExpiresAt,
+		}, hash)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(APIKeyResponse{Key: key, APIKey: apiKey})
+	}
+}
+
+// HandlerGetAPIKeys возвращает список API-ключей
+// @Summary Список API-ключей
+// @Description Возвращает все ключи, включая отозванные и просроченные. Сами ключи не возвращаются.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} base.APIKey
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Требуется роль администратора"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении ключей"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /admin/api-keys [get]
+func HandlerGetAPIKeys(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		keys, err := store.SelectAPIKeys(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// HandlerRevokeAPIKey отзывает API-ключ
+// @Summary Отозвать API-ключ
+// @Description Отозванный ключ сразу перестаёт приниматься, но остаётся в списке
+// @Tags admin
+// @Produce json
+// @Param id path int true "ID ключа"
+// @Success 200 {object} map[string]interface{} "ID отозванного ключа"
+// @Failure 400 {object} Problem "Некорректный ID"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Требуется роль администратора"
+// @Failure 404 {object} Problem "Ключ не найден"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при отзыве ключа"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /admin/api-keys/{id} [delete]
+func HandlerRevokeAPIKey(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if err := store.RevokeAPIKey(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+	}
+}
+
+func validateAPIKeyRequest(reqData APIKeyRequest) error {
+	var fields []base.FieldError
+	if reqData.Name == "" {
+		fields = append(fields, base.FieldError{Field: "name", Message: "обязательное поле"})
+	}
+	if len(reqData.Scopes) == 0 {
+		fields = append(fields, base.FieldError{Field: "scopes", Message: "укажите хотя бы одну область доступа"})
+	}
+	for i, scope := range reqData.Scopes {
+		if !auth.IsScope(scope) {
+			fields = append(fields, base.FieldError{
+				Field:   fmt.Sprintf("scopes[%d]", i),
+				Message: "должна быть одной из: subscriptions:read, subscriptions:write, cost:read, webhooks, admin",
+			})
+		}
+	}
+	if reqData.ExpiresAt != nil && !reqData.ExpiresAt.After(time.Now()) {
+		fields = append(fields, base.FieldError{Field: "expires_at", Message: "должен быть в будущем"})
+	}
+
+	if len(fields) > 0 {
+		return base.NewValidationError(fields...)
+	}
+	return nil
+}
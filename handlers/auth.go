@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Authenticate проверяет bearer-токен (JWT) или заголовок X-API-Key и сохраняет вызывающего в контексте запроса.
+// Запросы без учётных данных или с недействительными учётными данными получают 401.
+// verifier может быть nil, если JWT не настроены и доступ возможен только по API-ключам.
+func Authenticate(verifier *auth.Verifier, keys base.SubscriptionStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+				principal, err := authenticateAPIKey(r.Context(), keys, apiKey)
+				if err != nil {
+					slog.WarnContext(r.Context(), "Отклонён API-ключ", "method", r.Method, "path", r.URL.Path, "error", err)
+					writeUnauthorized(w, r, "недействительный, отозванный или просроченный API-ключ")
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+				return
+			}
+
+			scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				writeUnauthorized(w, r, "требуется заголовок Authorization: Bearer <token> или X-API-Key")
+				return
+			}
+			if verifier == nil {
+				writeUnauthorized(w, r, "аутентификация по JWT не настроена, используйте X-API-Key")
+				return
+			}
+
+			principal, err := verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				slog.WarnContext(r.Context(), "Отклонён токен", "method", r.Method, "path", r.URL.Path, "error", err)
+				writeUnauthorized(w, r, "недействительный или просроченный токен")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// apiKeyTouchInterval — как часто обновлять время последнего использования ключа,
+// чтобы не писать в БД на каждый запрос
+const apiKeyTouchInterval = time.Minute
+
+// authenticateAPIKey ищет ключ по хешу и проверяет, что он не отозван и не просрочен
+func authenticateAPIKey(ctx context.Context, keys base.SubscriptionStore, apiKey string) (auth.Principal, error) {
+	key, err := keys.SelectAPIKeyByHash(ctx, auth.HashAPIKey(apiKey))
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	now := time.Now()
+	if !key.Active(now) {
+		return auth.Principal{}, fmt.Errorf("ключ %d отозван или просрочен", key.ID)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := keys.TouchAPIKey(ctx, key.ID, now); err != nil {
+			slog.WarnContext(ctx, "Не удалось обновить last_used_at API-ключа", "api_key_id", key.ID, "error", err)
+		}
+	}
+
+	return auth.Principal{UserID: key.UserID, Scopes: key.Scopes, APIKeyID: key.ID}, nil
+}
+
+// RequireScope пропускает API-ключи только с указанной областью доступа (или admin).
+// Пользователей с JWT не ограничивает: для них действуют проверки владения в обработчиках.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p, ok := auth.FromContext(r.Context()); !ok || !p.HasScope(scope) {
+				writeInsufficientScope(w, r, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AnonymousAdmin выдаёт каждому запросу права администратора.
+// Используется только при отключённой аутентификации (AUTH_DISABLED=true) для локальной разработки.
+func AnonymousAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.Principal{Roles: []string{auth.RoleAdmin}}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequireAdmin пропускает только вызывающих с ролью администратора.
+// API-ключу без области admin, как и на остальных маршрутах, отвечает insufficient_scope.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.FromContext(r.Context())
+		if ok && p.IsAdmin() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok && p.APIKeyID != 0 {
+			writeInsufficientScope(w, r, auth.ScopeAdmin)
+			return
+		}
+		writeError(w, r, &base.Error{Kind: base.ErrForbidden, Code: base.CodeForbidden, Message: "требуется роль администратора"})
+	})
+}
+
+// authorizeUser проверяет, что вызывающий может работать с данными пользователя userID
+func authorizeUser(r *http.Request, userID string) error {
+	if p, ok := auth.FromContext(r.Context()); ok && p.CanAccess(userID) {
+		return nil
+	}
+	return base.ErrAccessDenied
+}
+
+// targetUserID определяет, с чьими данными работает запрос. Без userID пользователь работает со своими данными,
+// а администратор и API-ключ без привязки к пользователю — с данными всех пользователей (пустой результат).
+func targetUserID(r *http.Request, userID string) (string, error) {
+	if userID != "" {
+		return userID, authorizeUser(r, userID)
+	}
+
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		return "", base.ErrAccessDenied
+	}
+	if p.CanAccessAll() {
+		return "", nil
+	}
+	return p.UserID, nil
+}
+
+// authorizeSubscription проверяет, что подписка id (в том числе удалённая) принадлежит вызывающему.
+// На чужую подписку возвращает ErrAccessDenied, как и на запросы с чужим user_id.
+func authorizeSubscription(store base.SubscriptionStore, r *http.Request, id string) error {
+	s, err := store.SelectSubscriptionByID(r.Context(), id, true)
+	if err != nil {
+		return err
+	}
+	return authorizeUser(r, s.UserID)
+}
+
+// writeUnauthorized отвечает 401 с указанием схемы аутентификации
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="subscriptions"`)
+	writeProblem(w, r, Problem{
+		Status: http.StatusUnauthorized,
+		Code:   codeUnauthorized,
+		Detail: detail,
+	})
+}
+
+// writeInsufficientScope отвечает 403, когда у API-ключа нет области доступа scope
+func writeInsufficientScope(w http.ResponseWriter, r *http.Request, scope string) {
+	writeProblem(w, r, Problem{
+		Status: http.StatusForbidden,
+		Code:   codeInsufficientScope,
+		Detail: "у API-ключа нет области доступа " + scope,
+	})
+}
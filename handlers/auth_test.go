@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// principalEcho отвечает 200 и запоминает вызывающего, сохранённого middleware
+type principalEcho struct {
+	principal auth.Principal
+	ok        bool
+}
+
+func (h *principalEcho) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.principal, h.ok = auth.FromContext(r.Context())
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	const secret = "test-secret"
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: secret})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	token := func(sub string, ttl time.Duration, key string) string {
+		claims := jwt.RegisteredClaims{Subject: sub, ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl))}
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "действующий токен", authorization: "Bearer " + token("alice", time.Hour, secret), wantStatus: http.StatusOK},
+		{name: "схема без учёта регистра", authorization: "bearer " + token("alice", time.Hour, secret), wantStatus: http.StatusOK},
+		{name: "без заголовка", wantStatus: http.StatusUnauthorized},
+		{name: "другая схема", authorization: "Basic YWxpY2U6cGFzcw==", wantStatus: http.StatusUnauthorized},
+		{name: "просроченный", authorization: "Bearer " + token("alice", -time.Minute, secret), wantStatus: http.StatusUnauthorized},
+		{name: "чужая подпись", authorization: "Bearer " + token("alice", time.Hour, "other-secret"), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &principalEcho{}
+			r := httptest.NewRequest(http.MethodGet, "/subscriptions/alice", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			Authenticate(verifier, base.NewMemoryStore())(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized {
+				if problemCode(t, w) != codeUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("ответ 401 без кода %s или WWW-Authenticate", codeUnauthorized)
+				}
+				return
+			}
+			if !next.ok || next.principal.UserID != "alice" {
+				t.Errorf("вызывающий %+v, %v, want alice", next.principal, next.ok)
+			}
+		})
+	}
+}
+
+// ownershipRouter регистрирует маршруты подписок и стоимости без аутентификации:
+// вызывающий заранее кладётся в контекст запроса
+func ownershipRouter(store base.SubscriptionStore) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/subscription/{id}", HandlerGetSubscriptionByID(store))
+	r.Put("/subscription/{id}", HandlerUpdateSubscription(store))
+	r.Delete("/subscription/{id}", HandlerDeleteSubscription(store))
+	r.Get("/subscription/{id}/prices", HandlerGetPriceHistory(store))
+	r.Get("/subscriptions/{user_id}", HandlerGetSubscriptionsByUserID(store))
+	r.Get("/cost/{user_id}", CostSummary(store))
+	return r
+}
+
+func TestOwnership(t *testing.T) {
+	store := base.NewMemoryStore()
+	bobSubscription, err := store.InsertSubscription(context.Background(), base.Subscription{
+		UserID: "bob", Service: "netflix", Price: 400, StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("InsertSubscription: %v", err)
+	}
+	router := ownershipRouter(store)
+	bobPath := "/subscription/" + strconv.Itoa(bobSubscription)
+	update := `{"user_id":"bob","service_name":"netflix","price":500,"start_date":"01-2024"}`
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{method: http.MethodGet, path: bobPath},
+		{method: http.MethodGet, path: bobPath + "/prices"},
+		{method: http.MethodPut, path: bobPath, body: update},
+		{method: http.MethodGet, path: "/subscriptions/bob"},
+		{method: http.MethodGet, path: "/cost/bob?start_date=01-2024&end_date=12-2024"},
+		// удаление идёт последним, чтобы не мешать остальным запросам администратора
+		{method: http.MethodDelete, path: bobPath},
+	}
+	callers := []struct {
+		name       string
+		principal  auth.Principal
+		wantStatus int
+	}{
+		{name: "другой пользователь", principal: auth.Principal{UserID: "alice"}, wantStatus: http.StatusForbidden},
+		{name: "ключ другого пользователя", principal: auth.Principal{UserID: "alice", APIKeyID: 7, Scopes: []string{auth.ScopeSubscriptionsWrite}}, wantStatus: http.StatusForbidden},
+		{name: "администратор", principal: auth.Principal{UserID: "alice", Roles: []string{auth.RoleAdmin}}, wantStatus: http.StatusOK},
+	}
+
+	for _, c := range callers {
+		t.Run(c.name, func(t *testing.T) {
+			for _, req := range requests {
+				r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+				r = r.WithContext(auth.WithPrincipal(r.Context(), c.principal))
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+
+				if w.Code != c.wantStatus {
+					t.Errorf("%s %s: status = %d, want %d: %s", req.method, req.path, w.Code, c.wantStatus, w.Body)
+					continue
+				}
+				if c.wantStatus == http.StatusForbidden && problemCode(t, w) != base.CodeForbidden {
+					t.Errorf("%s %s: код ошибки не %s", req.method, req.path, base.CodeForbidden)
+				}
+			}
+		})
+	}
+}
+
+func TestOwnershipReassign(t *testing.T) {
+	store := base.NewMemoryStore()
+	id, err := store.InsertSubscription(context.Background(), base.Subscription{
+		UserID: "alice", Service: "netflix", Price: 400, StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("InsertSubscription: %v", err)
+	}
+
+	// свою подписку нельзя передать другому пользователю
+	r := httptest.NewRequest(http.MethodPut, "/subscription/"+strconv.Itoa(id),
+		strings.NewReader(`{"user_id":"bob","service_name":"netflix","price":400,"start_date":"01-2024"}`))
+	r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{UserID: "alice"}))
+	w := httptest.NewRecorder()
+	ownershipRouter(store).ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+	s, err := store.SelectSubscriptionByID(context.Background(), strconv.Itoa(id), false)
+	if err != nil || s.UserID != "alice" {
+		t.Errorf("подписка после отказа: %+v, %v", s, err)
+	}
+}
+
+// scopeRouter повторяет группы маршрутов из main.go: чтение, запись и административные маршруты
+func scopeRouter(store base.SubscriptionStore, next http.Handler) http.Handler {
+	r := chi.NewRouter()
+	r.Use(Authenticate(nil, store))
+	read := r.With(RequireScope(auth.ScopeSubscriptionsRead))
+	write := r.With(RequireScope(auth.ScopeSubscriptionsWrite))
+	read.Method(http.MethodGet, "/subscription/{id}", next)
+	read.Method(http.MethodGet, "/subscriptions/{user_id}", next)
+	write.Method(http.MethodPost, "/subscription", next)
+	write.Method(http.MethodPut, "/subscription/{id}", next)
+	write.Method(http.MethodDelete, "/subscription/{id}", next)
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAdmin)
+		r.Method(http.MethodGet, "/admin/api-keys", next)
+		r.Method(http.MethodPost, "/admin/exchange-rates", next)
+	})
+	return r
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	ctx := context.Background()
+	store := base.NewMemoryStore()
+	newKey := func(key base.APIKey) string {
+		plain, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey: %v", err)
+		}
+		if _, err := store.InsertAPIKey(ctx, key, hash); err != nil {
+			t.Fatalf("InsertAPIKey: %v", err)
+		}
+		return plain
+	}
+	expired := time.Now().Add(-time.Minute)
+	reader := newKey(base.APIKey{Name: "reader", Scopes: []string{auth.ScopeSubscriptionsRead}})
+	admin := newKey(base.APIKey{Name: "admin", Scopes: []string{auth.ScopeAdmin}})
+	expiredKey := newKey(base.APIKey{Name: "expired", Scopes: []string{auth.ScopeAdmin}, ExpiresAt: &expired})
+	revokedKey := newKey(base.APIKey{Name: "revoked", Scopes: []string{auth.ScopeAdmin}})
+	keys, err := store.SelectAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("SelectAPIKeys: %v", err)
+	}
+	if err := store.RevokeAPIKey(ctx, strconv.Itoa(keys[len(keys)-1].ID)); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		key          string
+		method, path string
+		wantStatus   int
+		wantCode     string
+	}{
+		{name: "чтение подписки", key: reader, method: http.MethodGet, path: "/subscription/1", wantStatus: http.StatusOK},
+		{name: "чтение подписок пользователя", key: reader, method: http.MethodGet, path: "/subscriptions/alice", wantStatus: http.StatusOK},
+		{name: "создание без области записи", key: reader, method: http.MethodPost, path: "/subscription", wantStatus: http.StatusForbidden, wantCode: codeInsufficientScope},
+		{name: "изменение без области записи", key: reader, method: http.MethodPut, path: "/subscription/1", wantStatus: http.StatusForbidden, wantCode: codeInsufficientScope},
+		{name: "удаление без области записи", key: reader, method: http.MethodDelete, path: "/subscription/1", wantStatus: http.StatusForbidden, wantCode: codeInsufficientScope},
+		{name: "список ключей без области admin", key: reader, method: http.MethodGet, path: "/admin/api-keys", wantStatus: http.StatusForbidden, wantCode: codeInsufficientScope},
+		{name: "курсы валют без области admin", key: reader, method: http.MethodPost, path: "/admin/exchange-rates", wantStatus: http.StatusForbidden, wantCode: codeInsufficientScope},
+		{name: "admin пишет", key: admin, method: http.MethodPost, path: "/subscription", wantStatus: http.StatusOK},
+		{name: "admin на административном маршруте", key: admin, method: http.MethodGet, path: "/admin/api-keys", wantStatus: http.StatusOK},
+		{name: "просроченный ключ", key: expiredKey, method: http.MethodGet, path: "/subscription/1", wantStatus: http.StatusUnauthorized, wantCode: codeUnauthorized},
+		{name: "отозванный ключ", key: revokedKey, method: http.MethodGet, path: "/subscription/1", wantStatus: http.StatusUnauthorized, wantCode: codeUnauthorized},
+		{name: "неизвестный ключ", key: "sk_unknown", method: http.MethodGet, path: "/subscription/1", wantStatus: http.StatusUnauthorized, wantCode: codeUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &okHandler{}
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("X-API-Key", tt.key)
+			w := httptest.NewRecorder()
+			scopeRouter(store, next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode != "" && problemCode(t, w) != tt.wantCode {
+				t.Errorf("код ошибки не %s: %s", tt.wantCode, w.Body)
+			}
+			if reached := next.calls > 0; reached != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("обработчик вызван %d раз при статусе %d", next.calls, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIKeyLastUsed(t *testing.T) {
+	ctx := context.Background()
+	store := base.NewMemoryStore()
+	plain, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if _, err := store.InsertAPIKey(ctx, base.APIKey{Name: "reader", Scopes: []string{auth.ScopeSubscriptionsRead}}, hash); err != nil {
+		t.Fatalf("InsertAPIKey: %v", err)
+	}
+	lastUsed := func() *time.Time {
+		key, err := store.SelectAPIKeyByHash(ctx, hash)
+		if err != nil {
+			t.Fatalf("SelectAPIKeyByHash: %v", err)
+		}
+		return key.LastUsedAt
+	}
+	request := func() {
+		r := httptest.NewRequest(http.MethodGet, "/subscription/1", nil)
+		r.Header.Set("X-API-Key", plain)
+		w := httptest.NewRecorder()
+		scopeRouter(store, &okHandler{}).ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+	}
+
+	if lastUsed() != nil {
+		t.Fatal("новый ключ уже использовался")
+	}
+	request()
+	first := lastUsed()
+	if first == nil {
+		t.Fatal("last_used_at не обновлён после запроса")
+	}
+	// повторный запрос в пределах apiKeyTouchInterval не пишет в хранилище
+	request()
+	if second := lastUsed(); second == nil || !second.Equal(*first) {
+		t.Errorf("last_used_at = %v, want %v", second, first)
+	}
+}
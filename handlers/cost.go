@@ -1,10 +1,13 @@
 package handlers
 
 import (
-	"database/sql"
 	"effective_mobile/base"
+	"effective_mobile/metrics"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -26,66 +29,166 @@ type CostRequest struct {
 type CostResponse struct {
 	// Общая сумма стоимости подписок
 	Total int `json:"total" example:"1500"`
+	// Валюта, в которой посчитан итог
+	Currency string `json:"currency" example:"RUB"`
+	// Помесячная разбивка (только при breakdown=monthly)
+	Months []base.MonthCost `json:"months,omitempty"`
+	// Месяцы, для которых не нашлось курса валюты; их стоимость не вошла в итог
+	MissingRates []base.MissingRate `json:"missing_rates,omitempty"`
 }
 
+// maxBreakdownMonths ограничивает размер помесячной разбивки, чтобы не строить ответ на тысячи месяцев
+const maxBreakdownMonths = 1200
+
 // CostSummary возвращает суммарную стоимость подписок за период для пользователя
 // @Summary Суммарная стоимость подписок
-// @Description Возвращает сумму подписок пользователя за указанный период с возможностью фильтрации по названию сервиса
+// @Description Возвращает сумму подписок пользователя за указанный период с возможностью фильтрации по названию сервиса.
+// @Description Помесячные подписки оплачиваются за каждый месяц периода, остальные — в даты списания (от даты начала подписки), попавшие в период.
 // @Tags cost
 // @Produce json
 // @Param user_id path string true "ID пользователя"
-// @Param start query string true "Дата начала (формат YYYY-MM)"
-// @Param end query string true "Дата окончания (формат YYYY-MM)"
+// @Param start_date query string true "Дата начала (формат MM-YYYY или DD-MM-YYYY)"
+// @Param end_date query string true "Дата окончания (формат MM-YYYY — включая весь месяц, или DD-MM-YYYY)"
 // @Param service_name query string false "Название сервиса (опционально)"
+// @Param currency query string false "Валюта отчёта (ISO 4217), по умолчанию RUB"
+// @Param proration query string false "daily — неполные месяцы считаются пропорционально активным дням; по умолчанию месяц оплачивается целиком" Enums(none, daily)
+// @Param breakdown query string false "monthly — добавить помесячную разбивку с подписками" Enums(monthly)
+// @Param include_deleted query bool false "Учитывать мягко удалённые подписки"
 // @Success 200 {object} CostResponse "Общий итог по подпискам"
-// @Failure 400 {object} map[string]string "Ошибки валидации параметров запроса"
-// @Failure 500 {object} map[string]string "Ошибка сервера при подсчёте стоимости"
+// @Failure 400 {object} Problem "Ошибки валидации параметров запроса"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при подсчёте стоимости"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /cost/{user_id} [get]
-func CostSummary(db *sql.DB) http.HandlerFunc {
+func CostSummary(store base.SubscriptionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := chi.URLParam(r, "user_id")
 		if userID == "" {
-			http.Error(w, `{"error": "Не указан user_id в URL"}`, http.StatusBadRequest)
+			writeError(w, r, base.InvalidField("user_id", "не указан user_id в URL"))
 			return
 		}
-
-		// Читаем query параметры
-		service := r.URL.Query().Get("service_name")
-		startStr := r.URL.Query().Get("start_date")
-		endStr := r.URL.Query().Get("end_date")
-
-		if startStr == "" || endStr == "" {
-			http.Error(w, `{"error": "start_date и end_date обязательны. Формат: MM-YYYY"}`, http.StatusBadRequest)
+		if err := authorizeUser(r, userID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
-		startDate, err := time.Parse("01-2006", startStr)
+		filter, err := parseCostFilter(r.URL.Query())
 		if err != nil {
-			http.Error(w, `{"error": "Неверный формат start_date. Используйте MM-YYYY"}`, http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
-		endDate, err := time.Parse("01-2006", endStr)
-		if err != nil {
-			http.Error(w, `{"error": "Неверный формат end_date. Используйте MM-YYYY"}`, http.StatusBadRequest)
-			return
-		}
-
-		// Собираем фильтр
-		filter := base.CostFilter{
-			UserID:      userID,
-			ServiceName: service,
-			StartDate:   startDate,
-			EndDate:     endDate,
-		}
+		filter.UserID = userID
 
 		// Запрашиваем сумму
-		total, err := base.CountSubscriptionsCost(db, filter)
+		report, err := store.CountSubscriptionsCost(r.Context(), filter)
 		if err != nil {
-			http.Error(w, `{"error": "Ошибка при обращении к базе данных"}`, http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
+		countCostCalculation(filter)
 
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		json.NewEncoder(w).Encode(CostResponse{Total: total})
+		json.NewEncoder(w).Encode(CostResponse{
+			Total:        report.Total,
+			Currency:     report.Currency,
+			Months:       report.Months,
+			MissingRates: report.MissingRates,
+		})
+	}
+}
+
+// parseCostFilter разбирает параметры подсчёта стоимости: период, сервис, валюту, разбивку и пропорциональный расчёт
+func parseCostFilter(q url.Values) (base.CostFilter, error) {
+	service := q.Get("service_name")
+	startStr := q.Get("start_date")
+	endStr := q.Get("end_date")
+
+	if startStr == "" || endStr == "" {
+		return base.CostFilter{}, base.NewValidationError(
+			base.FieldError{Field: "start_date", Message: "обязательный параметр в формате MM-YYYY или DD-MM-YYYY"},
+			base.FieldError{Field: "end_date", Message: "обязательный параметр в формате MM-YYYY или DD-MM-YYYY"},
+		)
+	}
+
+	// end_date в формате MM-YYYY включает весь месяц
+	startDate, err := parseStartDate(startStr)
+	if err != nil {
+		return base.CostFilter{}, base.InvalidField("start_date", "используйте формат MM-YYYY или DD-MM-YYYY")
+	}
+	endDate, err := parseEndDate(endStr)
+	if err != nil {
+		return base.CostFilter{}, base.InvalidField("end_date", "используйте формат MM-YYYY или DD-MM-YYYY")
+	}
+
+	currency := strings.ToUpper(q.Get("currency"))
+	if currency == "" {
+		currency = base.DefaultCurrency
+	}
+	if !base.IsCurrencyCode(currency) {
+		return base.CostFilter{}, base.InvalidField("currency", "ожидается код ISO 4217, например RUB или USD")
+	}
+
+	var breakdown bool
+	switch q.Get("breakdown") {
+	case "":
+	case "monthly":
+		breakdown = true
+	default:
+		return base.CostFilter{}, base.InvalidField("breakdown", "поддерживается только значение monthly")
+	}
+	if breakdown {
+		if err := checkBreakdownPeriod(startDate, endDate); err != nil {
+			return base.CostFilter{}, err
+		}
+	}
+
+	var prorate bool
+	switch q.Get("proration") {
+	case "", "none":
+	case "daily":
+		prorate = true
+	default:
+		return base.CostFilter{}, base.InvalidField("proration", "поддерживаются значения none и daily")
+	}
+
+	includeDeleted, err := parseIncludeDeleted(q)
+	if err != nil {
+		return base.CostFilter{}, err
+	}
+
+	return base.CostFilter{
+		ServiceName:    service,
+		StartDate:      startDate,
+		EndDate:        endDate,
+		Breakdown:      breakdown,
+		Currency:       currency,
+		Prorate:        prorate,
+		IncludeDeleted: includeDeleted,
+	}, nil
+}
+
+// checkBreakdownPeriod ограничивает период помесячной разбивки
+func checkBreakdownPeriod(start, end time.Time) error {
+	if end.Before(start) || base.CountMonths(start, end) > maxBreakdownMonths {
+		return base.InvalidField("end_date", fmt.Sprintf("для помесячной разбивки должна быть не раньше start_date, а период — не длиннее %d месяцев", maxBreakdownMonths))
+	}
+	return nil
+}
+
+// countCostCalculation учитывает подсчёт стоимости в метриках по типу фильтра
+func countCostCalculation(filter base.CostFilter) {
+	serviceFilter, breakdown, proration := "all", "none", "none"
+	if filter.ServiceName != "" {
+		serviceFilter = "service"
+	}
+	if filter.Breakdown {
+		breakdown = "monthly"
+	}
+	if filter.Prorate {
+		proration = "daily"
 	}
+	metrics.CostCalculations.WithLabelValues(serviceFilter, breakdown, proration).Inc()
 }
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerRestoreSubscription восстанавливает мягко удалённую подписку
+// @Summary Восстановить подписку
+// @Description Снимает пометку об удалении. Восстановление неудалённой подписки ничего не меняет.
+// @Tags subscriptions
+// @Produce json
+// @Param id path int true "ID подписки"
+// @Success 200 {object} base.Subscription
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 404 {object} Problem "Подписка не найдена или уже очищена"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при восстановлении подписки"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Подписка принадлежит другому пользователю"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscription/{id}/restore [post]
+func HandlerRestoreSubscription(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if err := authorizeSubscription(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if err := store.RestoreSubscription(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		sub, err := store.SelectSubscriptionByID(r.Context(), id, false)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+// HandlerGetDeletionHistory возвращает историю удалений подписки
+// @Summary История удалений подписки
+// @Description Возвращает все мягкие удаления подписки и время восстановления после каждого из них
+// @Tags subscriptions
+// @Produce json
+// @Param id path int true "ID подписки"
+// @Success 200 {array} base.DeletionRecord
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 404 {object} Problem "Подписка не найдена"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении истории"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Подписка принадлежит другому пользователю"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscription/{id}/deletions [get]
+func HandlerGetDeletionHistory(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if err := authorizeSubscription(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		history, err := store.SelectDeletionHistory(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(history)
+	}
+}
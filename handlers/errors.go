@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Коды ошибок уровня HTTP; коды предметной области объявлены в base
+const (
+	codeUnauthorized         = "unauthorized"
+	codeInsufficientScope    = "insufficient_scope"
+	codeRouteNotFound        = "route_not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeRateLimited          = "rate_limited"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codePayloadTooLarge      = "payload_too_large"
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+	codeIdempotencyInFlight  = "idempotency_key_in_progress"
+	codeInternalError        = "internal_error"
+)
+
+// Problem — тело ошибки в формате RFC 7807 (application/problem+json).
+// Поле code стабильно, и клиентам следует опираться на него, а не на текст detail.
+type Problem struct {
+	Type     string            `json:"type" example:"about:blank"`
+	Title    string            `json:"title" example:"Not Found"`
+	Status   int               `json:"status" example:"404"`
+	Detail   string            `json:"detail,omitempty" example:"подписка не найдена"`
+	Instance string            `json:"instance,omitempty" example:"/subscription/42"`
+	Code     string            `json:"code" example:"subscription_not_found"`
+	Errors   []base.FieldError `json:"errors,omitempty"`
+}
+
+// writeError сопоставляет ошибку со статусом HTTP и отправляет её как application/problem+json.
+// Ошибки, не относящиеся к предметной области, логируются и отдаются клиенту без подробностей.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var domainErr *base.Error
+	if !errors.As(err, &domainErr) {
+		slog.ErrorContext(r.Context(), "Ошибка обработки запроса", "method", r.Method, "path", r.URL.Path, "error", err)
+		writeProblem(w, r, Problem{
+			Status: http.StatusInternalServerError,
+			Code:   codeInternalError,
+			Detail: "внутренняя ошибка сервера",
+		})
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, base.ErrValidation):
+		status = http.StatusBadRequest
+	case errors.Is(err, base.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, base.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, base.ErrConflict):
+		status = http.StatusConflict
+	}
+
+	writeProblem(w, r, Problem{
+		Status: status,
+		Code:   domainErr.Code,
+		Detail: domainErr.Message,
+		Errors: domainErr.Fields,
+	})
+}
+
+// writeProblem дополняет Problem стандартными полями и отправляет его
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", "application/problem+json; charset=UTF-8")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeMethodNotAllowed отвечает 405 для неподдерживаемого метода
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, Problem{
+		Status: http.StatusMethodNotAllowed,
+		Code:   codeMethodNotAllowed,
+		Detail: "метод не разрешён",
+	})
+}
+
+// HandlerNotFound отвечает на запросы к несуществующим маршрутам в том же формате, что и остальные ошибки
+func HandlerNotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, Problem{
+		Status: http.StatusNotFound,
+		Code:   codeRouteNotFound,
+		Detail: "маршрут не найден",
+	})
+}
+
+// HandlerMethodNotAllowed отвечает на запросы с методом, который маршрут не поддерживает
+func HandlerMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeMethodNotAllowed(w, r)
+}
+
+// invalidJSON — ошибка разбора тела запроса
+func invalidJSON(err error) error {
+	return &base.Error{Kind: base.ErrValidation, Code: base.CodeInvalidJSON, Message: "ошибка десериализации JSON: " + err.Error()}
+}
+
+// subscriptionID читает ID подписки из URL и проверяет, что это положительное число
+func subscriptionID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		return 0, base.InvalidField("id", "ожидается положительное целое число")
+	}
+	return id, nil
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantFields int
+	}{
+		{name: "валидация", err: base.InvalidField("price", "должна быть положительной"), wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed, wantFields: 1},
+		{name: "не найдено", err: base.ErrSubscriptionNotFound, wantStatus: http.StatusNotFound, wantCode: base.CodeSubscriptionNotFound},
+		{name: "обёрнутая", err: fmt.Errorf("обновление: %w", base.ErrSubscriptionDeleted), wantStatus: http.StatusConflict, wantCode: base.CodeSubscriptionDeleted},
+		{name: "нет доступа", err: base.ErrAccessDenied, wantStatus: http.StatusForbidden, wantCode: base.CodeForbidden},
+		{name: "не доменная", err: errors.New("pq: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: codeInternalError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest(http.MethodGet, "/subscription/42", nil), tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			body := w.Body.String()
+			var p Problem
+			if err := json.Unmarshal([]byte(body), &p); err != nil {
+				t.Fatalf("тело ответа: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Status != tt.wantStatus || p.Instance != "/subscription/42" || p.Title != http.StatusText(tt.wantStatus) {
+				t.Errorf("problem = %+v", p)
+			}
+			if len(p.Errors) != tt.wantFields {
+				t.Errorf("errors = %+v, want %d", p.Errors, tt.wantFields)
+			}
+			// внутренние ошибки не раскрываются клиенту
+			if strings.Contains(body, "pq:") {
+				t.Errorf("в ответе текст внутренней ошибки: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"effective_mobile/export"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// exportFlushRows — через сколько строк выгрузка сбрасывается клиенту
+	exportFlushRows = 500
+	// exportWriteTimeout — сколько ждать записи очередной порции строк; дедлайн сдвигается после каждой порции,
+	// поэтому длинная выгрузка не упирается в общий HTTP_WRITE_TIMEOUT сервера
+	exportWriteTimeout = 30 * time.Second
+	// defaultExportDateFormat — формат дат по умолчанию, его понимают табличные редакторы
+	defaultExportDateFormat = "YYYY-MM-DD"
+)
+
+// exportColumn — колонка выгрузки и способ получить её значение из строки T
+type exportColumn[T any] struct {
+	name  string
+	value func(row T, dateLayout string) any
+}
+
+// subscriptionExportColumns — колонки выгрузки подписок; deleted_at выгружается только по запросу
+var subscriptionExportColumns = []exportColumn[base.Subscription]{
+	{"id", func(s base.Subscription, _ string) any { return s.ID }},
+	{"user_id", func(s base.Subscription, _ string) any { return s.UserID }},
+	{"service_name", func(s base.Subscription, _ string) any { return s.Service }},
+	{"price", func(s base.Subscription, _ string) any { return s.Price }},
+	{"currency", func(s base.Subscription, _ string) any { return s.Currency }},
+	{"billing_period", func(s base.Subscription, _ string) any { return s.BillingPeriod }},
+	{"monthly_price", func(s base.Subscription, _ string) any { return s.MonthlyPrice }},
+	{"start_date", func(s base.Subscription, layout string) any { return s.StartDate.Format(layout) }},
+	{"end_date", func(s base.Subscription, layout string) any {
+		// бессрочная подписка хранится с концом 9999-12-31
+		if s.EndDate.Year() == 9999 {
+			return nil
+		}
+		return s.EndDate.Format(layout)
+	}},
+	{"deleted_at", func(s base.Subscription, layout string) any {
+		if s.DeletedAt == nil {
+			return nil
+		}
+		return s.DeletedAt.Format(layout)
+	}},
+}
+
+// costExportRow — вклад одной подписки в стоимость одного месяца
+type costExportRow struct {
+	month    time.Time
+	currency string // валюта отчёта
+	item     base.MonthCostItem
+}
+
+// costExportColumns — колонки выгрузки помесячной стоимости
+var costExportColumns = []exportColumn[costExportRow]{
+	{"month", func(c costExportRow, layout string) any { return c.month.Format(layout) }},
+	{"subscription_id", func(c costExportRow, _ string) any { return c.item.SubscriptionID }},
+	{"service_name", func(c costExportRow, _ string) any { return c.item.Service }},
+	{"price", func(c costExportRow, _ string) any { return c.item.Price }},
+	{"currency", func(c costExportRow, _ string) any { return c.item.Currency }},
+	{"amount", func(c costExportRow, _ string) any { return c.item.Amount }},
+	{"report_currency", func(c costExportRow, _ string) any { return c.currency }},
+}
+
+// exportOptions — общие параметры выгрузок
+type exportOptions[T any] struct {
+	format     string
+	columns    []exportColumn[T]
+	dateLayout string
+}
+
+// HandlerExportSubscriptions выгружает подписки в CSV, NDJSON или XLSX
+// @Summary Выгрузка подписок
+// @Description Строки читаются из БД курсором и сразу отправляются клиенту, поэтому размер выгрузки не ограничен памятью сервиса.
+// @Description Фильтры и сортировка — как у GET /subscriptions/{user_id}, limit и cursor не учитываются.
+// @Description Без user_id выгружаются подписки всех пользователей (роль admin или API-ключ без привязки к пользователю), а для пользователя — его собственные.
+// @Tags export
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param user_id query string false "ID пользователя"
+// @Param format query string false "csv (по умолчанию), ndjson или xlsx" Enums(csv, ndjson, xlsx)
+// @Param columns query string false "Колонки через запятую: id, user_id, service_name, price, currency, billing_period, monthly_price, start_date, end_date, deleted_at; по умолчанию все, кроме deleted_at"
+// @Param date_format query string false "Формат дат из YYYY, MM, DD и разделителей, по умолчанию YYYY-MM-DD"
+// @Param service_name query string false "Названия сервисов через запятую"
+// @Param min_price query int false "Цена не меньше"
+// @Param max_price query int false "Цена не больше"
+// @Param active_at query string false "Подписка активна на дату (MM-YYYY или DD-MM-YYYY)"
+// @Param sort query string false "Поле сортировки" Enums(id, price, start_date, service_name)
+// @Param order query string false "Направление сортировки" Enums(asc, desc)
+// @Param include_deleted query bool false "Выгружать и мягко удалённые подписки"
+// @Success 200 {file} file "Файл выгрузки"
+// @Failure 400 {object} Problem "Некорректные параметры"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при выгрузке"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /export/subscriptions [get]
+func HandlerExportSubscriptions(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		q := r.URL.Query()
+		opts, err := parseExportOptions(q, subscriptionExportColumns, "deleted_at")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		filter, err := parseSubscriptionFilter(q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if filter.UserID, err = targetUserID(r, r.URL.Query().Get("user_id")); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		out := newExportStream(w, r, opts, "subscriptions", "Подписки")
+		err = store.StreamSubscriptions(r.Context(), filter, out.write)
+		out.finish(err)
+	}
+}
+
+// HandlerExportCost выгружает помесячную стоимость подписок в CSV, NDJSON или XLSX
+// @Summary Выгрузка помесячной стоимости
+// @Description По строке на каждую подписку в каждом месяце периода с ценой в валюте подписки и суммой в валюте отчёта.
+// @Description Параметры периода, сервиса, валюты и пропорционального расчёта — как у GET /cost/{user_id}.
+// @Description Без user_id считается стоимость подписок всех пользователей (роль admin или API-ключ без привязки к пользователю), а для пользователя — его собственных.
+// @Tags export
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param user_id query string false "ID пользователя"
+// @Param start_date query string true "Дата начала (формат MM-YYYY или DD-MM-YYYY)"
+// @Param end_date query string true "Дата окончания (формат MM-YYYY — включая весь месяц, или DD-MM-YYYY)"
+// @Param service_name query string false "Название сервиса"
+// @Param currency query string false "Валюта отчёта (ISO 4217), по умолчанию RUB"
+// @Param proration query string false "daily — неполные месяцы пропорционально активным дням" Enums(none, daily)
+// @Param include_deleted query bool false "Учитывать мягко удалённые подписки"
+// @Param format query string false "csv (по умолчанию), ndjson или xlsx" Enums(csv, ndjson, xlsx)
+// @Param columns query string false "Колонки через запятую: month, subscription_id, service_name, price, currency, amount, report_currency"
+// @Param date_format query string false "Формат месяца из YYYY, MM, DD и разделителей, по умолчанию YYYY-MM-DD"
+// @Success 200 {file} file "Файл выгрузки"
+// @Failure 400 {object} Problem "Некорректные параметры"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при выгрузке"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /export/cost [get]
+func HandlerExportCost(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		q := r.URL.Query()
+		opts, err := parseExportOptions(q, costExportColumns)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		filter, err := parseCostFilter(q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := checkBreakdownPeriod(filter.StartDate, filter.EndDate); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		filter.Breakdown = true
+		if filter.UserID, err = targetUserID(r, r.URL.Query().Get("user_id")); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// разбивка ограничена maxBreakdownMonths, поэтому отчёт помещается в память; строки из него пишутся потоком
+		report, err := store.CountSubscriptionsCost(r.Context(), filter)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		countCostCalculation(filter)
+
+		out := newExportStream(w, r, opts, "cost", "Стоимость")
+		for _, m := range report.Months {
+			month, _ := time.Parse("01-2006", m.Month)
+			for _, item := range m.Subscriptions {
+				if err = out.write(costExportRow{month: month, currency: report.Currency, item: item}); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		out.finish(err)
+	}
+}
+
+// parseExportOptions разбирает format, columns и date_format; без columns выгружаются все колонки, кроме hidden
+func parseExportOptions[T any](q url.Values, all []exportColumn[T], hidden ...string) (exportOptions[T], error) {
+	opts := exportOptions[T]{format: export.FormatCSV}
+	if v := q.Get("format"); v != "" {
+		if !export.IsFormat(v) {
+			return opts, base.InvalidField("format", "ожидается csv, ndjson или xlsx")
+		}
+		opts.format = v
+	}
+
+	dateFormat := q.Get("date_format")
+	if dateFormat == "" {
+		dateFormat = defaultExportDateFormat
+	}
+	layout, err := export.ParseDateFormat(dateFormat)
+	if err != nil {
+		return opts, base.InvalidField("date_format", "допустимы YYYY, MM, DD и разделители - . / пробел, например DD.MM.YYYY")
+	}
+	opts.dateLayout = layout
+
+	if q.Get("columns") == "" {
+		for _, c := range all {
+			if !containsName(hidden, c.name) {
+				opts.columns = append(opts.columns, c)
+			}
+		}
+		return opts, nil
+	}
+
+	names := make([]string, 0, len(all))
+	for _, c := range all {
+		names = append(names, c.name)
+	}
+	for _, name := range strings.Split(q.Get("columns"), ",") {
+		name = strings.TrimSpace(name)
+		i := indexOfName(names, name)
+		if i < 0 {
+			return opts, base.InvalidField("columns", fmt.Sprintf("неизвестная колонка %q, доступны: %s", name, strings.Join(names, ", ")))
+		}
+		opts.columns = append(opts.columns, all[i])
+	}
+	return opts, nil
+}
+
+func containsName(names []string, name string) bool {
+	return indexOfName(names, name) >= 0
+}
+
+func indexOfName(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// exportStream пишет строки выгрузки в ответ. Заголовки ответа отправляются с первой строкой,
+// поэтому ошибка до неё ещё возвращается клиенту как problem+json.
+type exportStream[T any] struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	rc      *http.ResponseController
+	opts    exportOptions[T]
+	name    string // начало имени файла
+	sheet   string
+	out     export.Writer
+	rows    int
+	values  []any
+	started time.Time
+}
+
+func newExportStream[T any](w http.ResponseWriter, r *http.Request, opts exportOptions[T], name, sheet string) *exportStream[T] {
+	return &exportStream[T]{
+		w:       w,
+		r:       r,
+		rc:      http.NewResponseController(w),
+		opts:    opts,
+		name:    name,
+		sheet:   sheet,
+		values:  make([]any, len(opts.columns)),
+		started: time.Now(),
+	}
+}
+
+// start отправляет заголовки ответа и заголовок таблицы
+func (s *exportStream[T]) start() error {
+	columns := make([]string, len(s.opts.columns))
+	for i, c := range s.opts.columns {
+		columns[i] = c.name
+	}
+
+	h := s.w.Header()
+	h.Set("Content-Type", export.ContentType(s.opts.format))
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, s.name, time.Now().Format("20060102"), s.opts.format))
+	h.Set("Cache-Control", "no-store")
+	s.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	out, err := export.NewWriter(s.w, s.opts.format, export.Options{Columns: columns, Sheet: s.sheet})
+	if err != nil {
+		return err
+	}
+	s.out = out
+	return nil
+}
+
+// write добавляет строку и периодически сбрасывает выгрузку клиенту
+func (s *exportStream[T]) write(row T) error {
+	if s.out == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	for i, c := range s.opts.columns {
+		s.values[i] = c.value(row, s.opts.dateLayout)
+	}
+	if err := s.out.WriteRow(s.values); err != nil {
+		return err
+	}
+	s.rows++
+
+	if s.rows%exportFlushRows == 0 {
+		if err := s.out.Flush(); err != nil {
+			return err
+		}
+		// ошибки игнорируются: обёртка ответа может не поддерживать сброс и дедлайны
+		s.rc.Flush()
+		s.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	}
+	return nil
+}
+
+// finish завершает выгрузку. Если ошибка случилась до первой строки, клиент получает problem+json,
+// а после — соединение обрывается, чтобы клиент не принял обрезанный файл за целый.
+func (s *exportStream[T]) finish(err error) {
+	if err == nil && s.out == nil {
+		// пустая выгрузка — только заголовок таблицы
+		err = s.start()
+	}
+	if err == nil {
+		err = s.out.Close()
+	}
+
+	if err != nil && s.out == nil {
+		writeError(s.w, s.r, err)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(s.r.Context(), "Выгрузка прервана", "export", s.name, "rows", s.rows, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	slog.InfoContext(s.r.Context(), "Выгрузка завершена", "export", s.name, "format", s.opts.format,
+		"rows", s.rows, "duration_ms", time.Since(s.started).Milliseconds())
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exportStore возвращает хранилище с двумя подписками alice и одной bob
+func exportStore(t *testing.T) base.SubscriptionStore {
+	t.Helper()
+	store := base.NewMemoryStore()
+	for _, s := range []base.Subscription{
+		{UserID: "alice", Service: "netflix", Price: 400, StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{UserID: "alice", Service: "=cmd", Price: 300, StartDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			EndDate: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{UserID: "bob", Service: "spotify", Price: 200, StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)},
+	} {
+		if _, err := store.InsertSubscription(context.Background(), s); err != nil {
+			t.Fatalf("InsertSubscription: %v", err)
+		}
+	}
+	return store
+}
+
+// exportRequest вызывает обработчик выгрузки от имени principal
+func exportRequest(h http.HandlerFunc, principal auth.Principal, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r = r.WithContext(auth.WithPrincipal(r.Context(), principal))
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func readCSV(t *testing.T, w *httptest.ResponseRecorder) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV: %v", err)
+	}
+	return records
+}
+
+func TestExportSubscriptions(t *testing.T) {
+	store := exportStore(t)
+	alice := auth.Principal{UserID: "alice"}
+	admin := auth.Principal{UserID: "root", Roles: []string{auth.RoleAdmin}}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		query     string
+		want      [][]string
+	}{
+		{
+			name:      "колонки по умолчанию без deleted_at",
+			principal: alice,
+			query:     "sort=price",
+			want: [][]string{
+				{"id", "user_id", "service_name", "price", "currency", "billing_period", "monthly_price", "start_date", "end_date"},
+				{"2", "alice", "'=cmd", "300", "RUB", "monthly", "300", "2024-02-01", "2024-03-31"},
+				{"1", "alice", "netflix", "400", "RUB", "monthly", "400", "2024-01-01", ""},
+			},
+		},
+		{
+			name:      "выбранные колонки в заданном порядке и формат даты",
+			principal: alice,
+			query:     "columns=start_date,%20service_name,deleted_at&date_format=DD.MM.YYYY",
+			want: [][]string{
+				{"start_date", "service_name", "deleted_at"},
+				{"01.01.2024", "netflix", ""},
+				{"01.02.2024", "'=cmd", ""},
+			},
+		},
+		{
+			name:      "администратор без user_id получает всех",
+			principal: admin,
+			query:     "columns=user_id,service_name",
+			want:      [][]string{{"user_id", "service_name"}, {"alice", "netflix"}, {"alice", "'=cmd"}, {"bob", "spotify"}},
+		},
+		{
+			name:      "фильтр без совпадений — только заголовок",
+			principal: alice,
+			query:     "columns=id&service_name=yandex",
+			want:      [][]string{{"id"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := exportRequest(HandlerExportSubscriptions(store), tt.principal, "/export/subscriptions?"+tt.query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=UTF-8" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="subscriptions-`) || !strings.HasSuffix(cd, `.csv"`) {
+				t.Errorf("Content-Disposition = %q", cd)
+			}
+
+			got := readCSV(t, w)
+			if len(got) != len(tt.want) {
+				t.Fatalf("выгрузка %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if !slices.Equal(got[i], tt.want[i]) {
+					t.Errorf("строка %d: %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	store := exportStore(t)
+	alice := auth.Principal{UserID: "alice"}
+
+	w := exportRequest(HandlerExportSubscriptions(store), alice, "/export/subscriptions?format=ndjson&columns=id,service_name,end_date")
+	want := `{"id":1,"service_name":"netflix","end_date":null}` + "\n" + `{"id":2,"service_name":"=cmd","end_date":"2024-03-31"}` + "\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("NDJSON: %d\n%s\nwant\n%s", w.Code, w.Body, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type NDJSON = %q", ct)
+	}
+
+	w = exportRequest(HandlerExportSubscriptions(store), alice, "/export/subscriptions?format=xlsx")
+	if w.Code != http.StatusOK {
+		t.Fatalf("XLSX: status = %d: %s", w.Code, w.Body)
+	}
+	data := w.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("XLSX не открывается как zip: %v", err)
+	}
+	if len(archive.File) == 0 || archive.File[len(archive.File)-1].Name != "xl/worksheets/sheet1.xml" {
+		t.Errorf("части книги: %d, последняя не лист", len(archive.File))
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasSuffix(cd, `.xlsx"`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	store := exportStore(t)
+	alice := auth.Principal{UserID: "alice"}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "неизвестный формат", handler: HandlerExportSubscriptions(store), target: "/export/subscriptions?format=pdf",
+			wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed},
+		{name: "неизвестная колонка", handler: HandlerExportSubscriptions(store), target: "/export/subscriptions?columns=id,password",
+			wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed},
+		{name: "некорректный формат даты", handler: HandlerExportSubscriptions(store), target: "/export/subscriptions?date_format=DD.MM.YY",
+			wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed},
+		{name: "подписки другого пользователя", handler: HandlerExportSubscriptions(store), target: "/export/subscriptions?user_id=bob",
+			wantStatus: http.StatusForbidden, wantCode: base.CodeForbidden},
+		{name: "стоимость без периода", handler: HandlerExportCost(store), target: "/export/cost",
+			wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed},
+		{name: "стоимость другого пользователя", handler: HandlerExportCost(store), target: "/export/cost?user_id=bob&start_date=01-2024&end_date=03-2024",
+			wantStatus: http.StatusForbidden, wantCode: base.CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := exportRequest(tt.handler, alice, tt.target)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Header().Get("Content-Disposition") != "" {
+				t.Error("ошибка отдана как файл выгрузки")
+			}
+			if problemCode(t, w) != tt.wantCode {
+				t.Errorf("код ошибки не %s", tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestExportCost(t *testing.T) {
+	store := exportStore(t)
+	w := exportRequest(HandlerExportCost(store), auth.Principal{UserID: "alice"},
+		"/export/cost?start_date=01-2024&end_date=03-2024&date_format=MM.YYYY&columns=month,service_name,amount,report_currency")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="cost-`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	got := readCSV(t, w)
+	want := [][]string{
+		{"month", "service_name", "amount", "report_currency"},
+		{"01.2024", "netflix", "400", "RUB"},
+		{"02.2024", "netflix", "400", "RUB"},
+		{"02.2024", "'=cmd", "300", "RUB"},
+		{"03.2024", "netflix", "400", "RUB"},
+		{"03.2024", "'=cmd", "300", "RUB"},
+	}
+	slices.SortStableFunc(got[1:], func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+	if len(got) != len(want) {
+		t.Fatalf("выгрузка %q, want %q", got, want)
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("строка %d: %q, want %q", i, got[i], want[i])
+		}
+	}
+}
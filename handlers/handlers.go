@@ -1,92 +1,86 @@
 package handlers
 
 import (
-	"database/sql"
+	"effective_mobile/auth"
 	"effective_mobile/base"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type SubscriptionRequest struct {
-	UserID    string `json:"user_id"`
-	Service   string `json:"service_name"`
-	Price     int    `json:"price"`
-	StartDate string `json:"start_date"` // формат MM-YYYY
-	EndDate   string `json:"end_date"`   // формат MM-YYYY
+	UserID        string `json:"user_id"`
+	Service       string `json:"service_name"`
+	Price         int    `json:"price"`          // сумма одного списания
+	Currency      string `json:"currency"`       // код валюты ISO 4217, по умолчанию RUB
+	BillingPeriod string `json:"billing_period"` // weekly, monthly, quarterly или annual; по умолчанию monthly
+	StartDate     string `json:"start_date"`     // формат MM-YYYY (с первого дня месяца) или DD-MM-YYYY
+	EndDate       string `json:"end_date"`       // формат MM-YYYY (по последний день месяца) или DD-MM-YYYY
 }
 
 // HandlerAddSubscription добавляет новую подписку
 // @Summary Добавить подписку
-// @Description Добавляет новую подписку с указанием user_id, service_name, price и start_date
+// @Description Добавляет новую подписку с указанием user_id, service_name, price и start_date. Без user_id подписка создаётся для владельца токена; для другого пользователя нужна роль admin.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Param subscription body base.Subscription true "Данные подписки"
+// @Param subscription body SubscriptionRequest true "Данные подписки"
+// @Param Idempotency-Key header string false "Ключ идемпотентности: повтор с тем же ключом и телом получает исходный ответ с заголовком Idempotent-Replayed"
 // @Success 200 {object} map[string]interface{} "ID новой подписки"
-// @Failure 400 {object} map[string]string "Ошибка валидации или форматирования запроса"
-// @Failure 405 {object} map[string]string "Метод не разрешен"
-// @Failure 500 {object} map[string]string "Ошибка сервера при добавлении подписки"
+// @Failure 400 {object} Problem "Ошибка валидации или форматирования запроса"
+// @Failure 405 {object} Problem "Метод не разрешен"
+// @Failure 409 {object} Problem "Ключ идемпотентности использован с другим телом или запрос с ним ещё выполняется"
+// @Failure 413 {object} Problem "Тело запроса с ключом идемпотентности больше 64 КБ"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при добавлении подписки"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscription [post]
-func HandlerAddSubscription(db *sql.DB) http.HandlerFunc {
+func HandlerAddSubscription(store base.SubscriptionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		log.Printf("Получен запрос: %s %s", req.Method, req.URL.Path)
+		slog.DebugContext(req.Context(), "Получен запрос", "method", req.Method, "path", req.URL.Path)
 
 		if req.Method != http.MethodPost {
-			http.Error(w, `{"error": "Метод не разрешен"}`, http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, req)
 			return
 		}
 
 		var reqData SubscriptionRequest
 		if err := json.NewDecoder(req.Body).Decode(&reqData); err != nil {
-			log.Printf("Ошибка десериализации JSON в HandlerAddSubscription: %v", err)
-			http.Error(w, `{"error": "Ошибка десериализации JSON"}`, http.StatusBadRequest)
+			writeError(w, req, invalidJSON(err))
 			return
 		}
 
-		if err := validateSubscriptionInput(reqData); err != nil {
-			log.Printf("Отсутствуют обязательные поля")
-			http.Error(w, `{"error": "Отсутствуют обязательные поля: user_id, service_name, price, start_date"}`, http.StatusBadRequest)
-			return
+		// без user_id подписка создаётся для самого вызывающего
+		if reqData.UserID == "" {
+			if p, ok := auth.FromContext(req.Context()); ok {
+				reqData.UserID = p.UserID
+			}
 		}
 
-		parsedStartDate, err := time.Parse("01-2006", reqData.StartDate)
+		s, err := subscriptionFromRequest(reqData)
 		if err != nil {
-			log.Printf("Неправильный формат времени")
-			http.Error(w, `{"error": введите время в формате 01-2006"}`, http.StatusBadRequest)
+			writeError(w, req, err)
 			return
 		}
-
-		var parsedEndDate time.Time
-		if reqData.EndDate != "" {
-			parsedEndDate, err = time.Parse("01-2006", reqData.EndDate)
-			if err != nil {
-				log.Printf("Неправильный формат времени")
-				http.Error(w, `{"error": введите время в формате 01-2006"}`, http.StatusBadRequest)
-				return
-			}
-		} else {
-			parsedEndDate = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
-		}
-
-		s := base.Subscription{
-			UserID:    reqData.UserID,
-			Service:   reqData.Service,
-			Price:     reqData.Price,
-			StartDate: parsedStartDate,
-			EndDate:   parsedEndDate,
+		if err := authorizeUser(req, s.UserID); err != nil {
+			writeError(w, req, err)
+			return
 		}
 
-		// Выполняем обновление
-		id, err := base.InsertSubscription(db, s)
+		id, err := store.InsertSubscription(req.Context(), s)
 		if err != nil {
-			log.Printf("Ошибка при добавлении подписки в InsertSubscription: %v", err)
-			http.Error(w, `{"error": "Не удалось добавить подписку"}`, http.StatusInternalServerError)
+			writeError(w, req, err)
 			return
 		}
 
@@ -97,95 +91,67 @@ func HandlerAddSubscription(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// HandlerAddSubscription добавляет новую подписку
-// @Summary Добавить подписку
-// @Description Добавляет новую подписку с указанием user_id, service_name, price и start_date
+// HandlerUpdateSubscription обновляет подписку по ID
+// @Summary Обновить подписку по ID
+// @Description Перезаписывает поля подписки. Изменение цены действует с текущего месяца и не переписывает историю.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Param subscription body base.Subscription true "Данные подписки"
-// @Success 200 {object} map[string]interface{} "ID новой подписки"
-// @Failure 400 {object} map[string]string "Ошибка валидации или форматирования запроса"
-// @Failure 405 {object} map[string]string "Метод не разрешен"
-// @Failure 500 {object} map[string]string "Ошибка сервера при добавлении подписки"
-// @Router /subscription [post]
-func HandlerUpdateSubscription(db *sql.DB) http.HandlerFunc {
+// @Param id path int true "ID подписки"
+// @Param subscription body SubscriptionRequest true "Данные подписки"
+// @Success 200 {object} map[string]string "Подписка обновлена"
+// @Failure 400 {object} Problem "Ошибка валидации или форматирования запроса"
+// @Failure 404 {object} Problem "Подписка не найдена"
+// @Failure 405 {object} Problem "Метод не разрешен"
+// @Failure 409 {object} Problem "Подписка удалена"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при обновлении подписки"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscription/{id} [put]
+func HandlerUpdateSubscription(store base.SubscriptionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		log.Printf("Получен запрос: %s %s", req.Method, req.URL.Path)
+		slog.DebugContext(req.Context(), "Получен запрос", "method", req.Method, "path", req.URL.Path)
 
 		if req.Method != http.MethodPut {
-			http.Error(w, `{"error": "Метод не разрешен"}`, http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, req)
 			return
 		}
 
-		// Получаем id из URL-параметров (предполагается, что используется chi или gorilla/mux)
-		idStr := chi.URLParam(req, "id")
-		if idStr == "" {
-			http.Error(w, `{"error": "Не указан ID в URL"}`, http.StatusBadRequest)
-			return
-		}
-
-		id, err := strconv.Atoi(idStr)
-		if err != nil || id <= 0 {
-			http.Error(w, `{"error": "Некорректный ID в URL"}`, http.StatusBadRequest)
+		id, err := subscriptionID(req)
+		if err != nil {
+			writeError(w, req, err)
 			return
 		}
 
 		var reqData SubscriptionRequest
 		if err := json.NewDecoder(req.Body).Decode(&reqData); err != nil {
-			log.Printf("Ошибка десериализации JSON в HandlerAddSubscription: %v", err)
-			http.Error(w, `{"error": "Ошибка десериализации JSON"}`, http.StatusBadRequest)
+			writeError(w, req, invalidJSON(err))
 			return
 		}
 
-		if err := validateSubscriptionInput(reqData); err != nil {
-			log.Printf("Отсутствуют обязательные поля")
-			http.Error(w, `{"error": "Отсутствуют обязательные поля: user_id, service_name, price, start_date"}`, http.StatusBadRequest)
+		s, err := subscriptionFromRequest(reqData)
+		if err != nil {
+			writeError(w, req, err)
 			return
 		}
+		// Принудительно устанавливаем ID из URL (игнорируем ID из тела)
+		s.ID = id
 
-		parsedStartDate, err := time.Parse("01-2006", reqData.StartDate)
-
-		var parsedEndDate time.Time
-		if reqData.EndDate != "" {
-			parsedEndDate, err = time.Parse("01-2006", reqData.EndDate)
-			if err != nil {
-				log.Printf("Неправильный формат времени")
-				http.Error(w, `{"error": введите время в формате 01-2006"}`, http.StatusBadRequest)
-				return
-			}
-		} else {
-			parsedEndDate = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
-		}
-
-		if err := validateSubscriptionInput(reqData); err != nil {
-			log.Printf("Отсутствуют обязательные поля")
-			http.Error(w, `{"error": "Отсутствуют обязательные поля: user_id, service_name, price, start_date"}`, http.StatusBadRequest)
+		// менять можно только свою подписку и только так, чтобы она осталась своей
+		if err := authorizeSubscription(store, req, strconv.Itoa(id)); err != nil {
+			writeError(w, req, err)
 			return
 		}
-
-		s := base.Subscription{
-			UserID:    reqData.UserID,
-			Service:   reqData.Service,
-			Price:     reqData.Price,
-			StartDate: parsedStartDate,
-			EndDate:   parsedEndDate,
-		}
-
-		// Принудительно устанавливаем ID из URL (игнорируем ID из тела)
-		s.ID = id
-		// Проверки
-		if s.ID == 0 {
-			log.Printf("Не указан ID подписки")
-			http.Error(w, `{"error": "Не указан ID подписки"}`, http.StatusBadRequest)
+		if err := authorizeUser(req, s.UserID); err != nil {
+			writeError(w, req, err)
 			return
 		}
 
-		// Выполняем обновление
-		err = base.UpdateSubscription(db, s)
-		if err != nil {
-			log.Printf("Ошибка при обновлении подписки: %v", err)
-			http.Error(w, `{"error": "Не удалось обновить подписку"}`, http.StatusInternalServerError)
+		if err := store.UpdateSubscription(req.Context(), s); err != nil {
+			writeError(w, req, err)
 			return
 		}
 
@@ -198,30 +164,39 @@ func HandlerUpdateSubscription(db *sql.DB) http.HandlerFunc {
 
 // HandlerDeleteSubscription удаляет подписку по ID
 // @Summary Удалить подписку по ID
-// @Description Удаляет подписку по указанному ID
+// @Description Мягко удаляет подписку: она пропадает из выборок и подсчёта стоимости, но её можно восстановить через POST /subscription/{id}/restore, пока она не очищена окончательно
 // @Tags subscriptions
 // @Produce json
 // @Param id path int true "ID подписки"
 // @Success 200 {object} map[string]interface{} "ID удаленной подписки"
-// @Failure 405 {object} map[string]string "Метод не разрешен"
-// @Failure 500 {object} map[string]string "Ошибка сервера при удалении подписки"
+// @Failure 400 {object} Problem "Некорректный ID"
+// @Failure 404 {object} Problem "Подписка не найдена"
+// @Failure 405 {object} Problem "Метод не разрешен"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при удалении подписки"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Подписка принадлежит другому пользователю"
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscription/{id} [delete]
-func HandlerDeleteSubscription(db *sql.DB) http.HandlerFunc {
+func HandlerDeleteSubscription(store base.SubscriptionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		log.Printf("Получен запрос: %s %s", req.Method, req.URL.Path)
+		slog.DebugContext(req.Context(), "Получен запрос", "method", req.Method, "path", req.URL.Path)
 
 		if req.Method != http.MethodDelete {
-			http.Error(w, `{"error": "Метод не разрешен"}`, http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, req)
 			return
 		}
 
 		idStr := chi.URLParam(req, "id")
+		if err := authorizeSubscription(store, req, idStr); err != nil {
+			writeError(w, req, err)
+			return
+		}
 
 		// Выполняем удаление
-		err := base.DeleteSubscription(db, idStr)
-		if err != nil {
-			log.Printf("Ошибка при удалении подписки в DeleteSubscription: %v", err)
-			http.Error(w, `{"error": "Не удалось удалить подписку"}`, http.StatusInternalServerError)
+		if err := store.DeleteSubscription(req.Context(), idStr); err != nil {
+			writeError(w, req, err)
 			return
 		}
 
@@ -232,76 +207,255 @@ func HandlerDeleteSubscription(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func validateSubscriptionInput(s SubscriptionRequest) error {
-	if s.UserID == "" || s.Service == "" || s.Price <= 0 || s.StartDate == "" {
-		return errors.New("user_id, service_name, price и start_date обязательны")
+// subscriptionFromRequest разбирает даты запроса. Остальные поля проверяет хранилище при записи,
+// но если даты некорректны, ошибки всех полей возвращаются сразу.
+func subscriptionFromRequest(reqData SubscriptionRequest) (base.Subscription, error) {
+	s := base.Subscription{
+		UserID:        reqData.UserID,
+		Service:       reqData.Service,
+		Price:         reqData.Price,
+		Currency:      strings.ToUpper(reqData.Currency),
+		BillingPeriod: reqData.BillingPeriod,
+		EndDate:       time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+
+	var fields []base.FieldError
+	var err error
+	if reqData.StartDate != "" {
+		if s.StartDate, err = parseStartDate(reqData.StartDate); err != nil {
+			fields = append(fields, base.FieldError{Field: "start_date", Message: "введите дату в формате MM-YYYY или DD-MM-YYYY"})
+		}
+	}
+	if reqData.EndDate != "" {
+		if s.EndDate, err = parseEndDate(reqData.EndDate); err != nil {
+			fields = append(fields, base.FieldError{Field: "end_date", Message: "введите дату в формате MM-YYYY или DD-MM-YYYY"})
+		}
+	}
+	if len(fields) == 0 {
+		return s, nil
+	}
+
+	// дополняем ошибки формата дат ошибками остальных полей, чтобы клиент увидел их все сразу
+	var validationErr *base.Error
+	if errors.As(base.ValidateSubscription(s), &validationErr) {
+		for _, f := range validationErr.Fields {
+			if f.Field != "start_date" && f.Field != "end_date" {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return s, base.NewValidationError(fields...)
+}
+
+// parseStartDate разбирает дату в формате DD-MM-YYYY или MM-YYYY; месяц без дня означает его первый день
+func parseStartDate(s string) (time.Time, error) {
+	if t, err := time.Parse("02-01-2006", s); err == nil {
+		return t, nil
+	}
+	return time.Parse("01-2006", s)
+}
+
+// parseEndDate разбирает дату в формате DD-MM-YYYY или MM-YYYY; месяц без дня означает его последний день
+func parseEndDate(s string) (time.Time, error) {
+	if t, err := time.Parse("02-01-2006", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("01-2006", s)
+	if err != nil {
+		return t, err
 	}
-	return nil
+	return t.AddDate(0, 1, -1), nil
 }
 
-// HandlerGetSubscriptionsByUserID возвращает список подписок пользователя (с фильтром по названию сервиса)
+// HandlerGetSubscriptionsByUserID возвращает страницу подписок пользователя с фильтрами и сортировкой
 // @Summary Получить подписки пользователя
-// @Description Получить все подписки по user_id, опционально фильтруя по service_name
+// @Description Возвращает подписки по user_id постранично (keyset-пагинация по cursor). Пустая страница — не ошибка.
 // @Tags subscriptions
 // @Produce json
 // @Param user_id path string true "ID пользователя"
-// @Param service_name query string false "Название сервиса (опционально)"
-// @Success 200 {array} base.Subscription
-// @Failure 400 {object} map[string]string "Ошибка валидации запроса"
-// @Failure 404 {object} map[string]string "Подписки не найдены"
-// @Failure 500 {object} map[string]string "Ошибка сервера при получении подписок"
+// @Param service_name query []string false "Название сервиса; можно указать несколько раз или через запятую" collectionFormat(multi)
+// @Param min_price query int false "Минимальная цена"
+// @Param max_price query int false "Максимальная цена"
+// @Param active_at query string false "Подписка активна на дату (формат DD-MM-YYYY или MM-YYYY — первое число месяца)"
+// @Param start_from query string false "start_date не раньше (формат MM-YYYY или DD-MM-YYYY)"
+// @Param start_to query string false "start_date не позже (формат MM-YYYY — включая весь месяц, или DD-MM-YYYY)"
+// @Param end_from query string false "end_date не раньше (формат MM-YYYY или DD-MM-YYYY)"
+// @Param end_to query string false "end_date не позже (формат MM-YYYY — включая весь месяц, или DD-MM-YYYY)"
+// @Param sort query string false "Поле сортировки" Enums(id, price, start_date, service_name)
+// @Param order query string false "Направление сортировки" Enums(asc, desc)
+// @Param limit query int false "Размер страницы (по умолчанию 50, максимум 500)"
+// @Param cursor query string false "next_cursor предыдущей страницы"
+// @Param include_deleted query bool false "Включить мягко удалённые подписки"
+// @Success 200 {object} base.SubscriptionPage
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении подписок"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscriptions/{user_id} [get]
-func HandlerGetSubscriptionsByUserID(db *sql.DB) http.HandlerFunc {
+func HandlerGetSubscriptionsByUserID(store base.SubscriptionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Получен запрос: %s %s", r.Method, r.URL.Path)
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
 
 		userID := chi.URLParam(r, "user_id")
 		if userID == "" {
-			http.Error(w, `{"error": "Не указан user_id в URL"}`, http.StatusBadRequest)
+			writeError(w, r, base.InvalidField("user_id", "не указан user_id в URL"))
+			return
+		}
+
+		if err := authorizeUser(r, userID); err != nil {
+			writeError(w, r, err)
 			return
 		}
-		serviceName := r.URL.Query().Get("service_name")
-		subs, err := base.SelectUsersSubscriptions(db, userID, serviceName)
+
+		filter, err := parseSubscriptionFilter(r.URL.Query())
 		if err != nil {
-			log.Printf("Ошибка при получении подписок: %v", err)
-			http.Error(w, `{"error": "Ошибка при получении подписок"}`, http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
+		filter.UserID = userID
 
-		if len(subs) == 0 {
-			http.Error(w, `{"error": "Подписки не найдены"}`, http.StatusNotFound)
+		page, err := store.SelectUsersSubscriptions(r.Context(), filter)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		json.NewEncoder(w).Encode(subs)
+		json.NewEncoder(w).Encode(page)
 	}
 }
 
+// parseSubscriptionFilter разбирает query-параметры выборки подписок
+func parseSubscriptionFilter(q url.Values) (base.SubscriptionFilter, error) {
+	var filter base.SubscriptionFilter
+
+	for _, v := range q["service_name"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.ServiceNames = append(filter.ServiceNames, name)
+			}
+		}
+	}
+
+	var err error
+	if filter.MinPrice, err = parseOptionalInt(q, "min_price"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = parseOptionalInt(q, "max_price"); err != nil {
+		return filter, err
+	}
+
+	// верхние границы в формате MM-YYYY включают весь месяц
+	dates := []struct {
+		name  string
+		dst   *time.Time
+		parse func(string) (time.Time, error)
+	}{
+		{"active_at", &filter.ActiveAt, parseStartDate},
+		{"start_from", &filter.StartFrom, parseStartDate},
+		{"start_to", &filter.StartTo, parseEndDate},
+		{"end_from", &filter.EndFrom, parseStartDate},
+		{"end_to", &filter.EndTo, parseEndDate},
+	}
+	for _, d := range dates {
+		v := q.Get(d.name)
+		if v == "" {
+			continue
+		}
+		if *d.dst, err = d.parse(v); err != nil {
+			return filter, base.InvalidField(d.name, "используйте формат MM-YYYY или DD-MM-YYYY")
+		}
+	}
+
+	if filter.SortBy = q.Get("sort"); filter.SortBy != "" && !base.IsSortField(filter.SortBy) {
+		return filter, base.InvalidField("sort", "должен быть одним из: id, price, start_date, service_name")
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.SortDesc = true
+	default:
+		return filter, base.InvalidField("order", "должен быть asc или desc")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			return filter, base.InvalidField("limit", fmt.Sprintf("должен быть положительным числом (максимум %d)", base.MaxPageLimit))
+		}
+	}
+	filter.Cursor = q.Get("cursor")
+
+	if filter.IncludeDeleted, err = parseIncludeDeleted(q); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseIncludeDeleted разбирает флаг include_deleted: по умолчанию удалённые подписки скрыты
+func parseIncludeDeleted(q url.Values) (bool, error) {
+	v := q.Get("include_deleted")
+	if v == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, base.InvalidField("include_deleted", "должен быть true или false")
+	}
+	return include, nil
+}
+
+func parseOptionalInt(q url.Values, name string) (*int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, base.InvalidField(name, "должен быть целым числом")
+	}
+	return &n, nil
+}
+
 // HandlerGetSubscriptionByID возвращает подписку по ID
 // @Summary Получить подписку по ID
 // @Description Возвращает подписку по уникальному ID
 // @Tags subscriptions
 // @Produce json
 // @Param id path string true "ID подписки"
+// @Param include_deleted query bool false "Вернуть подписку, даже если она мягко удалена"
 // @Success 200 {object} base.Subscription
-// @Failure 400 {object} map[string]string "Ошибка валидации запроса"
-// @Failure 500 {object} map[string]string "Ошибка сервера при получении подписки"
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 404 {object} Problem "Подписка не найдена"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении подписки"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Подписка принадлежит другому пользователю"
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /subscription/{id} [get]
-func HandlerGetSubscriptionByID(db *sql.DB) http.HandlerFunc {
+func HandlerGetSubscriptionByID(store base.SubscriptionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Получен запрос: %s %s", r.Method, r.URL.Path)
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
 
 		id := chi.URLParam(r, "id")
-		if id == "" {
-			http.Error(w, `{"error": "Не указан id в URL"}`, http.StatusBadRequest)
+
+		includeDeleted, err := parseIncludeDeleted(r.URL.Query())
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
 
-		sub, err := base.SelectSubscriptionByID(db, id)
+		sub, err := store.SelectSubscriptionByID(r.Context(), id, includeDeleted)
 		if err != nil {
-			log.Printf("Ошибка при получении подписки: %v", err)
-			http.Error(w, `{"error": "Ошибка при получении подписки"}`, http.StatusInternalServerError)
+			writeError(w, r, err)
+			return
+		}
+		if err := authorizeUser(r, sub.UserID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
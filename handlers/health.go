@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheck проверяет одну зависимость сервиса; nil — зависимость доступна
+type HealthCheck func(ctx context.Context) error
+
+// Health отвечает на проверки живости и готовности.
+// Готовность определяется проверками зависимостей и пропадает, когда сервер начинает остановку.
+type Health struct {
+	timeout      time.Duration
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// HealthResponse — ответ /readyz
+type HealthResponse struct {
+	Status string                       `json:"status" example:"ready"` // ready, not_ready или shutting_down
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult — итог проверки одной зависимости
+type HealthCheckResult struct {
+	Status     string  `json:"status" example:"ok"` // ok или error
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms" example:"1.2"`
+}
+
+// NewHealth создаёт проверку готовности; каждая проверка зависимости ограничена timeout
+func NewHealth(timeout time.Duration) *Health {
+	return &Health{timeout: timeout}
+}
+
+// AddCheck добавляет проверку зависимости name; вызывать до запуска сервера
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// SetShuttingDown переводит сервис в состояние «не готов»: балансировщик перестаёт направлять на него запросы,
+// а текущие запросы при этом продолжают обрабатываться
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// HandlerLiveness отвечает 200, пока процесс способен обрабатывать запросы; зависимости не проверяет,
+// чтобы недоступность БД не приводила к перезапуску контейнера
+// @Summary Проверка живости
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Router /healthz [get]
+func (h *Health) HandlerLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+	}
+}
+
+// HandlerReadiness параллельно проверяет зависимости и отвечает 200, если все доступны, иначе 503.
+// Во время остановки сервера сразу отвечает 503 без проверок.
+// @Summary Проверка готовности
+// @Description Проверяет доступность БД и актуальность миграций; статус каждой зависимости — в checks
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Failure 503 {object} HealthResponse
+// @Router /readyz [get]
+func (h *Health) HandlerReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.shuttingDown.Load() {
+			writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: "shutting_down"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+
+		results := make([]HealthCheckResult, len(h.checks))
+		var wg sync.WaitGroup
+		for i, c := range h.checks {
+			wg.Add(1)
+			go func(i int, c namedCheck) {
+				defer wg.Done()
+				start := time.Now()
+				res := HealthCheckResult{Status: "ok"}
+				if err := c.check(ctx); err != nil {
+					res.Status = "error"
+					res.Error = err.Error()
+					slog.WarnContext(r.Context(), "Зависимость не готова", "check", c.name, "error", err)
+				}
+				res.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+				results[i] = res
+			}(i, c)
+		}
+		wg.Wait()
+
+		resp := HealthResponse{Status: "ready", Checks: make(map[string]HealthCheckResult, len(h.checks))}
+		status := http.StatusOK
+		for i, c := range h.checks {
+			resp.Checks[c.name] = results[i]
+			if results[i].Status != "ok" {
+				resp.Status = "not_ready"
+				status = http.StatusServiceUnavailable
+			}
+		}
+		writeHealth(w, status, resp)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp HealthResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// IdempotencyKeyHeader — заголовок, по которому повтор запроса получает исходный ответ
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader отмечает ответ, повторённый по ключу идемпотентности
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength ограничивает длину ключа; UUID и подобные ключи заметно короче
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency повторяет ответ на запрос с заголовком Idempotency-Key, не выполняя его заново.
+// Ключ действует ttl в пределах вызывающего (API-ключа или пользователя). Запрос с тем же ключом,
+// но другим методом, путём, параметрами или телом получает 409, как и повтор, пока первый запрос ещё выполняется.
+// Ответы 5xx не сохраняются: после ошибки сервера запрос с тем же ключом выполнится снова.
+// Тело запроса читается в память целиком, поэтому оно ограничено maxBody байтами — своими для каждого маршрута.
+// Запросы без заголовка проходят как обычно, как и запросы без API-ключа и пользователя (AUTH_DISABLED=true).
+func Idempotency(store base.SubscriptionStore, ttl time.Duration, maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				writeError(w, r, base.InvalidField(IdempotencyKeyHeader,
+					fmt.Sprintf("ожидается от 1 до %d печатных символов ASCII", maxIdempotencyKeyLength)))
+				return
+			}
+			scope, ok := idempotencyScope(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// тело нужно целиком: по нему отличается повтор от другого запроса с тем же ключом
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeProblem(w, r, Problem{
+					Status: http.StatusRequestEntityTooLarge,
+					Code:   codePayloadTooLarge,
+					Detail: fmt.Sprintf("тело запроса больше %d байт", maxBody),
+				})
+				return
+			}
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			rec := base.IdempotencyRecord{Scope: scope, Key: key, Fingerprint: requestFingerprint(r, body)}
+			existing, reserved, err := store.ReserveIdempotencyKey(r.Context(), rec, ttl)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if !reserved {
+				replayIdempotent(w, r, existing, rec.Fingerprint)
+				return
+			}
+
+			// ключ освобождается при ошибке сервера и при панике обработчика
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.ReleaseIdempotencyKey(context.WithoutCancel(r.Context()), rec.Scope, rec.Key); err != nil {
+						slog.ErrorContext(r.Context(), "Ошибка освобождения ключа идемпотентности", "error", err)
+					}
+				}
+			}()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			var resp bytes.Buffer
+			ww.Tee(&resp)
+			next.ServeHTTP(ww, r)
+
+			rec.StatusCode = ww.Status()
+			if rec.StatusCode == 0 {
+				rec.StatusCode = http.StatusOK
+			}
+			if rec.StatusCode >= 500 {
+				return
+			}
+			rec.ContentType = ww.Header().Get("Content-Type")
+			rec.Body = resp.Bytes()
+			// ответ уже отправлен, поэтому ошибка сохранения только логируется: повтор выполнит запрос заново
+			if err := store.CompleteIdempotencyKey(context.WithoutCancel(r.Context()), rec); err != nil {
+				slog.ErrorContext(r.Context(), "Ошибка сохранения ответа по ключу идемпотентности", "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// idempotencyScope возвращает вызывающего, в пределах которого действуют ключи: API-ключ или пользователя.
+// IP-адрес не подходит: за общим NAT или прокси разные клиенты получили бы чужие ответы, поэтому без вызывающего
+// ответ не сохраняется (false).
+func idempotencyScope(r *http.Request) (string, bool) {
+	p, ok := auth.FromContext(r.Context())
+	switch {
+	case !ok:
+		return "", false
+	case p.APIKeyID != 0:
+		return "key:" + strconv.Itoa(p.APIKeyID), true
+	case p.UserID != "":
+		return "user:" + p.UserID, true
+	}
+	return "", false
+}
+
+// replayIdempotent отвечает на повтор запроса с уже занятым ключом
+func replayIdempotent(w http.ResponseWriter, r *http.Request, existing base.IdempotencyRecord, fingerprint string) {
+	switch {
+	case existing.Fingerprint != fingerprint:
+		writeProblem(w, r, Problem{
+			Status: http.StatusConflict,
+			Code:   codeIdempotencyKeyReused,
+			Detail: "ключ идемпотентности уже использован для другого запроса",
+		})
+	case !existing.Completed():
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, r, Problem{
+			Status: http.StatusConflict,
+			Code:   codeIdempotencyInFlight,
+			Detail: "запрос с этим ключом идемпотентности ещё выполняется",
+		})
+	default:
+		slog.DebugContext(r.Context(), "Повтор ответа по ключу идемпотентности", "status", existing.StatusCode)
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(existing.StatusCode)
+		w.Write(existing.Body)
+	}
+}
+
+// requestFingerprint — хеш всего, что определяет результат запроса: метода, пути, параметров, формата и тела
+func requestFingerprint(r *http.Request, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", r.Method, r.URL.Path, r.URL.Query().Encode(), mediaType)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validIdempotencyKey пропускает только печатные символы ASCII, как и validRequestID, но допускает пробелы
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, c := range key {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createHandler отвечает status с JSON-телом и считает дошедшие до него запросы
+type createHandler struct {
+	calls  int
+	status int
+}
+
+func (h *createHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.calls++
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(h.status)
+	w.Write([]byte(`{"id":1}`))
+}
+
+func idempotentRequest(key, body string, p auth.Principal) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	return r.WithContext(auth.WithPrincipal(r.Context(), p))
+}
+
+func problemCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("тело ответа: %v", err)
+	}
+	return p.Code
+}
+
+func TestIdempotency(t *testing.T) {
+	alice := auth.Principal{UserID: "alice"}
+	next := &createHandler{status: http.StatusCreated}
+	h := Idempotency(base.NewMemoryStore(), time.Hour, 1024)(next)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, idempotentRequest("k1", `{"price":400}`, alice))
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("первый запрос: status = %d, %s = %q", w.Code, IdempotentReplayedHeader, w.Header().Get(IdempotentReplayedHeader))
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, idempotentRequest("k1", `{"price":400}`, alice))
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":1}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("повтор: status = %d, тело %q, Content-Type %q", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	if got := w.Header().Get(IdempotentReplayedHeader); got != "true" {
+		t.Errorf("%s = %q, want true", IdempotentReplayedHeader, got)
+	}
+	if next.calls != 1 {
+		t.Errorf("обработчик вызван %d раз, want 1", next.calls)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, idempotentRequest("k1", `{"price":500}`, alice))
+	if w.Code != http.StatusConflict || problemCode(t, w) != codeIdempotencyKeyReused {
+		t.Errorf("другое тело с тем же ключом: status = %d, want 409 %s", w.Code, codeIdempotencyKeyReused)
+	}
+
+	// у другого вызывающего свои ключи, как и запросы без ключа
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("k1", `{"price":400}`, auth.Principal{UserID: "alice", APIKeyID: 7}))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("", `{"price":400}`, alice))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("", `{"price":400}`, alice))
+	if next.calls != 4 {
+		t.Errorf("обработчик вызван %d раз, want 4", next.calls)
+	}
+}
+
+func TestIdempotencyServerError(t *testing.T) {
+	next := &createHandler{status: http.StatusInternalServerError}
+	h := Idempotency(base.NewMemoryStore(), time.Hour, 1024)(next)
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, idempotentRequest("k1", `{}`, auth.Principal{UserID: "alice"}))
+		if w.Code != http.StatusInternalServerError || w.Header().Get(IdempotentReplayedHeader) != "" {
+			t.Errorf("status = %d, %s = %q", w.Code, IdempotentReplayedHeader, w.Header().Get(IdempotentReplayedHeader))
+		}
+	}
+	if next.calls != 2 {
+		t.Errorf("после ошибки сервера обработчик вызван %d раз, want 2", next.calls)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	store := base.NewMemoryStore()
+	alice := auth.Principal{UserID: "alice"}
+	var retry *httptest.ResponseRecorder
+
+	// повтор приходит, пока первый запрос ещё в обработчике
+	var h http.Handler
+	h = Idempotency(store, time.Hour, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retry == nil {
+			retry = httptest.NewRecorder()
+			h.ServeHTTP(retry, idempotentRequest("k1", `{}`, alice))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("k1", `{}`, alice))
+
+	if retry.Code != http.StatusConflict || problemCode(t, retry) != codeIdempotencyInFlight {
+		t.Errorf("повтор во время выполнения: status = %d, want 409 %s", retry.Code, codeIdempotencyInFlight)
+	}
+	if got := retry.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+}
+
+func TestIdempotencyRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		body     string
+		wantCode int
+	}{
+		{name: "тело больше лимита", key: "k1", body: strings.Repeat("x", 1025), wantCode: http.StatusRequestEntityTooLarge},
+		{name: "ключ не ASCII", key: "ключ", body: `{}`, wantCode: http.StatusBadRequest},
+		{name: "слишком длинный ключ", key: strings.Repeat("k", maxIdempotencyKeyLength+1), body: `{}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &createHandler{status: http.StatusCreated}
+			h := Idempotency(base.NewMemoryStore(), time.Hour, 1024)(next)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, idempotentRequest(tt.key, tt.body, auth.Principal{UserID: "alice"}))
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if next.calls != 0 {
+				t.Errorf("обработчик вызван %d раз, want 0", next.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		want      string // пусто — ответ не сохраняется
+	}{
+		{name: "API-ключ", principal: &auth.Principal{UserID: "alice", APIKeyID: 7}, want: "key:7"},
+		{name: "пользователь", principal: &auth.Principal{UserID: "alice"}, want: "user:alice"},
+		{name: "анонимный администратор", principal: &auth.Principal{Roles: []string{auth.RoleAdmin}}},
+		{name: "без вызывающего"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/subscription", strings.NewReader(`{}`))
+			r.Header.Set(IdempotencyKeyHeader, "k1")
+			if tt.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), *tt.principal))
+			}
+			if got, ok := idempotencyScope(r); got != tt.want || ok != (tt.want != "") {
+				t.Errorf("idempotencyScope = %q, %v, want %q", got, ok, tt.want)
+			}
+
+			// без вызывающего ключ не действует: оба запроса доходят до обработчика
+			next := &createHandler{status: http.StatusCreated}
+			h := Idempotency(base.NewMemoryStore(), time.Hour, 1024)(next)
+			for range 2 {
+				req := r.Clone(r.Context())
+				req.Body = io.NopCloser(strings.NewReader(`{}`))
+				req.RemoteAddr = "192.0.2.1:1234"
+				h.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			wantCalls := 1
+			if tt.want == "" {
+				wantCalls = 2
+			}
+			if next.calls != wantCalls {
+				t.Errorf("обработчик вызван %d раз, want %d", next.calls, wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxImportBytes ограничивает размер загружаемого файла
+	MaxImportBytes = 10 << 20
+	// MaxSubscriptionBytes ограничивает тело запроса с одной подпиской; настоящая подписка занимает сотни байт
+	MaxSubscriptionBytes = 64 << 10
+	// maxImportRows ограничивает число строк в одном импорте, чтобы транзакция не держала блокировки слишком долго
+	maxImportRows = 10000
+)
+
+// Режимы импорта
+const (
+	ImportTransactional = "transactional" // всё или ничего: при ошибке в любой строке не добавляется ни одна подписка
+	ImportBestEffort    = "best_effort"   // добавляются все корректные строки, ошибочные пропускаются
+)
+
+// Статусы строк в отчёте импорта
+const (
+	rowCreated = "created" // подписка добавлена
+	rowValid   = "valid"   // строка корректна, но ничего не записано (dry_run или откат транзакции)
+	rowFailed  = "failed"  // строка содержит ошибку
+)
+
+// ImportReport — отчёт об импорте подписок
+type ImportReport struct {
+	Mode    string      `json:"mode" example:"transactional"`
+	DryRun  bool        `json:"dry_run" example:"false"`
+	Total   int         `json:"total" example:"3"`
+	Created int         `json:"created" example:"2"`
+	Failed  int         `json:"failed" example:"1"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// ImportRow — итог импорта одной строки
+type ImportRow struct {
+	Row    int               `json:"row" example:"2"` // номер строки в файле, начиная с 1
+	Status string            `json:"status" example:"created"`
+	ID     int               `json:"id,omitempty" example:"42"`
+	Code   string            `json:"code,omitempty" example:"validation_failed"`
+	Detail string            `json:"detail,omitempty" example:"некорректные данные запроса"`
+	Errors []base.FieldError `json:"errors,omitempty"`
+}
+
+// importRecord — разобранная строка файла
+type importRecord struct {
+	line   int
+	req    SubscriptionRequest
+	err    error             // строку не удалось разобрать
+	fields []base.FieldError // ошибки значений отдельных колонок, например нечисловая цена
+}
+
+// HandlerImportSubscriptions добавляет подписки из CSV или JSON Lines
+// @Summary Импорт подписок
+// @Description Принимает CSV (Content-Type: text/csv) с заголовком из полей SubscriptionRequest или JSON Lines (application/x-ndjson) — по объекту SubscriptionRequest в строке.
+// @Description Каждая строка проверяется по тем же правилам, что и POST /subscription; без user_id подписка создаётся для владельца токена.
+// @Description В режиме transactional при ошибке в любой строке не добавляется ни одна подписка (ответ 422), в режиме best_effort добавляются все корректные строки.
+// @Description dry_run=true только проверяет строки. Не больше 10000 строк и 10 МБ.
+// @Tags subscriptions
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param mode query string false "transactional (по умолчанию) или best_effort"
+// @Param dry_run query bool false "только проверить строки, ничего не записывая"
+// @Param Idempotency-Key header string false "Ключ идемпотентности: повтор с тем же ключом, параметрами и файлом получает исходный отчёт"
+// @Success 200 {object} ImportReport "Отчёт по строкам"
+// @Failure 400 {object} Problem "Некорректный файл или параметры"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 409 {object} Problem "Ключ идемпотентности использован с другим запросом или запрос с ним ещё выполняется"
+// @Failure 413 {object} Problem "Файл слишком большой"
+// @Failure 415 {object} Problem "Неподдерживаемый формат"
+// @Failure 422 {object} ImportReport "В режиме transactional есть ошибочные строки, ничего не добавлено"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при импорте"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscriptions/import [post]
+func HandlerImportSubscriptions(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		q := r.URL.Query()
+		mode := q.Get("mode")
+		switch mode {
+		case "":
+			mode = ImportTransactional
+		case ImportTransactional, ImportBestEffort:
+		default:
+			writeError(w, r, base.InvalidField("mode", "ожидается transactional или best_effort"))
+			return
+		}
+		dryRun := false
+		if v := q.Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				writeError(w, r, base.InvalidField("dry_run", "ожидается true или false"))
+				return
+			}
+		}
+
+		body := http.MaxBytesReader(w, r.Body, MaxImportBytes)
+		var records []importRecord
+		var err error
+		switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+		case "text/csv":
+			records, err = readImportCSV(body)
+		case "application/x-ndjson", "application/jsonl", "application/json-lines":
+			records, err = readImportJSONLines(body)
+		default:
+			writeProblem(w, r, Problem{
+				Status: http.StatusUnsupportedMediaType,
+				Code:   codeUnsupportedMediaType,
+				Detail: "ожидается text/csv или application/x-ndjson",
+			})
+			return
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(w, r, Problem{
+				Status: http.StatusRequestEntityTooLarge,
+				Code:   codePayloadTooLarge,
+				Detail: fmt.Sprintf("файл больше %d байт", MaxImportBytes),
+			})
+			return
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if len(records) == 0 {
+			writeError(w, r, base.InvalidField("file", "не передано ни одной подписки"))
+			return
+		}
+
+		report := ImportReport{Mode: mode, DryRun: dryRun, Total: len(records), Rows: make([]ImportRow, len(records))}
+		subscriptions := make([]base.Subscription, len(records))
+		for i, rec := range records {
+			report.Rows[i].Row = rec.line
+			s, err := validateImportRecord(r, rec)
+			if err != nil {
+				report.Rows[i].fail(err)
+				report.Failed++
+				continue
+			}
+			subscriptions[i] = s
+			report.Rows[i].Status = rowValid
+		}
+
+		switch {
+		case dryRun:
+		case mode == ImportTransactional:
+			if report.Failed > 0 {
+				break
+			}
+			ids, err := store.InsertSubscriptions(r.Context(), subscriptions)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			for i, id := range ids {
+				report.Rows[i].Status = rowCreated
+				report.Rows[i].ID = id
+			}
+			report.Created = len(ids)
+		default:
+			for i := range report.Rows {
+				if report.Rows[i].Status != rowValid {
+					continue
+				}
+				id, err := store.InsertSubscription(r.Context(), subscriptions[i])
+				if err != nil {
+					var domainErr *base.Error
+					if !errors.As(err, &domainErr) {
+						slog.ErrorContext(r.Context(), "Ошибка импорта строки", "row", report.Rows[i].Row, "error", err)
+					}
+					report.Rows[i].fail(err)
+					report.Failed++
+					continue
+				}
+				report.Rows[i].Status = rowCreated
+				report.Rows[i].ID = id
+				report.Created++
+			}
+		}
+
+		slog.InfoContext(r.Context(), "Импорт подписок", "mode", mode, "dry_run", dryRun,
+			"total", report.Total, "created", report.Created, "failed", report.Failed)
+
+		status := http.StatusOK
+		if mode == ImportTransactional && !dryRun && report.Failed > 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// validateImportRecord проверяет строку по правилам POST /subscription, включая доступ к user_id
+func validateImportRecord(r *http.Request, rec importRecord) (base.Subscription, error) {
+	if rec.err != nil {
+		return base.Subscription{}, rec.err
+	}
+
+	reqData := rec.req
+	if reqData.UserID == "" {
+		if p, ok := auth.FromContext(r.Context()); ok {
+			reqData.UserID = p.UserID
+		}
+	}
+
+	s, err := subscriptionFromRequest(reqData)
+	if err == nil {
+		err = base.ValidateSubscription(s)
+	}
+	if len(rec.fields) > 0 {
+		// ошибки разбора колонок дополняем ошибками остальных полей, чтобы клиент увидел их все сразу
+		fields := rec.fields
+		var validationErr *base.Error
+		if errors.As(err, &validationErr) {
+			for _, f := range validationErr.Fields {
+				if !hasField(rec.fields, f.Field) {
+					fields = append(fields, f)
+				}
+			}
+		}
+		return base.Subscription{}, base.NewValidationError(fields...)
+	}
+	if err != nil {
+		return base.Subscription{}, err
+	}
+	if err := authorizeUser(r, s.UserID); err != nil {
+		return base.Subscription{}, err
+	}
+	return s, nil
+}
+
+func hasField(fields []base.FieldError, name string) bool {
+	for _, f := range fields {
+		if f.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fail записывает ошибку строки; подробности внутренних ошибок клиенту не отдаются
+func (row *ImportRow) fail(err error) {
+	row.Status = rowFailed
+	var domainErr *base.Error
+	if !errors.As(err, &domainErr) {
+		row.Code = codeInternalError
+		row.Detail = "внутренняя ошибка сервера"
+		return
+	}
+	row.Code = domainErr.Code
+	row.Detail = domainErr.Message
+	row.Errors = domainErr.Fields
+}
+
+// columnSetter записывает значение колонки CSV в поле запроса
+type columnSetter func(req *SubscriptionRequest, value string) *base.FieldError
+
+// importColumns — допустимые колонки CSV, совпадают с полями SubscriptionRequest
+var importColumns = map[string]columnSetter{
+	"user_id":        func(req *SubscriptionRequest, v string) *base.FieldError { req.UserID = v; return nil },
+	"service_name":   func(req *SubscriptionRequest, v string) *base.FieldError { req.Service = v; return nil },
+	"currency":       func(req *SubscriptionRequest, v string) *base.FieldError { req.Currency = v; return nil },
+	"billing_period": func(req *SubscriptionRequest, v string) *base.FieldError { req.BillingPeriod = v; return nil },
+	"start_date":     func(req *SubscriptionRequest, v string) *base.FieldError { req.StartDate = v; return nil },
+	"end_date":       func(req *SubscriptionRequest, v string) *base.FieldError { req.EndDate = v; return nil },
+	"price": func(req *SubscriptionRequest, v string) *base.FieldError {
+		if v == "" {
+			return nil
+		}
+		price, err := strconv.Atoi(v)
+		if err != nil {
+			return &base.FieldError{Field: "price", Message: "ожидается целое число"}
+		}
+		req.Price = price
+		return nil
+	},
+}
+
+// readImportCSV читает CSV с обязательной строкой заголовка; порядок колонок произвольный
+func readImportCSV(r io.Reader) ([]importRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	setters := make([]columnSetter, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		setter, ok := importColumns[name]
+		if !ok {
+			return nil, base.InvalidField("header", fmt.Sprintf("неизвестная колонка %q", name))
+		}
+		if seen[name] {
+			return nil, base.InvalidField("header", fmt.Sprintf("колонка %q указана дважды", name))
+		}
+		seen[name] = true
+		setters[i] = setter
+	}
+
+	var records []importRecord
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// ошибка формата одной записи не мешает разобрать остальные
+			records = append(records, importRecord{line: parseErr.StartLine, err: csvError(err)})
+		} else if err != nil {
+			return nil, err
+		} else {
+			line, _ := reader.FieldPos(0)
+			rec := importRecord{line: line}
+			for i, value := range record {
+				if err := setters[i](&rec.req, strings.TrimSpace(value)); err != nil {
+					rec.fields = append(rec.fields, *err)
+				}
+			}
+			records = append(records, rec)
+		}
+
+		if len(records) > maxImportRows {
+			return nil, base.InvalidField("file", fmt.Sprintf("не больше %d строк за один импорт", maxImportRows))
+		}
+	}
+	return records, nil
+}
+
+// csvError превращает ошибку разбора CSV в ошибку валидации
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return base.InvalidField("csv", parseErr.Err.Error())
+	}
+	return err
+}
+
+// readImportJSONLines читает по объекту SubscriptionRequest в строке; пустые строки пропускаются
+func readImportJSONLines(r io.Reader) ([]importRecord, error) {
+	scanner := bufio.NewScanner(r)
+	// буфер на байт больше предела файла: слишком длинную строку отсекает MaxBytesReader (413), а не сканер
+	scanner.Buffer(make([]byte, 64<<10), MaxImportBytes+1)
+
+	var records []importRecord
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		rec := importRecord{line: line}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec.req); err != nil {
+			rec.err = invalidJSON(err)
+		}
+		records = append(records, rec)
+
+		if len(records) > maxImportRows {
+			return nil, base.InvalidField("file", fmt.Sprintf("не больше %d строк за один импорт", maxImportRows))
+		}
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"context"
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	contentCSV        = "text/csv"
+	contentJSONLines  = "application/x-ndjson"
+	importCSVHeader   = "user_id,service_name,price,start_date\n"
+	importBadPriceRow = "alice,spotify,0,01-2024\n"
+)
+
+// importRequest отправляет файл в HandlerImportSubscriptions от имени alice
+func importRequest(t *testing.T, store base.SubscriptionStore, query, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/subscriptions/import?"+query, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{UserID: "alice"}))
+	w := httptest.NewRecorder()
+	HandlerImportSubscriptions(store)(w, r)
+	return w
+}
+
+func decodeReport(t *testing.T, w *httptest.ResponseRecorder) ImportReport {
+	t.Helper()
+	var report ImportReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("отчёт импорта: %v", err)
+	}
+	return report
+}
+
+// rowStatuses возвращает статусы строк отчёта по порядку
+func rowStatuses(report ImportReport) []string {
+	statuses := make([]string, len(report.Rows))
+	for i, row := range report.Rows {
+		statuses[i] = row.Status
+	}
+	return statuses
+}
+
+// storedServices возвращает сервисы всех подписок в хранилище
+func storedServices(t *testing.T, store base.SubscriptionStore) []string {
+	t.Helper()
+	var services []string
+	err := store.StreamSubscriptions(context.Background(), base.SubscriptionFilter{}, func(s base.Subscription) error {
+		services = append(services, s.Service)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamSubscriptions: %v", err)
+	}
+	slices.Sort(services)
+	return services
+}
+
+func TestImportModes(t *testing.T) {
+	mixed := importCSVHeader + "alice,netflix,400,01-2024\n" + importBadPriceRow + "alice,yandex,300,02-2024\n"
+
+	tests := []struct {
+		name         string
+		query        string
+		body         string
+		wantStatus   int
+		wantStatuses []string
+		wantCreated  int
+		wantStored   []string
+	}{
+		{
+			name:         "transactional с ошибкой ничего не пишет",
+			body:         mixed,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantStatuses: []string{rowValid, rowFailed, rowValid},
+		},
+		{
+			name:         "transactional без ошибок",
+			query:        "mode=transactional",
+			body:         importCSVHeader + "alice,netflix,400,01-2024\nalice,yandex,300,02-2024\n",
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{rowCreated, rowCreated},
+			wantCreated:  2,
+			wantStored:   []string{"netflix", "yandex"},
+		},
+		{
+			name:         "best_effort пишет корректные строки",
+			query:        "mode=best_effort",
+			body:         mixed,
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{rowCreated, rowFailed, rowCreated},
+			wantCreated:  2,
+			wantStored:   []string{"netflix", "yandex"},
+		},
+		{
+			name:         "dry_run в режиме transactional",
+			query:        "dry_run=true",
+			body:         mixed,
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{rowValid, rowFailed, rowValid},
+		},
+		{
+			name:         "dry_run в режиме best_effort",
+			query:        "mode=best_effort&dry_run=1",
+			body:         mixed,
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{rowValid, rowFailed, rowValid},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := base.NewMemoryStore()
+			w := importRequest(t, store, tt.query, contentCSV, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			report := decodeReport(t, w)
+			if got := rowStatuses(report); !slices.Equal(got, tt.wantStatuses) {
+				t.Errorf("статусы строк %v, want %v", got, tt.wantStatuses)
+			}
+			wantFailed := strings.Count(strings.Join(tt.wantStatuses, ","), rowFailed)
+			if report.Total != len(tt.wantStatuses) || report.Created != tt.wantCreated || report.Failed != wantFailed {
+				t.Errorf("итоги total=%d created=%d failed=%d", report.Total, report.Created, report.Failed)
+			}
+			for _, row := range report.Rows {
+				if (row.Status == rowCreated) != (row.ID != 0) {
+					t.Errorf("строка %d: статус %s, id %d", row.Row, row.Status, row.ID)
+				}
+			}
+			if got := storedServices(t, store); !slices.Equal(got, tt.wantStored) {
+				t.Errorf("в хранилище %v, want %v", got, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestImportRowErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantRows    []int    // номера строк в отчёте
+		wantFailed  int      // номер ошибочной строки
+		wantCode    string   // код ошибки этой строки
+		wantFields  []string // поля с ошибками этой строки
+	}{
+		{
+			name:        "нечисловая цена вместе с ошибками других полей",
+			contentType: contentCSV,
+			body:        importCSVHeader + "alice,netflix,400,01-2024\nalice,,abc,\n",
+			wantRows:    []int{2, 3},
+			wantFailed:  3,
+			wantCode:    base.CodeValidationFailed,
+			wantFields:  []string{"price", "service_name", "start_date"},
+		},
+		{
+			name:        "подписка другого пользователя",
+			contentType: contentCSV,
+			body:        importCSVHeader + "alice,netflix,400,01-2024\nbob,yandex,300,01-2024\n",
+			wantRows:    []int{2, 3},
+			wantFailed:  3,
+			wantCode:    base.CodeForbidden,
+		},
+		{
+			name:        "неверное число колонок",
+			contentType: contentCSV,
+			body:        importCSVHeader + "alice,netflix,400\nalice,yandex,300,01-2024\n",
+			wantRows:    []int{2, 3},
+			wantFailed:  2,
+			wantCode:    base.CodeValidationFailed,
+			wantFields:  []string{"csv"},
+		},
+		{
+			name:        "кавычка посреди поля",
+			contentType: contentCSV,
+			body:        importCSVHeader + "alice,net\"flix,400,01-2024\nalice,yandex,300,01-2024\n",
+			wantRows:    []int{2, 3},
+			wantFailed:  2,
+			wantCode:    base.CodeValidationFailed,
+			wantFields:  []string{"csv"},
+		},
+		{
+			name:        "некорректный JSON в строке",
+			contentType: contentJSONLines,
+			body:        `{"service_name":"netflix","price":400,"start_date":"01-2024"}` + "\n\n{\"service_name\":\n",
+			wantRows:    []int{1, 3},
+			wantFailed:  3,
+			wantCode:    base.CodeInvalidJSON,
+		},
+		{
+			name:        "неизвестное поле в JSON",
+			contentType: contentJSONLines,
+			body:        `{"service_name":"netflix","price":400,"start_date":"01-2024","plan":"family"}` + "\n" + `{"service_name":"yandex","price":300,"start_date":"01-2024"}`,
+			wantRows:    []int{1, 2},
+			wantFailed:  1,
+			wantCode:    base.CodeInvalidJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := base.NewMemoryStore()
+			w := importRequest(t, store, "mode=best_effort", tt.contentType, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+
+			report := decodeReport(t, w)
+			if report.Created != len(tt.wantRows)-1 || report.Failed != 1 {
+				t.Errorf("created=%d failed=%d, want %d и 1", report.Created, report.Failed, len(tt.wantRows)-1)
+			}
+			var rows []int
+			for _, row := range report.Rows {
+				rows = append(rows, row.Row)
+				if row.Row != tt.wantFailed {
+					if row.Status != rowCreated {
+						t.Errorf("строка %d: статус %s, want %s", row.Row, row.Status, rowCreated)
+					}
+					continue
+				}
+				if row.Status != rowFailed || row.Code != tt.wantCode {
+					t.Errorf("строка %d: статус %s, код %s, want %s и %s", row.Row, row.Status, row.Code, rowFailed, tt.wantCode)
+				}
+				var fields []string
+				for _, f := range row.Errors {
+					fields = append(fields, f.Field)
+				}
+				slices.Sort(fields)
+				if !slices.Equal(fields, tt.wantFields) {
+					t.Errorf("строка %d: ошибки полей %v, want %v", row.Row, row.Errors, tt.wantFields)
+				}
+			}
+			if !slices.Equal(rows, tt.wantRows) {
+				t.Errorf("номера строк %v, want %v", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestImportOwnUserByDefault(t *testing.T) {
+	store := base.NewMemoryStore()
+	w := importRequest(t, store, "", contentCSV, "service_name,price,start_date\nnetflix,400,01-2024\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	page, err := store.SelectUsersSubscriptions(context.Background(), base.SubscriptionFilter{UserID: "alice"})
+	if err != nil || len(page.Subscriptions) != 1 {
+		t.Errorf("подписки alice: %+v, %v", page, err)
+	}
+}
+
+func TestImportRequestErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantField   string
+	}{
+		{
+			name:        "неизвестная колонка",
+			contentType: contentCSV,
+			body:        "user_id,service,price,start_date\nalice,netflix,400,01-2024\n",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    base.CodeValidationFailed,
+			wantField:   "header",
+		},
+		{
+			name:        "колонка указана дважды",
+			contentType: contentCSV,
+			body:        "service_name,Price,price,start_date\nnetflix,400,400,01-2024\n",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    base.CodeValidationFailed,
+			wantField:   "header",
+		},
+		{
+			name:        "заголовок с BOM и в верхнем регистре",
+			contentType: "text/csv; charset=utf-8",
+			body:        "\ufeffSERVICE_NAME, Price ,start_date\nnetflix,400,01-2024\n",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "пустой файл",
+			contentType: contentCSV,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    base.CodeValidationFailed,
+			wantField:   "file",
+		},
+		{
+			name:        "только заголовок",
+			contentType: contentCSV,
+			body:        importCSVHeader,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    base.CodeValidationFailed,
+			wantField:   "file",
+		},
+		{
+			name:        "неизвестный режим",
+			query:       "mode=partial",
+			contentType: contentCSV,
+			body:        importCSVHeader + "alice,netflix,400,01-2024\n",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    base.CodeValidationFailed,
+			wantField:   "mode",
+		},
+		{
+			name:        "некорректный dry_run",
+			query:       "dry_run=maybe",
+			contentType: contentCSV,
+			body:        importCSVHeader + "alice,netflix,400,01-2024\n",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    base.CodeValidationFailed,
+			wantField:   "dry_run",
+		},
+		{
+			name:        "неподдерживаемый формат",
+			contentType: "application/json",
+			body:        `[{"service_name":"netflix"}]`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    codeUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := base.NewMemoryStore()
+			w := importRequest(t, store, tt.query, tt.contentType, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+
+			var p Problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatalf("тело ответа: %v", err)
+			}
+			if p.Code != tt.wantCode || (tt.wantField != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.wantField)) {
+				t.Errorf("ответ %+v, want код %s и поле %q", p, tt.wantCode, tt.wantField)
+			}
+			if got := storedServices(t, store); len(got) != 0 {
+				t.Errorf("в хранилище %v после отказа", got)
+			}
+		})
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	csvRows := func(n int, service string) string {
+		var b strings.Builder
+		b.WriteString(importCSVHeader)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "alice,%s,400,01-2024\n", service)
+		}
+		return b.String()
+	}
+	jsonRows := func(n int) string {
+		return strings.Repeat(`{"service_name":"netflix","price":400,"start_date":"01-2024"}`+"\n", n)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "CSV на пределе строк", contentType: contentCSV, body: csvRows(maxImportRows, "netflix"), wantStatus: http.StatusOK},
+		{name: "CSV больше предела строк", contentType: contentCSV, body: csvRows(maxImportRows+1, "netflix"), wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed},
+		{name: "JSON Lines на пределе строк", contentType: contentJSONLines, body: jsonRows(maxImportRows), wantStatus: http.StatusOK},
+		{name: "JSON Lines больше предела строк", contentType: contentJSONLines, body: jsonRows(maxImportRows + 1), wantStatus: http.StatusBadRequest, wantCode: base.CodeValidationFailed},
+		{
+			name:        "CSV больше 10 МБ",
+			contentType: contentCSV,
+			body:        csvRows(MaxImportBytes/2000+1, strings.Repeat("n", 2000)),
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    codePayloadTooLarge,
+		},
+		{
+			name:        "JSON Lines больше 10 МБ",
+			contentType: contentJSONLines,
+			body:        `{"service_name":"` + strings.Repeat("n", MaxImportBytes) + `"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    codePayloadTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// dry_run проверяет разбор без записи десяти тысяч подписок
+			w := importRequest(t, base.NewMemoryStore(), "dry_run=true", tt.contentType, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %.200s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode != "" && problemCode(t, w) != tt.wantCode {
+				t.Errorf("код ошибки не %s", tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"effective_mobile/logging"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader — заголовок с ID запроса
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает длину принятого ID, чтобы клиент не раздувал логи
+const maxRequestIDLength = 128
+
+// RequestID берёт ID запроса из X-Request-ID или генерирует новый,
+// сохраняет его в контексте для логов и возвращает клиенту в том же заголовке
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID пропускает только короткие ID из печатных символов без пробелов,
+// чтобы через заголовок нельзя было подделать строки лога
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog пишет по строке на каждый запрос: метод, путь, шаблон маршрута, статус, размер ответа и время.
+// Ответы 5xx пишутся с уровнем error, 4xx — warn.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case isProbe(r) && status < 400:
+			// оркестратор опрашивает пробы каждые несколько секунд, успешные ответы не интересны
+			level = slog.LevelDebug
+		case isProbe(r):
+			level = slog.LevelWarn
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		slog.LogAttrs(r.Context(), level, "HTTP-запрос",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", routePattern(r)),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// isProbe сообщает, что запрос — проверка живости или готовности
+func isProbe(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/readyz"
+}
+
+// Recoverer перехватывает панику обработчика, пишет её в лог со стеком и отвечает 500
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			slog.ErrorContext(r.Context(), "Паника при обработке запроса",
+				slog.Any("panic", rec),
+				slog.String("stack", string(debug.Stack())),
+			)
+			writeProblem(w, r, Problem{
+				Status: http.StatusInternalServerError,
+				Code:   codeInternalError,
+				Detail: "внутренняя ошибка сервера",
+			})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PriceChangeRequest представляет запрос на изменение цены подписки
+type PriceChangeRequest struct {
+	// Новая стоимость месячной подписки
+	Price int `json:"price" example:"599"`
+	// Месяц, с которого действует цена, в формате MM-YYYY
+	EffectiveFrom string `json:"effective_from" example:"03-2025"`
+}
+
+// HandlerAddPriceChange добавляет изменение цены подписки
+// @Summary Изменить цену подписки
+// @Description Записывает новую цену, действующую с указанного месяца. Прошлые месяцы продолжают считаться по старой цене.
+// @Tags prices
+// @Accept json
+// @Produce json
+// @Param id path int true "ID подписки"
+// @Param change body PriceChangeRequest true "Новая цена"
+// @Success 201 {object} base.PriceChange
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 404 {object} Problem "Подписка не найдена"
+// @Failure 409 {object} Problem "Подписка удалена"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при изменении цены"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Подписка принадлежит другому пользователю"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscription/{id}/prices [post]
+func HandlerAddPriceChange(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id, err := subscriptionID(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := authorizeSubscription(store, r, strconv.Itoa(id)); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var reqData PriceChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+			writeError(w, r, invalidJSON(err))
+			return
+		}
+
+		effectiveFrom, err := time.Parse("01-2006", reqData.EffectiveFrom)
+		if err != nil {
+			writeError(w, r, base.InvalidField("effective_from", "обязательное поле в формате MM-YYYY"))
+			return
+		}
+
+		change, err := store.AddPriceChange(r.Context(), base.PriceChange{
+			SubscriptionID: id,
+			Price:          reqData.Price,
+			EffectiveFrom:  effectiveFrom,
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(change)
+	}
+}
+
+// HandlerGetPriceHistory возвращает историю цен подписки
+// @Summary История цен подписки
+// @Description Возвращает все цены подписки по возрастанию даты начала действия
+// @Tags prices
+// @Produce json
+// @Param id path int true "ID подписки"
+// @Success 200 {array} base.PriceChange
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 404 {object} Problem "Подписка не найдена"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении истории цен"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Подписка принадлежит другому пользователю"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /subscription/{id}/prices [get]
+func HandlerGetPriceHistory(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if err := authorizeSubscription(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		history, err := store.SelectPriceHistory(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(history)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"effective_mobile/auth"
+	"effective_mobile/ratelimit"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit ограничивает частоту запросов к группе маршрутов group корзиной токенов с лимитом limit.
+// У каждого клиента (API-ключа, пользователя или IP-адреса) своя корзина в каждой группе,
+// поэтому, например, дорогие запросы стоимости не расходуют бюджет чтения.
+// Ответы содержат заголовки RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset и RateLimit-Policy,
+// а отклонённые запросы получают 429 с Retry-After.
+// Если хранилище недоступно, запрос пропускается: отказ лимитера не должен останавливать API.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return rateLimit(store, group, limit, rateLimitClient)
+}
+
+// RateLimitByIP ограничивает частоту запросов с одного IP-адреса, кто бы их ни отправлял. Ставится перед
+// аутентификацией, чтобы поток запросов без учётных данных или с подобранными API-ключами не доходил до БД.
+func RateLimitByIP(store ratelimit.Store, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return rateLimit(store, "ip", limit, func(r *http.Request) string { return "ip:" + clientIP(r) })
+}
+
+// rateLimit — общая часть RateLimit и RateLimitByIP; client возвращает корзину запроса внутри группы
+func rateLimit(store ratelimit.Store, group string, limit ratelimit.Limit, client func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !limit.Enabled() {
+			return next
+		}
+		policy := fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := store.Take(r.Context(), group+":"+client(r), limit, time.Now())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Ошибка ограничителя частоты, запрос пропущен без ограничения", "group", group, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			h.Set("RateLimit-Policy", policy)
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				writeProblem(w, r, Problem{
+					Status: http.StatusTooManyRequests,
+					Code:   codeRateLimited,
+					Detail: fmt.Sprintf("превышен лимит запросов (%s), повторите через %d с", limit, ceilSeconds(res.RetryAfter)),
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitClient определяет, чей бюджет расходует запрос: API-ключа, пользователя или, без них
+// (например, при AUTH_DISABLED), IP-адреса
+func rateLimitClient(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		switch {
+		case p.APIKeyID != 0:
+			return "key:" + strconv.Itoa(p.APIKeyID)
+		case p.UserID != "":
+			return "user:" + p.UserID
+		}
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// clientIP возвращает IP-адрес клиента; за доверенным прокси RemoteAddr уже заменён middleware.RealIP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
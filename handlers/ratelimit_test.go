@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"effective_mobile/auth"
+	"effective_mobile/ratelimit"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// okHandler отвечает 200 и считает дошедшие до него запросы
+type okHandler struct{ calls int }
+
+func (h *okHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.calls++
+	w.WriteHeader(http.StatusOK)
+}
+
+// failingLimitStore — хранилище корзин, которое всегда недоступно
+type failingLimitStore struct{}
+
+func (failingLimitStore) Take(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("redis недоступен")
+}
+
+func requestFrom(remoteAddr string, p *auth.Principal) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/subscriptions/1", nil)
+	r.RemoteAddr = remoteAddr
+	if p != nil {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), *p))
+	}
+	return r
+}
+
+func TestRateLimit(t *testing.T) {
+	next := &okHandler{}
+	h := RateLimit(ratelimit.NewMemoryStore(), "read", ratelimit.Limit{Requests: 2, Period: time.Minute})(next)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, requestFrom("10.0.0.1:5000", &auth.Principal{UserID: "alice"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "30",
+		"RateLimit-Policy":    "2;w=60",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), requestFrom("10.0.0.1:5000", &auth.Principal{UserID: "alice"}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, requestFrom("10.0.0.2:5000", &auth.Principal{UserID: "alice"}))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("третий запрос пользователя: status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Code != codeRateLimited {
+		t.Errorf("тело ответа %+v, %v, want code %s", p, err, codeRateLimited)
+	}
+
+	// у другого пользователя, API-ключа и анонимного клиента свои корзины
+	for name, r := range map[string]*http.Request{
+		"другой пользователь": requestFrom("10.0.0.1:5000", &auth.Principal{UserID: "bob"}),
+		"API-ключ":            requestFrom("10.0.0.1:5000", &auth.Principal{UserID: "alice", APIKeyID: 7}),
+		"без аутентификации":  requestFrom("10.0.0.1:5000", nil),
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", name, w.Code)
+		}
+	}
+	if next.calls != 5 {
+		t.Errorf("до обработчика дошло %d запросов, want 5", next.calls)
+	}
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	h := RateLimitByIP(ratelimit.NewMemoryStore(), ratelimit.Limit{Requests: 1, Period: time.Minute})(&okHandler{})
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{name: "первый запрос", r: requestFrom("10.0.0.1:5000", &auth.Principal{UserID: "alice"}), want: http.StatusOK},
+		// корзина общая для всех запросов с одного адреса, кто бы их ни отправлял
+		{name: "другой пользователь", r: requestFrom("10.0.0.1:6000", &auth.Principal{UserID: "bob"}), want: http.StatusTooManyRequests},
+		{name: "без аутентификации", r: requestFrom("10.0.0.1:7000", nil), want: http.StatusTooManyRequests},
+		{name: "другой адрес", r: requestFrom("10.0.0.2:5000", nil), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, tt.r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRateLimitPassThrough(t *testing.T) {
+	tests := []struct {
+		name  string
+		store ratelimit.Store
+		limit ratelimit.Limit
+	}{
+		{name: "лимит отключён", store: failingLimitStore{}, limit: ratelimit.Limit{}},
+		{name: "хранилище недоступно", store: failingLimitStore{}, limit: ratelimit.Limit{Requests: 1, Period: time.Minute}},
+	}
+	for _, tt := range tests {
+		next := &okHandler{}
+		h := RateLimit(tt.store, "read", tt.limit)(next)
+		for i := 0; i < 3; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), requestFrom("10.0.0.1:5000", nil))
+		}
+		if next.calls != 3 {
+			t.Errorf("%s: до обработчика дошло %d запросов из 3", tt.name, next.calls)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ExchangeRateRequest представляет курс валюты на месяц
+type ExchangeRateRequest struct {
+	// Код валюты ISO 4217
+	Currency string `json:"currency" example:"USD"`
+	// Месяц в формате MM-YYYY
+	Month string `json:"month" example:"01-2024"`
+	// Сколько рублей стоит одна единица валюты
+	Rate float64 `json:"rate" example:"92.5"`
+}
+
+// HandlerUploadExchangeRates загружает курсы валют
+// @Summary Загрузить курсы валют
+// @Description Принимает JSON-массив курсов или CSV-файл (Content-Type: text/csv) со строками currency,month,rate. Курсы на те же месяцы заменяются.
+// @Tags admin
+// @Accept json
+// @Accept text/csv
+// @Produce json
+// @Param rates body []ExchangeRateRequest true "Курсы валют к рублю"
+// @Success 200 {object} map[string]interface{} "Количество загруженных курсов"
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при сохранении курсов"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Требуется роль администратора"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /admin/exchange-rates [post]
+func HandlerUploadExchangeRates(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		var rates []base.ExchangeRate
+		var err error
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			rates, err = base.ParseExchangeRatesCSV(r.Body)
+		} else {
+			rates, err = decodeExchangeRates(r)
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if len(rates) == 0 {
+			writeError(w, r, base.InvalidField("rates", "не передано ни одного курса"))
+			return
+		}
+
+		if err := store.UpsertExchangeRates(r.Context(), rates); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{"loaded": len(rates)})
+	}
+}
+
+// HandlerGetExchangeRates возвращает загруженные курсы валют
+// @Summary Получить курсы валют
+// @Description Возвращает загруженные курсы валют к рублю, опционально по одной валюте
+// @Tags admin
+// @Produce json
+// @Param currency query string false "Код валюты ISO 4217"
+// @Success 200 {array} base.ExchangeRate
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении курсов"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Требуется роль администратора"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /admin/exchange-rates [get]
+func HandlerGetExchangeRates(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		rates, err := store.SelectExchangeRates(r.Context(), strings.ToUpper(r.URL.Query().Get("currency")))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(rates)
+	}
+}
+
+// decodeExchangeRates разбирает и валидирует JSON-массив курсов
+func decodeExchangeRates(r *http.Request) ([]base.ExchangeRate, error) {
+	var reqData []ExchangeRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+		return nil, invalidJSON(err)
+	}
+
+	rates := make([]base.ExchangeRate, 0, len(reqData))
+	for i, item := range reqData {
+		prefix := fmt.Sprintf("[%d]", i)
+		month, err := time.Parse("01-2006", item.Month)
+		if err != nil {
+			return nil, base.InvalidField(prefix+".month", "неверный формат, используйте MM-YYYY")
+		}
+		rate := base.ExchangeRate{Currency: strings.ToUpper(item.Currency), Month: month, Rate: item.Rate}
+		if err := base.ValidateExchangeRate(rate); err != nil {
+			return nil, base.WithFieldPrefix(err, prefix)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"effective_mobile/base"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ReminderSettingsRequest представляет запрос на изменение настроек напоминаний
+type ReminderSettingsRequest struct {
+	// За сколько дней до списания или окончания подписки напоминать, от 1 до 30
+	WindowDays int `json:"window_days" example:"3"`
+	// false отключает напоминания пользователю, по умолчанию true
+	Enabled *bool `json:"enabled" example:"true"`
+}
+
+// HandlerGetReminderSettings возвращает настройки напоминаний пользователя
+// @Summary Настройки напоминаний
+// @Description Если пользователь не менял настройки, возвращаются настройки по умолчанию без updated_at
+// @Tags reminders
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Success 200 {object} base.ReminderSettings
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении настроек"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /reminders/{user_id}/settings [get]
+func HandlerGetReminderSettings(store base.SubscriptionStore, defaultWindow int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		userID := chi.URLParam(r, "user_id")
+		if err := authorizeUser(r, userID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		settings, err := store.SelectReminderSettings(r.Context(), userID)
+		if errors.Is(err, base.ErrReminderSettingsNotFound) {
+			settings, err = base.ReminderSettings{UserID: userID, WindowDays: defaultWindow, Enabled: true}, nil
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
+
+// HandlerUpdateReminderSettings сохраняет настройки напоминаний пользователя
+// @Summary Изменить настройки напоминаний
+// @Description Напоминание о списании или окончании подписки отправляется, когда до него остаётся не больше window_days дней
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Param settings body ReminderSettingsRequest true "Настройки напоминаний"
+// @Success 200 {object} base.ReminderSettings
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при сохранении настроек"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /reminders/{user_id}/settings [put]
+func HandlerUpdateReminderSettings(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		userID := chi.URLParam(r, "user_id")
+		if err := authorizeUser(r, userID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var reqData ReminderSettingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+			writeError(w, r, invalidJSON(err))
+			return
+		}
+
+		settings := base.ReminderSettings{UserID: userID, WindowDays: reqData.WindowDays, Enabled: true}
+		if reqData.Enabled != nil {
+			settings.Enabled = *reqData.Enabled
+		}
+		settings, err := store.UpsertReminderSettings(r.Context(), settings)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Настройки напоминаний изменены", "user_id", userID,
+			"window_days", settings.WindowDays, "enabled", settings.Enabled)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceRoute называет span запроса по шаблону маршрута chi, например "GET /cost/{user_id}".
+// Сам span создаёт otelhttp снаружи роутера, когда маршрут ещё неизвестен, поэтому имя задаётся после обработки.
+func TraceRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		route := routePattern(r)
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+	})
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"effective_mobile/auth"
+	"effective_mobile/base"
+	"effective_mobile/webhooks"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// WebhookRequest описывает регистрируемый вебхук
+type WebhookRequest struct {
+	// Адрес, на который POST-запросом отправляются события
+	URL string `json:"url" example:"https://billing.example.com/hooks/subscriptions"`
+	// Чьи события получать. Без него вебхук получает события самого вызывающего,
+	// а у администратора и API-ключа без привязки к пользователю — события всех пользователей
+	UserID string `json:"user_id,omitempty"`
+	// Типы событий: subscription.created, subscription.updated, subscription.deleted, subscription.expiring; пусто — все
+	EventTypes []string `json:"event_types" example:"subscription.created,subscription.deleted"`
+	// Ключ подписи HMAC-SHA256 не короче 16 символов; без него генерируется
+	Secret string `json:"secret,omitempty"`
+}
+
+// HandlerCreateWebhook регистрирует вебхук
+// @Summary Зарегистрировать вебхук
+// @Description События подписок отправляются POST-запросом с телом base.WebhookEvent. Заголовок X-Webhook-Signature (t=<unix-время>,v1=<hex>) содержит HMAC-SHA256 строки "<t>.<тело>" на ключе secret.
+// @Description Ключ возвращается только в этом ответе. Адреса во внутренних сетях (loopback, link-local, частные) отклоняются, кроме сетей из WEBHOOK_ALLOW_PRIVATE.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body WebhookRequest true "Параметры вебхука"
+// @Success 201 {object} base.WebhookEndpoint
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при создании вебхука"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks [post]
+func HandlerCreateWebhook(store base.SubscriptionStore, policy webhooks.AddressPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		var reqData WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+			writeError(w, r, invalidJSON(err))
+			return
+		}
+
+		userID, err := targetUserID(r, reqData.UserID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		secret := reqData.Secret
+		if secret == "" {
+			if secret, err = webhooks.GenerateSecret(); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+
+		if err := policy.CheckURL(r.Context(), reqData.URL); err != nil {
+			writeError(w, r, base.InvalidField("url", err.Error()))
+			return
+		}
+
+		endpoint, err := store.InsertWebhookEndpoint(r.Context(), base.WebhookEndpoint{
+			URL:        reqData.URL,
+			Secret:     secret,
+			UserID:     userID,
+			EventTypes: reqData.EventTypes,
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Вебхук зарегистрирован", "webhook_id", endpoint.ID, "user_id", endpoint.UserID,
+			"event_types", endpoint.EventTypes)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(endpoint)
+	}
+}
+
+// HandlerGetWebhooks возвращает вебхуки
+// @Summary Список вебхуков
+// @Description Без user_id пользователь получает свои вебхуки, а администратор и API-ключ без привязки к пользователю — все вебхуки
+// @Tags webhooks
+// @Produce json
+// @Param user_id query string false "ID пользователя"
+// @Success 200 {array} base.WebhookEndpoint
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 403 {object} Problem "Нет доступа к данным другого пользователя"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении вебхуков"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks [get]
+func HandlerGetWebhooks(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		userID, err := targetUserID(r, r.URL.Query().Get("user_id"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		endpoints, err := store.SelectWebhookEndpoints(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		for i := range endpoints {
+			endpoints[i].Secret = ""
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(endpoints)
+	}
+}
+
+// HandlerGetWebhook возвращает вебхук по ID
+// @Summary Получить вебхук
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} base.WebhookEndpoint
+// @Failure 400 {object} Problem "Некорректный ID"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 404 {object} Problem "Вебхук не найден"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении вебхука"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks/{id} [get]
+func HandlerGetWebhook(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		endpoint, err := authorizeWebhook(store, r, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		endpoint.Secret = ""
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(endpoint)
+	}
+}
+
+// HandlerDeleteWebhook удаляет вебхук
+// @Summary Удалить вебхук
+// @Description Удаляет вебхук вместе с журналом его доставок
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} map[string]interface{} "ID удалённого вебхука"
+// @Failure 400 {object} Problem "Некорректный ID"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 404 {object} Problem "Вебхук не найден"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при удалении вебхука"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks/{id} [delete]
+func HandlerDeleteWebhook(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if _, err := authorizeWebhook(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := store.DeleteWebhookEndpoint(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+	}
+}
+
+// HandlerEnableWebhook включает вебхук, отключённый после ошибок доставки
+// @Summary Включить вебхук
+// @Description Обнуляет счётчик ошибок подряд. Доставки, помеченные failed при отключении, можно отправить заново через replay.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} base.WebhookEndpoint
+// @Failure 400 {object} Problem "Некорректный ID"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 404 {object} Problem "Вебхук не найден"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при включении вебхука"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks/{id}/enable [post]
+func HandlerEnableWebhook(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if _, err := authorizeWebhook(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		endpoint, err := store.EnableWebhookEndpoint(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		endpoint.Secret = ""
+
+		slog.InfoContext(r.Context(), "Вебхук включён", "webhook_id", endpoint.ID)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(endpoint)
+	}
+}
+
+// HandlerGetWebhookDeliveries возвращает журнал доставок вебхука
+// @Summary Журнал доставок вебхука
+// @Description Последние доставки, новые первыми, с итогом последней попытки
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Param status query string false "Только доставки с этим статусом" Enums(pending, succeeded, failed)
+// @Param limit query int false "Сколько доставок вернуть, по умолчанию 50, не больше 500"
+// @Success 200 {array} base.WebhookDelivery
+// @Failure 400 {object} Problem "Ошибка валидации запроса"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 404 {object} Problem "Вебхук не найден"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при получении журнала"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks/{id}/deliveries [get]
+func HandlerGetWebhookDeliveries(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if _, err := authorizeWebhook(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		q := r.URL.Query()
+		status := q.Get("status")
+		switch status {
+		case "", base.DeliveryPending, base.DeliverySucceeded, base.DeliveryFailed:
+		default:
+			writeError(w, r, base.InvalidField("status", "ожидается pending, succeeded или failed"))
+			return
+		}
+		limit := base.DefaultPageLimit
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > base.MaxPageLimit {
+				writeError(w, r, base.InvalidField("limit", fmt.Sprintf("должен быть положительным числом (максимум %d)", base.MaxPageLimit)))
+				return
+			}
+			limit = n
+		}
+
+		deliveries, err := store.SelectWebhookDeliveries(r.Context(), id, status, limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(deliveries)
+	}
+}
+
+// HandlerReplayWebhookDelivery отправляет событие доставки заново
+// @Summary Повторить доставку
+// @Description Ставит событие в очередь новой доставкой с тем же ID события, по которому получатель может отбросить уже обработанный повтор
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Param delivery_id path int true "ID доставки"
+// @Success 202 {object} base.WebhookDelivery
+// @Failure 400 {object} Problem "Некорректный ID"
+// @Failure 401 {object} Problem "Требуется аутентификация"
+// @Failure 404 {object} Problem "Вебхук или доставка не найдены"
+// @Failure 429 {object} Problem "Превышен лимит запросов"
+// @Failure 500 {object} Problem "Ошибка сервера при повторе доставки"
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func HandlerReplayWebhookDelivery(store base.SubscriptionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.DebugContext(r.Context(), "Получен запрос", "method", r.Method, "path", r.URL.Path)
+
+		id := chi.URLParam(r, "id")
+		if _, err := authorizeWebhook(store, r, id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		delivery, err := store.ReplayWebhookDelivery(r.Context(), id, chi.URLParam(r, "delivery_id"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Доставка вебхука поставлена в очередь заново", "webhook_id", id,
+			"delivery_id", delivery.ID, "event_id", delivery.EventID)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+	}
+}
+
+// authorizeWebhook возвращает вебхук id, если он доступен вызывающему. Вебхук без user_id доступен только тем,
+// кто работает с данными всех пользователей; чужие вебхуки выглядят как несуществующие.
+func authorizeWebhook(store base.SubscriptionStore, r *http.Request, id string) (base.WebhookEndpoint, error) {
+	endpoint, err := store.SelectWebhookEndpoint(r.Context(), id)
+	if err != nil {
+		return endpoint, err
+	}
+	p, ok := auth.FromContext(r.Context())
+	if !ok || (endpoint.UserID == "" && !p.CanAccessAll()) || !p.CanAccess(endpoint.UserID) {
+		return base.WebhookEndpoint{}, base.ErrWebhookNotFound
+	}
+	return endpoint, nil
+}
@@ -1,12 +1,31 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"effective_mobile/auth"
 	"effective_mobile/base"
+	"effective_mobile/config"
 	"effective_mobile/handlers"
+	"effective_mobile/logging"
+	"effective_mobile/metrics"
+	"effective_mobile/outbox"
+	"effective_mobile/ratelimit"
+	"effective_mobile/reminders"
+	"effective_mobile/tracing"
+	"effective_mobile/webhooks"
 
 	_ "effective_mobile/docs" // docs генерируется автоматически
 
@@ -14,6 +33,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // @title           Effective Mobile Subscription API
@@ -27,25 +47,224 @@ import (
 // @BasePath  /
 
 // @schemes http
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT в формате "Bearer <token>"; sub — ID пользователя, roles: ["admin"] даёт доступ ко всем пользователям
+
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description API-ключ сервиса; доступные маршруты определяются его областями
 func main() {
-	err := godotenv.Load()
+	migrate := flag.String("migrate", "", "применить (up) или откатить (down) миграции и завершить работу")
+	migrateSteps := flag.Int("migrate-steps", 1, "сколько последних миграций откатить при -migrate=down")
+	importRates := flag.String("import-rates", "", "загрузить курсы валют из CSV-файла (currency,month,rate) и завершить работу")
+	createAPIKey := flag.String("create-api-key", "", "создать API-ключ с указанным названием, вывести его и завершить работу")
+	apiKeyScopes := flag.String("api-key-scopes", auth.ScopeAdmin, "области доступа для -create-api-key через запятую")
+	printConfig := flag.Bool("print-config", false, "вывести итоговые настройки (секреты скрыты) и завершить работу")
+	config.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	// .env необязателен: в контейнерах настройки обычно приходят из настоящих переменных окружения
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fatal("Ошибка загрузки .env файла", err)
+	}
+
+	cfg, err := config.Load(flag.CommandLine)
 	if err != nil {
-		log.Fatal("Ошибка загрузки .env файла")
+		fatal("Ошибка чтения настроек", err)
+	}
+	if *printConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fatal("Ошибка вывода настроек", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			fatal("Некорректные настройки", err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Некорректные настройки", err)
 	}
+
+	if err := logging.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		fatal("Ошибка настройки логирования", err)
+	}
+
+	if *migrate != "" {
+		if err := runMigrations(cfg.DB, *migrate, *migrateSteps); err != nil {
+			fatal("Ошибка миграций", err)
+		}
+		return
+	}
+
 	// Подключение к базе данных
-	db, err := base.CreateDB()
+	db, err := base.CreateDB(cfg.DB)
 	if err != nil {
-		log.Printf("Ошибка подключения к БД: %v", err)
+		slog.Error("Ошибка подключения к БД", "error", err)
 		return
 	}
 	defer db.Close()
 
+	store := base.NewPostgresStore(db)
+
+	if err := metrics.RegisterDBStats(db, cfg.DB.Name); err != nil {
+		fatal("Ошибка регистрации метрик пула соединений", err)
+	}
+	err = metrics.RegisterActiveSubscriptions(func() (int, error) {
+		return store.CountActiveSubscriptions(context.Background(), time.Now())
+	})
+	if err != nil {
+		fatal("Ошибка регистрации метрик подписок", err)
+	}
+
+	if *importRates != "" {
+		if err := importExchangeRates(store, *importRates); err != nil {
+			fatal("Ошибка загрузки курсов валют", err)
+		}
+		return
+	}
+
+	if *createAPIKey != "" {
+		if err := createAPIKeyCLI(store, *createAPIKey, *apiKeyScopes); err != nil {
+			fatal("Ошибка создания API-ключа", err)
+		}
+		return
+	}
+
+	// ctx отменяется по SIGINT/SIGTERM: фоновые задачи останавливаются, а сервер дорабатывает текущие запросы
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// фоновые задачи пишут в БД, поэтому перед её закрытием их нужно дождаться
+	var jobs backgroundJobs
+
+	// Окончательно удаляем подписки, мягко удалённые дольше срока хранения
+	jobs.Go(func() { base.RunPurgeJob(ctx, store, cfg.Purge.DeletedRetention, cfg.Purge.Interval) })
+
+	// Удаляем истёкшие ключи идемпотентности
+	jobs.Go(func() { base.RunIdempotencyPurgeJob(ctx, store, cfg.Idempotency.TTL) })
+
+	// Напоминаем о предстоящих списаниях и окончании подписок; напоминания об окончании
+	// заодно становятся событиями subscription.expiring для вебхуков
+	if cfg.Reminders.Interval > 0 {
+		channels := append(newReminderChannels(cfg.Reminders), webhooks.NewExpiringChannel(store))
+		scheduler := reminders.NewScheduler(store, channels, cfg.Reminders.WindowDays)
+		jobs.Go(func() { scheduler.Run(ctx, cfg.Reminders.Interval) })
+	}
+
+	// Публикуем события об изменениях подписок, записанные в outbox вместе с изменениями,
+	// и удаляем уже опубликованные, даже если публикует другой экземпляр сервиса
+	jobs.Go(func() { outbox.RunPurgeJob(ctx, store, cfg.Outbox.Retention) })
+	if cfg.Outbox.PollInterval > 0 {
+		publishers, err := newOutboxPublishers(cfg.Outbox, store)
+		if err != nil {
+			fatal("Ошибка настройки публикации событий", err)
+		}
+		dispatcher := outbox.NewDispatcher(store, publishers, cfg.Outbox)
+		jobs.Go(func() { dispatcher.Run(ctx) })
+	}
+
+	// Вебхуки не отправляются во внутренние сети, кроме явно разрешённых
+	webhookPolicy, err := webhooks.NewAddressPolicy(cfg.Webhooks.AllowedPrivateNetworks())
+	if err != nil {
+		fatal("Ошибка настройки адресов вебхуков", err)
+	}
+
+	// Доставляем события подписок зарегистрированным вебхукам
+	if cfg.Webhooks.PollInterval > 0 {
+		dispatcher := webhooks.NewDispatcher(store, cfg.Webhooks, webhookPolicy)
+		jobs.Go(func() { dispatcher.Run(ctx) })
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal("Ошибка настройки трассировки", err)
+	}
+
+	authMiddleware, err := newAuthMiddleware(cfg.Auth, store)
+	if err != nil {
+		fatal("Ошибка настройки аутентификации", err)
+	}
+
+	limits, err := newRateLimiters(cfg.RateLimit)
+	if err != nil {
+		fatal("Ошибка настройки ограничения частоты", err)
+	}
+
+	health := newHealth(db, cfg.Server.HealthTimeout)
+
 	// Создаём новый роутер
 	r := chi.NewRouter()
 
 	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	if cfg.Server.TrustProxyHeaders {
+		// IP клиента берётся из X-Forwarded-For / X-Real-IP — включать только за доверенным прокси
+		r.Use(middleware.RealIP)
+	}
+	r.Use(handlers.RequestID)
+	r.Use(handlers.AccessLog)
+	r.Use(handlers.Metrics)
+	r.Use(handlers.TraceRoute)
+	r.Use(handlers.Recoverer)
+	r.NotFound(handlers.HandlerNotFound)
+	r.MethodNotAllowed(handlers.HandlerMethodNotAllowed)
+
+	r.Get("/swagger/*", httpSwagger.WrapHandler)
+	r.Handle("/metrics", metrics.Handler())     // Метрики Prometheus
+	r.Get("/healthz", health.HandlerLiveness()) // Живость процесса
+	r.Get("/readyz", health.HandlerReadiness()) // Готовность: БД и миграции
+
+	// Все маршруты API требуют аутентификации; лимит по IP-адресу стоит перед ней, чтобы отсекать
+	// потоки запросов без учётных данных и перебор API-ключей до обращения к БД
+	r.Group(func(r chi.Router) {
+		r.Use(limits.ip, authMiddleware)
+		registerRoutes(r, store, limits, cfg.Reminders.WindowDays, cfg.Idempotency.TTL, webhookPolicy)
+	})
+
+	// Запускаем сервер и ждём сигнала остановки
+	serveErr := serve(ctx, newServer(cfg.Server, newTracingHandler(r)), health, cfg.Server)
+	if serveErr != nil {
+		slog.Error("Ошибка работы сервера", "error", serveErr)
+	}
+
+	// сервер мог остановиться и без сигнала, из-за ошибки запуска
+	stop()
+	slog.Info("Ожидание фоновых задач", "timeout", cfg.Server.ShutdownTimeout.String())
+	if !jobs.Wait(cfg.Server.ShutdownTimeout) {
+		slog.Warn("Фоновые задачи не завершились вовремя, их последние итоги могут не записаться")
+	}
+
+	slog.Info("Отправка накопленных трассировок")
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Не удалось отправить трассировки", "error", err)
+	}
+	cancel()
+
+	slog.Info("Закрытие соединений с БД")
+	if err := db.Close(); err != nil {
+		slog.Warn("Ошибка закрытия соединений с БД", "error", err)
+	}
+
+	slog.Info("Сервер остановлен")
+	if serveErr != nil {
+		os.Exit(1)
+	}
+}
+
+// registerRoutes регистрирует маршруты API; пользователю доступны только его подписки,
+// а API-ключу — только маршруты его областей доступа
+func registerRoutes(r chi.Router, store base.SubscriptionStore, limits rateLimiters, reminderWindow int, idempotencyTTL time.Duration,
+	webhookPolicy webhooks.AddressPolicy) {
+	read := r.With(limits.read, handlers.RequireScope(auth.ScopeSubscriptionsRead))
+	write := r.With(limits.write, handlers.RequireScope(auth.ScopeSubscriptionsWrite))
+	// создание подписок можно безопасно повторять с заголовком Idempotency-Key
+	create := write.With(handlers.Idempotency(store, idempotencyTTL, handlers.MaxSubscriptionBytes))
+	importer := write.With(handlers.Idempotency(store, idempotencyTTL, handlers.MaxImportBytes))
+	costRead := r.With(limits.cost, handlers.RequireScope(auth.ScopeCostRead))
 
 	// @Summary      Добавить подписку
 	// @Description  Создает новую подписку пользователя
@@ -54,10 +273,10 @@ func main() {
 	// @Produce      json
 	// @Param        subscription  body      base.Subscription  true  "Подписка"
 	// @Success      200           {object}  map[string]interface{}
-	// @Failure      400           {object}  map[string]string
-	// @Failure      500           {object}  map[string]string
+	// @Failure      400           {object}  handlers.Problem
+	// @Failure      500           {object}  handlers.Problem
 	// @Router       /subscription [post]
-	r.Post("/subscription", handlers.HandlerAddSubscription(db))
+	create.Post("/subscription", handlers.HandlerAddSubscription(store))
 
 	// @Summary      Обновить подписку по ID
 	// @Description  Обновляет подписку с указанным ID
@@ -67,10 +286,10 @@ func main() {
 	// @Param        id            path      string             true  "ID подписки"
 	// @Param        subscription  body      base.Subscription  true  "Подписка"
 	// @Success      200           {object}  map[string]string
-	// @Failure      400           {object}  map[string]string
-	// @Failure      500           {object}  map[string]string
+	// @Failure      400           {object}  handlers.Problem
+	// @Failure      500           {object}  handlers.Problem
 	// @Router       /subscription/{id} [put]
-	r.Put("/subscription/{id}", handlers.HandlerUpdateSubscription(db))
+	write.Put("/subscription/{id}", handlers.HandlerUpdateSubscription(store))
 
 	// @Summary      Удалить подписку по ID
 	// @Description  Удаляет подписку с указанным ID
@@ -78,10 +297,10 @@ func main() {
 	// @Produce      json
 	// @Param        id  path  string  true  "ID подписки"
 	// @Success      200 {object} map[string]interface{}
-	// @Failure      400 {object} map[string]string
-	// @Failure      500 {object} map[string]string
+	// @Failure      400 {object} handlers.Problem
+	// @Failure      500 {object} handlers.Problem
 	// @Router       /subscription/{id} [delete]
-	r.Delete("/subscription/{id}", handlers.HandlerDeleteSubscription(db))
+	write.Delete("/subscription/{id}", handlers.HandlerDeleteSubscription(store))
 
 	// @Summary      Получить подписку по ID
 	// @Description  Возвращает подписку по ID
@@ -89,10 +308,16 @@ func main() {
 	// @Produce      json
 	// @Param        id  path  string  true  "ID подписки"
 	// @Success      200 {object} base.Subscription
-	// @Failure      400 {object} map[string]string
-	// @Failure      404 {object} map[string]string
+	// @Failure      400 {object} handlers.Problem
+	// @Failure      404 {object} handlers.Problem
 	// @Router       /subscription/{id} [get]
-	r.Get("/subscription/{id}", handlers.HandlerGetSubscriptionByID(db))
+	read.Get("/subscription/{id}", handlers.HandlerGetSubscriptionByID(store))
+
+	write.Post("/subscription/{id}/restore", handlers.HandlerRestoreSubscription(store)) // Восстановить мягко удалённую подписку
+	read.Get("/subscription/{id}/deletions", handlers.HandlerGetDeletionHistory(store))  // История удалений подписки
+
+	write.Post("/subscription/{id}/prices", handlers.HandlerAddPriceChange(store)) // Новая цена, действующая с указанного месяца
+	read.Get("/subscription/{id}/prices", handlers.HandlerGetPriceHistory(store))  // История цен подписки
 
 	// @Summary      Получить подписки пользователя
 	// @Description  Возвращает все подписки пользователя по user_id
@@ -100,9 +325,10 @@ func main() {
 	// @Produce      json
 	// @Param        user_id  path  string  true  "ID пользователя"
 	// @Success      200      {array} base.Subscription
-	// @Failure      400      {object} map[string]string
+	// @Failure      400      {object} handlers.Problem
 	// @Router       /subscriptions/{user_id} [get]
-	r.Get("/subscriptions/{user_id}", handlers.HandlerGetSubscriptionsByUserID(db)) // Получить все подписки пользователя
+	read.Get("/subscriptions/{user_id}", handlers.HandlerGetSubscriptionsByUserID(store)) // Получить все подписки пользователя
+	importer.Post("/subscriptions/import", handlers.HandlerImportSubscriptions(store))    // Импорт подписок из CSV или JSON Lines
 
 	// @Summary      Получить суммарную стоимость подписок
 	// @Description  Возвращает сумму затрат пользователя за период (с фильтром по сервису)
@@ -111,16 +337,246 @@ func main() {
 	// @Produce      json
 	// @Param        body  body  handlers.CostRequest  true  "Параметры фильтра"
 	// @Success      200   {object} handlers.CostResponse
-	// @Failure      400   {object} map[string]string
-	// @Failure      500   {object} map[string]string
+	// @Failure      400   {object} handlers.Problem
+	// @Failure      500   {object} handlers.Problem
 	// @Router       /cost [post]
-	r.Get("/cost/{user_id}", handlers.CostSummary(db)) // Суммарные траты, например GET /cost/abc123?start=2024-01&end=2024-07&service_name=Netflix
+	costRead.Get("/cost/{user_id}", handlers.CostSummary(store)) // Суммарные траты, например GET /cost/abc123?start=2024-01&end=2024-07&service_name=Netflix
 
-	r.Get("/swagger/*", httpSwagger.WrapHandler)
-	// Запускаем сервер
-	fmt.Println("Сервер запущен на http://localhost:8080")
-	err = http.ListenAndServe(":8080", r)
+	// Настройки напоминаний о списаниях и окончании подписок
+	read.Get("/reminders/{user_id}/settings", handlers.HandlerGetReminderSettings(store, reminderWindow))
+	write.Put("/reminders/{user_id}/settings", handlers.HandlerUpdateReminderSettings(store))
+
+	// Выгрузки в CSV, NDJSON и XLSX, например GET /export/subscriptions?format=xlsx&date_format=DD.MM.YYYY
+	r.With(limits.export, handlers.RequireScope(auth.ScopeSubscriptionsRead)).Get("/export/subscriptions", handlers.HandlerExportSubscriptions(store))
+	r.With(limits.export, handlers.RequireScope(auth.ScopeCostRead)).Get("/export/cost", handlers.HandlerExportCost(store))
+
+	// Вебхуки событий подписок и журнал их доставок
+	hooksRead := r.With(limits.read, handlers.RequireScope(auth.ScopeWebhooks))
+	hooksWrite := r.With(limits.write, handlers.RequireScope(auth.ScopeWebhooks))
+	hooksWrite.Post("/webhooks", handlers.HandlerCreateWebhook(store, webhookPolicy))
+	hooksRead.Get("/webhooks", handlers.HandlerGetWebhooks(store))
+	hooksRead.Get("/webhooks/{id}", handlers.HandlerGetWebhook(store))
+	hooksWrite.Delete("/webhooks/{id}", handlers.HandlerDeleteWebhook(store))
+	hooksWrite.Post("/webhooks/{id}/enable", handlers.HandlerEnableWebhook(store))                                  // Включить вебхук, отключённый после ошибок
+	hooksRead.Get("/webhooks/{id}/deliveries", handlers.HandlerGetWebhookDeliveries(store))                         // Журнал доставок
+	hooksWrite.Post("/webhooks/{id}/deliveries/{delivery_id}/replay", handlers.HandlerReplayWebhookDelivery(store)) // Отправить событие заново
+
+	// Административные маршруты доступны только с ролью admin или API-ключу с областью admin
+	r.Group(func(r chi.Router) {
+		r.Use(limits.admin, handlers.RequireAdmin)
+		r.Post("/admin/exchange-rates", handlers.HandlerUploadExchangeRates(store)) // Загрузка курсов валют (JSON или CSV)
+		r.Get("/admin/exchange-rates", handlers.HandlerGetExchangeRates(store))     // Загруженные курсы валют
+
+		r.Post("/admin/api-keys", handlers.HandlerCreateAPIKey(store))        // Новый API-ключ
+		r.Get("/admin/api-keys", handlers.HandlerGetAPIKeys(store))           // Список API-ключей
+		r.Delete("/admin/api-keys/{id}", handlers.HandlerRevokeAPIKey(store)) // Отзыв API-ключа
+	})
+}
+
+// newAuthMiddleware настраивает проверку JWT по настройкам cfg и API-ключей по хранилищу.
+// Без ключей JWT принимаются только API-ключи.
+// AUTH_DISABLED=true отключает аутентификацию и даёт всем запросам права администратора — только для локальной разработки.
+func newAuthMiddleware(cfg config.AuthConfig, store base.SubscriptionStore) (func(http.Handler) http.Handler, error) {
+	if cfg.Disabled {
+		slog.Warn("Аутентификация отключена (AUTH_DISABLED=true), API открыт для всех")
+		return handlers.AnonymousAdmin, nil
+	}
+
+	if cfg.HMACSecret == "" && cfg.RSAPublicKeyFile == "" && cfg.JWKSFile == "" {
+		slog.Info("Ключи JWT не заданы, доступ только по API-ключам")
+		return handlers.Authenticate(nil, store), nil
+	}
+
+	verifier, err := auth.NewVerifier(auth.Config{
+		HMACSecret:       cfg.HMACSecret,
+		RSAPublicKeyFile: cfg.RSAPublicKeyFile,
+		JWKSFile:         cfg.JWKSFile,
+		Issuer:           cfg.Issuer,
+		Audience:         cfg.Audience,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return handlers.Authenticate(verifier, store), nil
+}
+
+// newHealth настраивает проверки готовности: БД отвечает на ping, и все встроенные миграции применены.
+// Ограничитель частоты не проверяется: при недоступном Redis он пропускает запросы.
+func newHealth(db *sql.DB, timeout time.Duration) *handlers.Health {
+	health := handlers.NewHealth(timeout)
+	health.AddCheck("database", db.PingContext)
+	health.AddCheck("migrations", func(ctx context.Context) error {
+		pending, err := base.PendingMigrations(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("не применены миграции %v", pending)
+		}
+		return nil
+	})
+	return health
+}
+
+// newTracingHandler принимает traceparent входящих запросов и открывает span на каждый запрос.
+// Сбор метрик Prometheus и проверки живости и готовности не трассируются, чтобы не засорять трассировки.
+func newTracingHandler(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/metrics", "/healthz", "/readyz":
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// newReminderChannels создаёт каналы доставки напоминаний из REMINDER_CHANNELS; названия проверены в config.Validate
+func newReminderChannels(cfg config.ReminderConfig) []reminders.Channel {
+	var channels []reminders.Channel
+	for _, name := range cfg.ChannelNames() {
+		switch name {
+		case "log":
+			channels = append(channels, reminders.LogChannel{})
+		case "webhook":
+			channels = append(channels, reminders.NewWebhookChannel(cfg.WebhookURL, cfg.WebhookTimeout))
+		}
+	}
+	slog.Info("Напоминания включены", "interval", cfg.Interval.String(), "window_days", cfg.WindowDays, "channels", cfg.ChannelNames())
+	return channels
+}
+
+// newOutboxPublishers создаёт публикаторов событий из OUTBOX_PUBLISHERS; названия проверены в config.Validate
+func newOutboxPublishers(cfg config.OutboxConfig, store base.SubscriptionStore) ([]outbox.Publisher, error) {
+	var publishers []outbox.Publisher
+	for _, name := range cfg.PublisherNames() {
+		switch name {
+		case "webhooks":
+			publishers = append(publishers, webhooks.NewPublisher(store))
+		case "file":
+			p, err := outbox.NewFilePublisher(cfg.File)
+			if err != nil {
+				return nil, err
+			}
+			publishers = append(publishers, p)
+		case "nats":
+			p, err := outbox.NewNATSPublisher(cfg.NATSURL, cfg.NATSSubject, cfg.NATSTimeout)
+			if err != nil {
+				return nil, err
+			}
+			publishers = append(publishers, p)
+		}
+	}
+	slog.Info("Публикация событий включена", "interval", cfg.PollInterval.String(), "publishers", cfg.PublisherNames())
+	return publishers, nil
+}
+
+// rateLimiters — ограничители частоты для групп маршрутов; у каждой группы свой бюджет
+type rateLimiters struct {
+	ip, read, write, cost, export, admin func(http.Handler) http.Handler
+}
+
+// newRateLimiters настраивает ограничение частоты по настройкам cfg; лимит off отключает ограничение группы.
+// RATE_LIMIT_STORE=redis хранит корзины в Redis по адресу RATE_LIMIT_REDIS_URL, чтобы экземпляры сервиса делили бюджет.
+func newRateLimiters(cfg config.RateLimitConfig) (rateLimiters, error) {
+	var store ratelimit.Store
+	switch cfg.Store {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		redisStore, err := ratelimit.NewRedisStoreFromURL(ctx, cfg.RedisURL)
+		if err != nil {
+			return rateLimiters{}, err
+		}
+		store = redisStore
+	default:
+		return rateLimiters{}, fmt.Errorf("неизвестное хранилище RATE_LIMIT_STORE=%q, ожидается memory или redis", cfg.Store)
+	}
+	slog.Info("Лимиты запросов", "ip", cfg.IP.String(), "read", cfg.Read.String(), "write", cfg.Write.String(), "cost", cfg.Cost.String(), "export", cfg.Export.String(), "admin", cfg.Admin.String())
+
+	return rateLimiters{
+		ip:     handlers.RateLimitByIP(store, cfg.IP),
+		read:   handlers.RateLimit(store, "read", cfg.Read),
+		write:  handlers.RateLimit(store, "write", cfg.Write),
+		cost:   handlers.RateLimit(store, "cost", cfg.Cost),
+		export: handlers.RateLimit(store, "export", cfg.Export),
+		admin:  handlers.RateLimit(store, "admin", cfg.Admin),
+	}, nil
+}
+
+// runMigrations выполняет миграции вручную, без запуска сервера
+func runMigrations(cfg config.DBConfig, direction string, steps int) error {
+	db, err := base.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch direction {
+	case "up":
+		return base.MigrateUp(db)
+	case "down":
+		return base.MigrateDown(db, steps)
+	default:
+		return fmt.Errorf("неизвестное направление %q, ожидается up или down", direction)
+	}
+}
+
+// importExchangeRates загружает курсы валют из CSV-файла
+func importExchangeRates(store base.SubscriptionStore, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rates, err := base.ParseExchangeRatesCSV(f)
 	if err != nil {
-		log.Fatalf("Ошибка запуска сервера: %v", err)
+		return err
+	}
+	if err := store.UpsertExchangeRates(context.Background(), rates); err != nil {
+		return err
 	}
+
+	slog.Info("Загружены курсы валют", "count", len(rates))
+	return nil
+}
+
+// fatal пишет ошибку в лог и завершает процесс
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// createAPIKeyCLI создаёт API-ключ из командной строки, например первый ключ администратора
+func createAPIKeyCLI(store base.SubscriptionStore, name, scopes string) error {
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+
+	var scopeList []string
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if !auth.IsScope(scope) {
+			return fmt.Errorf("неизвестная область доступа %q", scope)
+		}
+		scopeList = append(scopeList, scope)
+	}
+
+	apiKey, err := store.InsertAPIKey(context.Background(), base.APIKey{
+		Name:   name,
+		Prefix: key[:len(auth.APIKeyPrefix)+5],
+		Scopes: scopeList,
+	}, hash)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Создан API-ключ", "api_key_id", apiKey.ID, "name", apiKey.Name, "scopes", apiKey.Scopes)
+	fmt.Println(key)
+	return nil
 }
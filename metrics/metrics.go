@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace — общий префикс метрик сервиса
+const namespace = "subscriptions"
+
+var (
+	// HTTPRequests считает запросы по методу, шаблону маршрута chi и статусу ответа
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Количество HTTP-запросов по методу, шаблону маршрута и статусу.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration — время обработки запросов по методу, шаблону маршрута и статусу
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Время обработки HTTP-запросов в секундах.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// DBQueryDuration — время выполнения функций хранилища PostgreSQL
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Время выполнения запросов к БД по функции хранилища в секундах.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"function"})
+
+	// CostCalculations считает подсчёты стоимости по типу фильтра
+	CostCalculations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_calculations_total",
+		Help:      "Количество подсчётов стоимости по фильтру сервиса, разбивке и пропорциональному расчёту.",
+	}, []string{"filter", "breakdown", "proration"})
+
+	// RemindersSent считает отправки напоминаний по виду, каналу и результату
+	RemindersSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reminders_sent_total",
+		Help:      "Количество отправок напоминаний по виду (renewal, expiry), каналу и результату (sent, error).",
+	}, []string{"kind", "channel", "status"})
+
+	// WebhookDeliveries считает попытки доставки вебхуков по типу события и итоговому статусу доставки
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Количество попыток доставки вебхуков по типу события и статусу после попытки (succeeded, pending, failed).",
+	}, []string{"event", "status"})
+
+	// OutboxPublishes считает попытки публикации событий outbox по публикатору и результату
+	OutboxPublishes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_publishes_total",
+		Help:      "Количество попыток публикации событий outbox по публикатору и результату (published, error).",
+	}, []string{"publisher", "status"})
+
+	// OutboxLag измеряет задержку от изменения подписки до публикации события о нём
+	OutboxLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbox_lag_seconds",
+		Help:      "Время от записи события outbox до его публикации всеми публикаторами.",
+		Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300, 1800},
+	})
+)
+
+// ObserveQuery засекает время выполнения функции хранилища:
+//
+//	defer metrics.ObserveQuery("InsertSubscription")()
+func ObserveQuery(function string) func() {
+	start := time.Now()
+	return func() {
+		DBQueryDuration.WithLabelValues(function).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterDBStats публикует статистику пула соединений sql.DB.Stats() (метрики go_sql_*)
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterActiveSubscriptions публикует число активных подписок.
+// count вызывается при каждом сборе метрик, поэтому значение всегда актуально.
+func RegisterActiveSubscriptions(count func() (int, error)) error {
+	return prometheus.Register(&activeSubscriptionsCollector{
+		count: count,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active"),
+			"Количество неудалённых подписок, действующих на текущую дату.",
+			nil, nil,
+		),
+	})
+}
+
+type activeSubscriptionsCollector struct {
+	count func() (int, error)
+	desc  *prometheus.Desc
+}
+
+func (c *activeSubscriptionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *activeSubscriptionsCollector) Collect(ch chan<- prometheus.Metric) {
+	n, err := c.count()
+	if err != nil {
+		slog.Error("Ошибка подсчёта активных подписок для метрик", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
+
+// Handler отдаёт метрики в текстовом формате Prometheus.
+// Ошибка одной метрики не срывает весь сбор: остальные метрики всё равно отдаются.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
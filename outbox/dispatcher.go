@@ -0,0 +1,117 @@
+// Package outbox публикует события об изменениях подписок, записанные в outbox_events
+// в одной транзакции с самими изменениями
+package outbox
+
+import (
+	"context"
+	"effective_mobile/base"
+	"effective_mobile/config"
+	"effective_mobile/metrics"
+	"effective_mobile/retry"
+	"log/slog"
+	"time"
+)
+
+// purgeInterval — как часто удалять опубликованные события старше OUTBOX_RETENTION
+const purgeInterval = time.Hour
+
+// Dispatcher пересылает события из outbox_events всем публикаторам. Событие отмечается опубликованным,
+// только когда его приняли все публикаторы, а при ошибке публикуется заново целиком, поэтому доставка —
+// «хотя бы один раз»: получатели должны отбрасывать повторы по ID события.
+// События одной подписки публикуются строго по порядку, следующее — только после предыдущего.
+type Dispatcher struct {
+	store      base.SubscriptionStore
+	publishers []Publisher
+	cfg        config.OutboxConfig
+}
+
+// NewDispatcher создаёт пересыльщика событий по настройкам cfg
+func NewDispatcher(store base.SubscriptionStore, publishers []Publisher, cfg config.OutboxConfig) *Dispatcher {
+	return &Dispatcher{store: store, publishers: publishers, cfg: cfg}
+}
+
+// Run публикует события каждые cfg.PollInterval, пока не отменён ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// пачка содержит по одному событию на подписку, поэтому за ней могут ждать следующие события тех же подписок
+			for d.relayBatch(ctx) > 0 && ctx.Err() == nil {
+			}
+		}
+	}
+}
+
+// relayBatch публикует одну пачку событий и возвращает число опубликованных
+func (d *Dispatcher) relayBatch(ctx context.Context) int {
+	// события откладываются на время, за которое пачка гарантированно будет опубликована
+	lease := time.Duration(d.cfg.BatchSize)*d.cfg.NATSTimeout + time.Minute
+	events, err := d.store.ClaimOutboxEvents(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка выборки событий outbox", "error", err)
+		return 0
+	}
+
+	var published int
+	for _, e := range events {
+		if d.relay(ctx, e) {
+			published++
+		}
+	}
+	return published
+}
+
+// relay публикует событие всеми публикаторами и записывает итог; возвращает true, если событие опубликовано
+func (d *Dispatcher) relay(ctx context.Context, e base.OutboxEvent) bool {
+	log := slog.With("event_id", e.ID, "event", e.Type, "subscription_id", e.SubscriptionID)
+
+	// публикаторы уже могли принять событие, поэтому его судьба записывается и после отмены ctx
+	storeCtx := context.WithoutCancel(ctx)
+	for _, p := range d.publishers {
+		if err := p.Publish(ctx, e); err != nil {
+			metrics.OutboxPublishes.WithLabelValues(p.Name(), "error").Inc()
+			attempts := e.Attempts + 1
+			delay := retry.Backoff(attempts, d.cfg.RetryBackoff, d.cfg.MaxRetryBackoff)
+			log.WarnContext(ctx, "Ошибка публикации события", "publisher", p.Name(), "attempt", attempts, "retry_in", delay, "error", err)
+			if err := d.store.RetryOutboxEvent(storeCtx, e.ID, p.Name()+": "+err.Error(), time.Now().Add(delay)); err != nil {
+				log.ErrorContext(ctx, "Ошибка записи неудачной публикации события", "error", err)
+			}
+			return false
+		}
+		metrics.OutboxPublishes.WithLabelValues(p.Name(), "published").Inc()
+	}
+
+	if err := d.store.MarkOutboxEventPublished(storeCtx, e.ID); err != nil {
+		// событие опубликуют повторно по истечении lease
+		log.ErrorContext(ctx, "Ошибка отметки события опубликованным", "error", err)
+		return false
+	}
+	metrics.OutboxLag.Observe(time.Since(e.CreatedAt).Seconds())
+	return true
+}
+
+// RunPurgeJob раз в час удаляет опубликованные события старше retention, пока не отменён ctx.
+// Работает и без Dispatcher: события может публиковать другой экземпляр сервиса, а записываются они всегда.
+func RunPurgeJob(ctx context.Context, store base.SubscriptionStore, retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.PurgePublishedOutboxEvents(ctx, time.Now().Add(-retention))
+			if err != nil {
+				slog.ErrorContext(ctx, "Ошибка очистки опубликованных событий outbox", "error", err)
+			} else if n > 0 {
+				slog.InfoContext(ctx, "Удалены опубликованные события outbox", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"context"
+	"effective_mobile/base"
+	"effective_mobile/config"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakePublisher запоминает принятые события и отклоняет первые failures попыток
+type fakePublisher struct {
+	name      string
+	failures  int
+	attempts  int
+	published []string
+}
+
+func (p *fakePublisher) Name() string { return p.name }
+
+func (p *fakePublisher) Publish(_ context.Context, e base.OutboxEvent) error {
+	p.attempts++
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("недоступен")
+	}
+	p.published = append(p.published, e.Type+"/"+strconv.Itoa(e.SubscriptionID))
+	return nil
+}
+
+func newTestDispatcher(t *testing.T, publishers ...Publisher) (*Dispatcher, *base.MemoryStore) {
+	t.Helper()
+
+	store := base.NewMemoryStore()
+	cfg := config.OutboxConfig{
+		BatchSize:   10,
+		NATSTimeout: time.Second,
+		// повтор сразу, чтобы следующая пачка забрала событие снова
+		RetryBackoff:    time.Nanosecond,
+		MaxRetryBackoff: time.Nanosecond,
+	}
+	return NewDispatcher(store, publishers, cfg), store
+}
+
+func insert(t *testing.T, store base.SubscriptionStore, service string) int {
+	t.Helper()
+
+	id, err := store.InsertSubscription(context.Background(), base.Subscription{
+		UserID: "60601fee-2bf1-4721-ae6f-7636e79a0cba", Service: service, Price: 400,
+		StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("InsertSubscription: %v", err)
+	}
+	return id
+}
+
+func TestDispatcherPublishesInOrder(t *testing.T) {
+	file := &fakePublisher{name: "file"}
+	d, store := newTestDispatcher(t, file)
+	first, second := insert(t, store, "netflix"), insert(t, store, "spotify")
+	if err := store.DeleteSubscription(context.Background(), strconv.Itoa(first)); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+
+	// в пачке по одному событию на подписку, поэтому удаление уходит следующей пачкой
+	if n := d.relayBatch(context.Background()); n != 2 {
+		t.Fatalf("первая пачка: %d событий, want 2", n)
+	}
+	if n := d.relayBatch(context.Background()); n != 1 {
+		t.Fatalf("вторая пачка: %d событий, want 1", n)
+	}
+	if n := d.relayBatch(context.Background()); n != 0 {
+		t.Fatalf("третья пачка: %d событий, want 0", n)
+	}
+
+	want := []string{
+		base.EventSubscriptionCreated + "/" + strconv.Itoa(first),
+		base.EventSubscriptionCreated + "/" + strconv.Itoa(second),
+		base.EventSubscriptionDeleted + "/" + strconv.Itoa(first),
+	}
+	if !slices.Equal(file.published, want) {
+		t.Errorf("опубликованы %v, want %v", file.published, want)
+	}
+}
+
+func TestDispatcherRetriesWholeEvent(t *testing.T) {
+	file := &fakePublisher{name: "file"}
+	nats := &fakePublisher{name: "nats", failures: 1}
+	d, store := newTestDispatcher(t, file, nats)
+	id := insert(t, store, "netflix")
+	if err := store.DeleteSubscription(context.Background(), strconv.Itoa(id)); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+
+	// ошибка второго публикатора не даёт отметить событие и пропустить вперёд удаление
+	if n := d.relayBatch(context.Background()); n != 0 {
+		t.Fatalf("пачка с ошибкой: опубликовано %d, want 0", n)
+	}
+	time.Sleep(time.Millisecond)
+	for d.relayBatch(context.Background()) > 0 {
+	}
+
+	created := base.EventSubscriptionCreated + "/" + strconv.Itoa(id)
+	deleted := base.EventSubscriptionDeleted + "/" + strconv.Itoa(id)
+	// первый публикатор получает событие повторно: доставка «хотя бы один раз»
+	if want := []string{created, created, deleted}; !slices.Equal(file.published, want) {
+		t.Errorf("file: %v, want %v", file.published, want)
+	}
+	if want := []string{created, deleted}; !slices.Equal(nats.published, want) {
+		t.Errorf("nats: %v, want %v", nats.published, want)
+	}
+
+	events, err := store.ClaimOutboxEvents(context.Background(), 10, time.Minute)
+	if err != nil || len(events) != 0 {
+		t.Errorf("неопубликованные события: %+v, %v", events, err)
+	}
+}
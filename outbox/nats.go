@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"effective_mobile/base"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPublisher публикует события в NATS по текстовому протоколу клиента, без внешних зависимостей.
+// Событие уходит в тему <subject>.<тип события>; публикация подтверждается обменом PING/PONG,
+// поэтому ошибка сервера (например, нет прав на тему) не потеряется. Если сервер поддерживает заголовки,
+// в Nats-Msg-Id передаётся ID события, и поток JetStream с окном дедупликации отбросит повторы.
+type NATSPublisher struct {
+	url     *url.URL
+	subject string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	headers bool // сервер принимает HPUB
+}
+
+// natsInfo — нужные поля сообщения INFO, которым сервер NATS приветствует клиента
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+}
+
+// NewNATSPublisher создаёт публикатора для сервера rawURL (nats://[user:password@]host:port, tls:// — с TLS).
+// Подключение устанавливается при первой публикации и восстанавливается после ошибок.
+func NewNATSPublisher(rawURL, subject string, timeout time.Duration) (*NATSPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("адрес NATS должен начинаться с nats:// или tls://, получено %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATSPublisher{url: u, subject: subject, timeout: timeout}, nil
+}
+
+func (*NATSPublisher) Name() string { return "nats" }
+
+func (p *NATSPublisher) Publish(ctx context.Context, event base.OutboxEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := p.publish(p.subject+"."+event.Type, strconv.FormatInt(event.ID, 10), payload); err != nil {
+		// после ошибки состояние соединения неизвестно, следующая публикация подключится заново
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// Close закрывает соединение с сервером
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closeLocked()
+}
+
+func (p *NATSPublisher) closeLocked() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.r = nil, nil
+	return err
+}
+
+// connect подключается к серверу, при необходимости включает TLS и представляется командой CONNECT
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.url.Host)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	r := bufio.NewReader(conn)
+	line, err := readLine(r)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	var info natsInfo
+	if op, args, _ := strings.Cut(line, " "); op != "INFO" || json.Unmarshal([]byte(args), &info) != nil {
+		conn.Close()
+		return fmt.Errorf("неожиданное приветствие сервера NATS: %q", line)
+	}
+
+	if info.TLSRequired || p.url.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.url.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "subscriptions-outbox",
+		"lang":     "go",
+		"version":  "1.0.0",
+		"protocol": 1,
+		"headers":  info.Headers,
+	}
+	if user := p.url.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			opts["user"], opts["pass"] = user.Username(), pass
+		} else {
+			opts["auth_token"] = user.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+
+	p.conn, p.r, p.headers = conn, r, info.Headers
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		p.closeLocked()
+		return err
+	}
+	if err := p.waitPong(); err != nil {
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// publish отправляет сообщение и ждёт PONG на следующий за ним PING: сервер обрабатывает команды по порядку,
+// поэтому PONG означает, что сообщение принято
+func (p *NATSPublisher) publish(subject, msgID string, payload []byte) error {
+	p.conn.SetDeadline(time.Now().Add(p.timeout))
+
+	w := bufio.NewWriter(p.conn)
+	if p.headers {
+		header := "NATS/1.0\r\nNats-Msg-Id: " + msgID + "\r\n\r\n"
+		fmt.Fprintf(w, "HPUB %s %d %d\r\n%s", subject, len(header), len(header)+len(payload), header)
+	} else {
+		fmt.Fprintf(w, "PUB %s %d\r\n", subject, len(payload))
+	}
+	w.Write(payload)
+	w.WriteString("\r\nPING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return p.waitPong()
+}
+
+// waitPong читает ответы сервера до PONG; -ERR означает, что сервер отверг предыдущую команду
+func (p *NATSPublisher) waitPong() error {
+	for {
+		line, err := readLine(p.r)
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch op {
+		case "PONG":
+			return nil
+		case "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("сервер NATS ответил ошибкой: %s", strings.Trim(args, "'"))
+		case "+OK", "INFO":
+		default:
+			return fmt.Errorf("неожиданный ответ сервера NATS: %q", line)
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if line != "" {
+			return "", errors.New("соединение с сервером NATS оборвалось посреди ответа")
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"context"
+	"effective_mobile/base"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Publisher — получатель событий outbox. Publish возвращает nil, только когда событие принято надёжно:
+// после этого оно отмечается опубликованным и больше не повторяется.
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, event base.OutboxEvent) error
+}
+
+// FilePublisher дописывает события в файл или стандартный вывод по строке JSON на событие
+type FilePublisher struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File // nil для стандартного вывода
+}
+
+// NewFilePublisher открывает файл path на дозапись; "-" означает стандартный вывод
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if path == "-" {
+		return &FilePublisher{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{w: f, file: f}, nil
+}
+
+func (*FilePublisher) Name() string { return "file" }
+
+func (p *FilePublisher) Publish(_ context.Context, event base.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(line); err != nil {
+		return err
+	}
+	if p.file != nil {
+		// событие считается опубликованным, только когда строка дошла до диска
+		return p.file.Sync()
+	}
+	return nil
+}
+
+// Close закрывает файл; стандартный вывод остаётся открытым
+func (p *FilePublisher) Close() error {
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit — бюджет корзины токенов: Requests запросов за Period.
+// Корзина вмещает Requests токенов и равномерно пополняется за Period, поэтому допускает всплеск до Requests запросов подряд.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled сообщает, задан ли лимит; нулевой Limit означает «без ограничений»
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// String возвращает лимит в формате ParseLimit, например 100/1m
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	// 1h0m0s -> 1h, 1m0s -> 1m
+	period := l.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, period)
+}
+
+// rate — скорость пополнения корзины в токенах за секунду
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseLimit разбирает лимит вида "100/1m" (100 запросов в минуту) или "10/s".
+// Пустая строка, "0" и "off" отключают ограничение.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || s == "off" {
+		return Limit{}, nil
+	}
+
+	n, period, found := strings.Cut(s, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("лимит %q: ожидается формат <запросов>/<период>, например 100/1m", s)
+	}
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("лимит %q: число запросов должно быть положительным", s)
+	}
+	// "10/s" — то же, что "10/1s"
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("лимит %q: некорректный период", s)
+	}
+
+	return Limit{Requests: requests, Period: d}, nil
+}
+
+// Result — итог попытки взять токен
+type Result struct {
+	Allowed    bool
+	Limit      int           // размер корзины
+	Remaining  int           // целых токенов осталось после запроса
+	Reset      time.Duration // через сколько корзина снова заполнится полностью
+	RetryAfter time.Duration // через сколько появится токен; только для отклонённых запросов
+}
+
+// Store хранит корзины токенов. Реализации должны изменять корзину атомарно,
+// чтобы параллельные запросы одного клиента не тратили один и тот же токен.
+type Store interface {
+	// Take забирает один токен из корзины key с лимитом limit
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*RedisStore)(nil)
+)
+
+// refill пополняет корзину за прошедшее время и забирает токен, если он есть.
+// Возвращает новое число токенов и признак успеха.
+func refill(limit Limit, tokens float64, elapsed time.Duration) (float64, bool) {
+	if elapsed > 0 {
+		tokens = math.Min(float64(limit.Requests), tokens+elapsed.Seconds()*limit.rate())
+	}
+	if tokens >= 1 {
+		return tokens - 1, true
+	}
+	return tokens, false
+}
+
+// result собирает Result по состоянию корзины после попытки
+func result(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "100/1m", want: Limit{Requests: 100, Period: time.Minute}},
+		{in: " 10/s ", want: Limit{Requests: 10, Period: time.Second}},
+		{in: "5/h", want: Limit{Requests: 5, Period: time.Hour}},
+		{in: "30/90s", want: Limit{Requests: 30, Period: 90 * time.Second}},
+		{in: "", want: Limit{}},
+		{in: "0", want: Limit{}},
+		{in: "off", want: Limit{}},
+		{in: "100", wantErr: true},
+		{in: "0/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "x/1m", wantErr: true},
+		{in: "10/", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		{in: "10/week", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q): err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimitString(t *testing.T) {
+	tests := []struct {
+		limit Limit
+		want  string
+	}{
+		{limit: Limit{}, want: "off"},
+		{limit: Limit{Requests: 100, Period: time.Minute}, want: "100/1m"},
+		{limit: Limit{Requests: 5, Period: time.Hour}, want: "5/1h"},
+		{limit: Limit{Requests: 10, Period: time.Second}, want: "10/1s"},
+		{limit: Limit{Requests: 30, Period: 90 * time.Second}, want: "30/1m30s"},
+	}
+	for _, tt := range tests {
+		if got := tt.limit.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.limit, got, tt.want)
+		}
+		// строка лимита разбирается обратно в тот же лимит
+		if parsed, err := ParseLimit(tt.want); err != nil || parsed != tt.limit {
+			t.Errorf("ParseLimit(%q) = %+v, %v, want %+v", tt.want, parsed, err, tt.limit)
+		}
+	}
+}
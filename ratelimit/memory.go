@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval — как часто MemoryStore удаляет корзины, которые уже заполнились
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // когда корзина заполнится и её можно забыть
+}
+
+// MemoryStore хранит корзины в памяти процесса.
+// Подходит для одного экземпляра сервиса; при нескольких экземплярах у каждого свой бюджет — используйте RedisStore.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore создаёт пустое хранилище корзин
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (m *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		m.buckets[key] = b
+	}
+
+	tokens, allowed := refill(limit, b.tokens, now.Sub(b.updated))
+	b.tokens = tokens
+	if now.After(b.updated) {
+		b.updated = now
+	}
+
+	res := result(limit, tokens, allowed)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep удаляет заполнившиеся корзины: новая корзина для того же ключа будет такой же
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
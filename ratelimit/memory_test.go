@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	take := func(key string, at time.Time) Result {
+		t.Helper()
+		res, err := store.Take(context.Background(), key, limit, at)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		return res
+	}
+
+	// полная корзина допускает всплеск в limit.Requests запросов
+	for i, remaining := range []int{2, 1, 0} {
+		res := take("a", now)
+		if !res.Allowed || res.Remaining != remaining || res.Limit != 3 {
+			t.Fatalf("запрос %d: %+v, want allowed with %d remaining", i+1, res, remaining)
+		}
+	}
+
+	res := take("a", now)
+	if res.Allowed {
+		t.Fatalf("запрос сверх лимита пропущен: %+v", res)
+	}
+	if res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("RetryAfter = %v, Reset = %v, want 1s and 3s", res.RetryAfter, res.Reset)
+	}
+
+	// у другого ключа своя корзина
+	if res := take("b", now); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("другой ключ: %+v", res)
+	}
+
+	// за секунду корзина пополняется на один токен
+	if res := take("a", now.Add(500*time.Millisecond)); res.Allowed {
+		t.Errorf("через 0.5s: %+v, want rejected", res)
+	}
+	if res := take("a", now.Add(time.Second)); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("через 1s: %+v, want allowed with 0 remaining", res)
+	}
+
+	// корзина не переполняется сверх limit.Requests
+	if res := take("a", now.Add(time.Hour)); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("через час: %+v, want allowed with 2 remaining", res)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 10, Period: time.Second}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := store.Take(context.Background(), key, limit, now); err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+	}
+	if _, err := store.Take(context.Background(), "c", limit, now.Add(sweepInterval)); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if _, ok := store.buckets["a"]; ok || len(store.buckets) != 1 {
+		t.Errorf("после очистки остались корзины: %v", store.buckets)
+	}
+}
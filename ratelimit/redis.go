@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript атомарно пополняет корзину и забирает токен.
+// Корзина — хеш {tokens, ts}; ключ истекает, когда корзина заполнилась бы полностью.
+// Дробное число токенов возвращается строкой: Lua приводит числа в ответе к целым.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore хранит корзины в Redis (или совместимом сервере — KeyDB, Valkey, Dragonfly),
+// поэтому все экземпляры сервиса делят общий бюджет клиента.
+// Время берётся из часов экземпляра, так что часы серверов должны быть синхронизированы.
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore создаёт хранилище поверх клиента Redis; prefix добавляется ко всем ключам
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// NewRedisStoreFromURL подключается к Redis по URL вида redis://[:password@]host:6379/0
+func NewRedisStoreFromURL(ctx context.Context, url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("разбор адреса Redis: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("подключение к Redis: %w", err)
+	}
+	return NewRedisStore(client, "ratelimit:"), nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	// скорость в токенах за миллисекунду, время в миллисекундах
+	rate := limit.rate() / 1000
+	reply, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, strconv.FormatFloat(rate, 'g', -1, 64), now.UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(reply) != 2 {
+		return Result{}, fmt.Errorf("неожиданный ответ Redis: %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensStr, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("неожиданное число токенов в ответе Redis: %q", tokensStr)
+	}
+
+	return result(limit, tokens, allowed == 1), nil
+}
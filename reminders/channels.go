@@ -0,0 +1,75 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"effective_mobile/base"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Channel — канал доставки напоминаний. Name попадает в отметку об отправке,
+// поэтому переименование канала приведёт к повторной отправке уже отправленных напоминаний.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, reminder base.Reminder) error
+}
+
+// LogChannel пишет напоминания в лог сервиса
+type LogChannel struct{}
+
+func (LogChannel) Name() string { return "log" }
+
+func (LogChannel) Send(ctx context.Context, r base.Reminder) error {
+	slog.InfoContext(ctx, "Напоминание о подписке", "kind", r.Kind, "subscription_id", r.SubscriptionID,
+		"user_id", r.UserID, "service_name", r.Service, "date", r.Date.Format(time.DateOnly))
+	return nil
+}
+
+// WebhookChannel отправляет напоминание POST-запросом с телом Event в формате JSON
+type WebhookChannel struct {
+	url    string
+	client *http.Client
+}
+
+// Event — тело запроса WebhookChannel
+type Event struct {
+	Type     string        `json:"type" example:"subscription.renewal_upcoming"` // subscription.renewal_upcoming или subscription.expiry_upcoming
+	Reminder base.Reminder `json:"reminder"`
+	SentAt   time.Time     `json:"sent_at"`
+}
+
+// NewWebhookChannel создаёт канал, отправляющий напоминания на url; timeout ограничивает один запрос
+func NewWebhookChannel(url string, timeout time.Duration) *WebhookChannel {
+	return &WebhookChannel{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (c *WebhookChannel) Name() string { return "webhook" }
+
+// Send считает напоминание доставленным только при ответе 2xx
+func (c *WebhookChannel) Send(ctx context.Context, r base.Reminder) error {
+	body, err := json.Marshal(Event{Type: "subscription." + r.Kind + "_upcoming", Reminder: r, SentAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("получатель ответил %s", resp.Status)
+	}
+	return nil
+}
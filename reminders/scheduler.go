@@ -0,0 +1,118 @@
+// Package reminders напоминает пользователям о предстоящих списаниях и окончании подписок
+package reminders
+
+import (
+	"context"
+	"effective_mobile/base"
+	"effective_mobile/metrics"
+	"log/slog"
+	"time"
+)
+
+// Scheduler периодически ищет подписки, у которых списание или окончание попадает в окно напоминаний
+// пользователя, и отправляет напоминания во все каналы. Каждое напоминание перед отправкой отмечается
+// в хранилище, поэтому перезапуски и несколько экземпляров сервиса не приводят к повторам.
+type Scheduler struct {
+	store         base.SubscriptionStore
+	channels      []Channel
+	defaultWindow int // окно в днях для пользователей без своих настроек
+}
+
+// NewScheduler создаёт планировщик напоминаний; defaultWindow — окно в днях по умолчанию
+func NewScheduler(store base.SubscriptionStore, channels []Channel, defaultWindow int) *Scheduler {
+	return &Scheduler{store: store, channels: channels, defaultWindow: defaultWindow}
+}
+
+// Run проверяет подписки сразу и затем каждые interval, пока не отменён ctx
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce — один проход планировщика; ошибки логируются, а неотправленные напоминания уйдут при следующем проходе
+func (s *Scheduler) runOnce(ctx context.Context, now time.Time) {
+	reminders, err := s.Upcoming(ctx, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка поиска подписок для напоминаний", "error", err)
+		return
+	}
+
+	var sent, failed int
+	for _, r := range reminders {
+		for _, ch := range s.channels {
+			ok, err := s.deliver(ctx, r, ch)
+			if err != nil {
+				slog.WarnContext(ctx, "Ошибка отправки напоминания", "channel", ch.Name(), "kind", r.Kind,
+					"subscription_id", r.SubscriptionID, "error", err)
+				failed++
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	if sent > 0 || failed > 0 {
+		slog.InfoContext(ctx, "Напоминания отправлены", "sent", sent, "failed", failed)
+	}
+}
+
+// Upcoming возвращает напоминания, которые пора отправить на дату now, в том числе уже отправленные
+func (s *Scheduler) Upcoming(ctx context.Context, now time.Time) ([]base.Reminder, error) {
+	all, err := s.store.SelectAllReminderSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]base.ReminderSettings, len(all))
+	for _, st := range all {
+		settings[st.UserID] = st
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// подписки, закончившиеся раньше сегодняшнего дня, ни списаний, ни окончания впереди не имеют
+	filter := base.SubscriptionFilter{EndFrom: today, SortBy: base.SortByID}
+
+	var reminders []base.Reminder
+	err = s.store.StreamSubscriptions(ctx, filter, func(sub base.Subscription) error {
+		window := s.defaultWindow
+		if st, ok := settings[sub.UserID]; ok {
+			if !st.Enabled {
+				return nil
+			}
+			window = st.WindowDays
+		}
+		reminders = append(reminders, base.UpcomingReminders(sub, today, today.AddDate(0, 0, window))...)
+		return nil
+	})
+	return reminders, err
+}
+
+// deliver отправляет напоминание в канал, если его ещё никто не отправил; false — напоминание уже отправлено.
+// Отметка ставится до отправки: при сбое процесса между ними напоминание потеряется, но не уйдёт дважды.
+func (s *Scheduler) deliver(ctx context.Context, r base.Reminder, ch Channel) (bool, error) {
+	claimed, err := s.store.ClaimReminder(ctx, r, ch.Name())
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	if err := ch.Send(ctx, r); err != nil {
+		metrics.RemindersSent.WithLabelValues(r.Kind, ch.Name(), "error").Inc()
+		// отметку снимаем и при отменённом ctx, иначе напоминание не уйдёт и после перезапуска
+		if releaseErr := s.store.ReleaseReminder(context.WithoutCancel(ctx), r, ch.Name()); releaseErr != nil {
+			slog.ErrorContext(ctx, "Ошибка снятия отметки напоминания", "subscription_id", r.SubscriptionID, "error", releaseErr)
+		}
+		return false, err
+	}
+	metrics.RemindersSent.WithLabelValues(r.Kind, ch.Name(), "sent").Inc()
+	return true, nil
+}
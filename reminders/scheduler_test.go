@@ -0,0 +1,154 @@
+package reminders
+
+import (
+	"context"
+	"effective_mobile/base"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordingChannel запоминает отправленные напоминания; пока fail не nil, отправка завершается этой ошибкой
+type recordingChannel struct {
+	name string
+	fail error
+	sent []string
+}
+
+func (c *recordingChannel) Name() string { return c.name }
+
+func (c *recordingChannel) Send(_ context.Context, r base.Reminder) error {
+	if c.fail != nil {
+		return c.fail
+	}
+	c.sent = append(c.sent, r.UserID+" "+r.Kind+" "+r.Date.Format("2006-01-02"))
+	return nil
+}
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// reminderStore заполняет хранилище подписками и настройками напоминаний пользователей
+func reminderStore(t *testing.T) base.SubscriptionStore {
+	t.Helper()
+	ctx := context.Background()
+	store := base.NewMemoryStore()
+	openEnd := day("9999-12-31")
+	for _, s := range []base.Subscription{
+		// списание 2024-03-15 попадает в окно по умолчанию (3 дня) от 2024-03-13
+		{UserID: "alice", Service: "netflix", Price: 400, StartDate: day("2024-01-15"), EndDate: openEnd},
+		// первое списание в день начала — не продление
+		{UserID: "alice", Service: "yandex", Price: 300, StartDate: day("2024-03-14"), EndDate: openEnd},
+		// напоминания выключены
+		{UserID: "bob", Service: "spotify", Price: 200, StartDate: day("2024-01-15"), EndDate: openEnd},
+		// окно в 1 день не дотягивает до списания
+		{UserID: "carol", Service: "apple", Price: 500, StartDate: day("2024-01-15"), EndDate: openEnd},
+		// окно в 10 дней захватывает и списание, и окончание
+		{UserID: "dave", Service: "zoom", Price: 100, StartDate: day("2024-01-15"), EndDate: day("2024-03-20")},
+		// закончилась до прохода
+		{UserID: "alice", Service: "okko", Price: 250, StartDate: day("2023-01-15"), EndDate: day("2024-03-12")},
+	} {
+		if _, err := store.InsertSubscription(ctx, s); err != nil {
+			t.Fatalf("InsertSubscription: %v", err)
+		}
+	}
+	for _, s := range []base.ReminderSettings{
+		{UserID: "bob", WindowDays: 30},
+		{UserID: "carol", WindowDays: 1, Enabled: true},
+		{UserID: "dave", WindowDays: 10, Enabled: true},
+	} {
+		if _, err := store.UpsertReminderSettings(ctx, s); err != nil {
+			t.Fatalf("UpsertReminderSettings: %v", err)
+		}
+	}
+	return store
+}
+
+func TestSchedulerUpcoming(t *testing.T) {
+	s := NewScheduler(reminderStore(t), nil, 3)
+	reminders, err := s.Upcoming(context.Background(), day("2024-03-13").Add(15*time.Hour))
+	if err != nil {
+		t.Fatalf("Upcoming: %v", err)
+	}
+
+	var got []string
+	for _, r := range reminders {
+		got = append(got, r.UserID+" "+r.Service+" "+r.Kind+" "+r.Date.Format("2006-01-02"))
+	}
+	want := []string{
+		"alice netflix renewal 2024-03-15",
+		"dave zoom renewal 2024-03-15",
+		"dave zoom expiry 2024-03-20",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSchedulerDeliversOnce(t *testing.T) {
+	ctx := context.Background()
+	store := reminderStore(t)
+	log := &recordingChannel{name: "log"}
+	webhook := &recordingChannel{name: "webhook"}
+	s := NewScheduler(store, []Channel{log, webhook}, 3)
+	now := day("2024-03-13")
+
+	s.runOnce(ctx, now)
+	want := []string{"alice renewal 2024-03-15", "dave renewal 2024-03-15", "dave expiry 2024-03-20"}
+	if !slices.Equal(log.sent, want) || !slices.Equal(webhook.sent, want) {
+		t.Fatalf("первый проход: log %v, webhook %v, want %v", log.sent, webhook.sent, want)
+	}
+
+	// ClaimReminder возвращает false для уже отправленных, поэтому повторные проходы ничего не шлют
+	s.runOnce(ctx, now)
+	s.runOnce(ctx, now.Add(12*time.Hour))
+	if len(log.sent) != len(want) || len(webhook.sent) != len(want) {
+		t.Errorf("повторные проходы отправили ещё: log %v, webhook %v", log.sent, webhook.sent)
+	}
+
+	// на следующий день окно carol дотягивает до списания, а отправленные напоминания не повторяются
+	s.runOnce(ctx, now.AddDate(0, 0, 1))
+	want = append(want, "carol renewal 2024-03-15")
+	if !slices.Equal(log.sent, want) {
+		t.Errorf("проход на следующий день: %v, want %v", log.sent, want)
+	}
+}
+
+func TestSchedulerRetriesFailedSend(t *testing.T) {
+	ctx := context.Background()
+	store := reminderStore(t)
+	log := &recordingChannel{name: "log"}
+	webhook := &recordingChannel{name: "webhook", fail: errors.New("вебхук недоступен")}
+	s := NewScheduler(store, []Channel{log, webhook}, 3)
+	now := day("2024-03-13")
+
+	s.runOnce(ctx, now)
+	if len(log.sent) != 3 || len(webhook.sent) != 0 {
+		t.Fatalf("ошибка одного канала помешала другому: log %v, webhook %v", log.sent, webhook.sent)
+	}
+
+	// ReleaseReminder сняла отметку, поэтому напоминание можно снова отметить
+	renewal := base.Reminder{Kind: base.ReminderRenewal, SubscriptionID: 1, Date: day("2024-03-15")}
+	if claimed, err := store.ClaimReminder(ctx, renewal, "webhook"); err != nil || !claimed {
+		t.Fatalf("отметка после неудачной отправки не снята: %v, %v", claimed, err)
+	}
+	if err := store.ReleaseReminder(ctx, renewal, "webhook"); err != nil {
+		t.Fatalf("ReleaseReminder: %v", err)
+	}
+
+	webhook.fail = nil
+	s.runOnce(ctx, now)
+	want := []string{"alice renewal 2024-03-15", "dave renewal 2024-03-15", "dave expiry 2024-03-20"}
+	if !slices.Equal(webhook.sent, want) {
+		t.Errorf("повтор после ошибки: %v, want %v", webhook.sent, want)
+	}
+	if len(log.sent) != 3 {
+		t.Errorf("успешный канал получил напоминания повторно: %v", log.sent)
+	}
+}
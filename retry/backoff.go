@@ -0,0 +1,20 @@
+// Package retry считает задержки повторов для фоновых задач, которые хранят очередь попыток в БД
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff возвращает задержку перед повтором после attempts неудачных попыток: base, 2·base, 4·base…
+// не больше maxDelay, со случайной добавкой до 10%, чтобы повторы разных задач не совпадали
+func Backoff(attempts int, base, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if attempts-1 < 32 {
+		delay = min(base<<(attempts-1), maxDelay)
+	}
+	if delay <= 0 {
+		delay = maxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
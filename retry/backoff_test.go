@@ -0,0 +1,32 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+		maxDelay time.Duration
+		want     time.Duration // задержка без случайной добавки
+	}{
+		{attempts: 1, base: time.Second, maxDelay: time.Hour, want: time.Second},
+		{attempts: 2, base: time.Second, maxDelay: time.Hour, want: 2 * time.Second},
+		{attempts: 5, base: time.Second, maxDelay: time.Hour, want: 16 * time.Second},
+		{attempts: 20, base: time.Second, maxDelay: time.Hour, want: time.Hour},
+		// сдвиг на большое число попыток не должен переполняться
+		{attempts: 40, base: time.Second, maxDelay: time.Hour, want: time.Hour},
+		{attempts: 1000, base: time.Minute, maxDelay: time.Hour, want: time.Hour},
+		{attempts: 3, base: 0, maxDelay: time.Minute, want: time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := Backoff(tt.attempts, tt.base, tt.maxDelay)
+			if got < tt.want || got > tt.want+tt.want/10 {
+				t.Fatalf("Backoff(%d, %v, %v) = %v, want %v + до 10%%", tt.attempts, tt.base, tt.maxDelay, got, tt.want)
+			}
+		}
+	}
+}
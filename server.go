@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"effective_mobile/config"
+	"effective_mobile/handlers"
+)
+
+// newServer создаёт HTTP-сервер с таймаутами из cfg
+func newServer(cfg config.ServerConfig, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// serve запускает сервер и работает до отмены ctx (SIGINT или SIGTERM).
+// При остановке /readyz сразу начинает отвечать 503, и в течение cfg.ShutdownDelay сервер ещё принимает запросы,
+// пока балансировщик не исключит экземпляр. Затем сервер перестаёт принимать соединения и ждёт текущие запросы
+// не дольше cfg.ShutdownTimeout, после чего оставшиеся соединения закрываются принудительно.
+func serve(ctx context.Context, srv *http.Server, health *handlers.Health, cfg config.ServerConfig) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	slog.Info("Сервер запущен", "addr", srv.Addr)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("запуск сервера: %w", err)
+	case <-ctx.Done():
+	}
+
+	health.SetShuttingDown()
+	if cfg.ShutdownDelay > 0 {
+		slog.Info("Получен сигнал остановки, сервис помечен как не готовый", "shutdown_delay", cfg.ShutdownDelay.String())
+		time.Sleep(cfg.ShutdownDelay)
+	}
+
+	slog.Info("Остановка сервера, новые соединения не принимаются", "shutdown_timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Не все запросы завершились вовремя, соединения закрываются принудительно", "error", err)
+		srv.Close()
+		return fmt.Errorf("остановка сервера: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	slog.Info("Текущие запросы завершены")
+	return nil
+}
+
+// backgroundJobs запускает фоновые задачи и при остановке ждёт их завершения, чтобы итоги последних попыток
+// (доставок вебхуков, публикаций outbox) успели записаться до закрытия соединений с БД
+type backgroundJobs struct {
+	wg sync.WaitGroup
+}
+
+// Go запускает задачу run; она должна завершиться после отмены своего контекста
+func (b *backgroundJobs) Go(run func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		run()
+	}()
+}
+
+// Wait ждёт завершения задач не дольше timeout и возвращает false, если не дождался
+func (b *backgroundJobs) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultServiceName — имя сервиса в трассировках, если не задан OTEL_SERVICE_NAME
+const defaultServiceName = "subscriptions"
+
+// Setup настраивает трассировку OpenTelemetry по переменной OTEL_TRACES_EXPORTER:
+//   - otlp — отправка по OTLP/HTTP; адрес и заголовки берутся из стандартных OTEL_EXPORTER_OTLP_*;
+//   - stdout — вывод span'ов в stdout, удобно для локальной проверки;
+//   - none или пусто — span'ы не экспортируются.
+//
+// Заголовки W3C traceparent/tracestate и baggage принимаются при любом экспортёре.
+// Возвращённую функцию нужно вызвать при остановке, чтобы отправить накопленные span'ы.
+func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var opt sdktrace.TracerProviderOption
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("экспортёр OTLP: %w", err)
+		}
+		opt = sdktrace.WithBatcher(exp)
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("экспортёр stdout: %w", err)
+		}
+		// без пакетирования span'ы видны сразу после запроса
+		opt = sdktrace.WithSyncer(exp)
+	default:
+		return nil, fmt.Errorf("неизвестный OTEL_TRACES_EXPORTER=%q, ожидается otlp, stdout или none", exporter)
+	}
+
+	// OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES переопределяют имя сервиса по умолчанию
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", defaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("описание ресурса: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(opt, sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
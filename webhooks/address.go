@@ -0,0 +1,99 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress — адрес вебхука ведёт во внутреннюю сеть
+var ErrForbiddenAddress = errors.New("адрес во внутренней сети недоступен для вебхуков")
+
+// AddressPolicy не даёт отправлять вебхуки на внутренние адреса: loopback, link-local, частные и служебные сети
+// и неуказанный адрес. Иначе любой пользователь мог бы через вебхук и журнал доставок опрашивать
+// сервисы рядом с нашим. Сети из allowed разрешены явно, например для получателя в той же сети.
+type AddressPolicy struct {
+	allowed []netip.Prefix
+}
+
+// NewAddressPolicy создаёт политику с разрешёнными сетями allowed в записи CIDR, например 10.20.0.0/16
+func NewAddressPolicy(allowed []string) (AddressPolicy, error) {
+	var p AddressPolicy
+	for _, s := range allowed {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return AddressPolicy{}, err
+		}
+		p.allowed = append(p.allowed, prefix.Masked())
+	}
+	return p, nil
+}
+
+// sharedPrefixes — служебные сети, которых нет среди IsPrivate, но которые тоже не ведут в интернет
+var sharedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT (RFC 6598), в облаках бывает внутренней сетью
+	netip.MustParsePrefix("198.18.0.0/15"), // сети для тестирования производительности (RFC 2544)
+}
+
+// CheckIP возвращает ErrForbiddenAddress для внутреннего адреса вне разрешённых сетей
+func (p AddressPolicy) CheckIP(ip netip.Addr) error {
+	ip = ip.Unmap()
+	for _, prefix := range p.allowed {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return ErrForbiddenAddress
+	}
+	for _, prefix := range sharedPrefixes {
+		if prefix.Contains(ip) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// CheckURL проверяет все адреса, в которые разрешается хост rawURL. Проверка при регистрации вебхука
+// отсекает очевидные случаи, а от подмены записи DNS после регистрации защищает проверка при подключении в Dialer.
+func (p AddressPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.CheckIP(ip)
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("не удалось разрешить имя %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if err := p.CheckIP(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dialer возвращает net.Dialer, который проверяет адрес каждого подключения уже после разрешения имени
+func (p AddressPolicy) Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return p.CheckIP(addrPort.Addr())
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAddressPolicyCheckIP(t *testing.T) {
+	policy, err := NewAddressPolicy([]string{"10.20.0.0/16", "fd00:1::1/64"})
+	if err != nil {
+		t.Fatalf("NewAddressPolicy: %v", err)
+	}
+
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{ip: "93.184.216.34"},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946"},
+		{ip: "127.0.0.1", forbidden: true},
+		{ip: "::1", forbidden: true},
+		{ip: "0.0.0.0", forbidden: true},
+		{ip: "::", forbidden: true},
+		{ip: "10.0.0.5", forbidden: true},
+		{ip: "172.16.3.4", forbidden: true},
+		{ip: "192.168.1.1", forbidden: true},
+		{ip: "169.254.169.254", forbidden: true}, // метаданные облака
+		{ip: "fe80::1", forbidden: true},
+		{ip: "fc00::1", forbidden: true},
+		{ip: "224.0.0.1", forbidden: true},
+		{ip: "100.64.0.1", forbidden: true}, // carrier-grade NAT
+		{ip: "100.127.255.254", forbidden: true},
+		{ip: "100.63.255.255"},
+		{ip: "100.128.0.1"},
+		{ip: "198.18.0.1", forbidden: true}, // сети для тестирования производительности
+		{ip: "198.19.255.255", forbidden: true},
+		{ip: "198.17.255.255"},
+		{ip: "198.20.0.1"},
+		{ip: "::ffff:100.64.0.1", forbidden: true},
+		{ip: "::ffff:127.0.0.1", forbidden: true}, // IPv4 внутри IPv6
+		{ip: "10.20.3.4"},                         // разрешённая сеть
+		{ip: "::ffff:10.20.3.4"},
+		{ip: "fd00:1::abcd"},
+		{ip: "fd00:2::1", forbidden: true},
+	}
+	for _, tt := range tests {
+		err := policy.CheckIP(netip.MustParseAddr(tt.ip))
+		if forbidden := errors.Is(err, ErrForbiddenAddress); forbidden != tt.forbidden || (err != nil && !forbidden) {
+			t.Errorf("CheckIP(%s) = %v, want forbidden %v", tt.ip, err, tt.forbidden)
+		}
+	}
+}
+
+func TestNewAddressPolicyInvalid(t *testing.T) {
+	for _, network := range []string{"10.20.0.0", "10.20.0.0/33", "internal"} {
+		if _, err := NewAddressPolicy([]string{network}); err == nil {
+			t.Errorf("NewAddressPolicy(%q) без ошибки", network)
+		}
+	}
+}
+
+func TestAddressPolicyCheckURL(t *testing.T) {
+	var policy AddressPolicy
+	tests := []struct {
+		url       string
+		forbidden bool
+	}{
+		{url: "https://93.184.216.34/hooks"},
+		{url: "http://127.0.0.1:8080/hooks", forbidden: true},
+		{url: "http://[::1]/hooks", forbidden: true},
+		{url: "http://169.254.169.254/latest/meta-data", forbidden: true},
+		{url: "http://localhost:8080/hooks", forbidden: true},
+	}
+	for _, tt := range tests {
+		err := policy.CheckURL(context.Background(), tt.url)
+		if forbidden := errors.Is(err, ErrForbiddenAddress); forbidden != tt.forbidden || (err != nil && !forbidden) {
+			t.Errorf("CheckURL(%s) = %v, want forbidden %v", tt.url, err, tt.forbidden)
+		}
+	}
+}
+
+// Адрес проверяется и при подключении, поэтому запись DNS, подменённая после регистрации вебхука, не поможет
+func TestAddressPolicyDialer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	get := func(policy AddressPolicy) error {
+		client := &http.Client{Transport: &http.Transport{DialContext: policy.Dialer(time.Second).DialContext}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(AddressPolicy{}); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("подключение к loopback: err = %v, want ErrForbiddenAddress", err)
+	}
+	allowLoopback, err := NewAddressPolicy([]string{"127.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewAddressPolicy: %v", err)
+	}
+	if err := get(allowLoopback); err != nil {
+		t.Errorf("подключение к разрешённой сети: %v", err)
+	}
+}
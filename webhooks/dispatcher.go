@@ -0,0 +1,155 @@
+// Package webhooks доставляет события подписок зарегистрированным вебхукам
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"effective_mobile/base"
+	"effective_mobile/config"
+	"effective_mobile/metrics"
+	"effective_mobile/retry"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Заголовки запроса доставки
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Dispatcher забирает из хранилища доставки, которым пора выполнить попытку, и отправляет их вебхукам.
+// Неудачная попытка повторяется с экспоненциальной задержкой, а вебхук, который ошибается слишком часто подряд, отключается.
+type Dispatcher struct {
+	store  base.SubscriptionStore
+	cfg    config.WebhookConfig
+	client *http.Client
+}
+
+// NewDispatcher создаёт доставщика событий по настройкам cfg; подключения к адресам, запрещённым policy, не выполняются
+func NewDispatcher(store base.SubscriptionStore, cfg config.WebhookConfig, policy AddressPolicy) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// без прокси из окружения: через него проверка адреса при подключении не сработала бы
+			Transport: &http.Transport{
+				DialContext:         policy.Dialer(cfg.Timeout).DialContext,
+				TLSHandshakeTimeout: cfg.Timeout,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// перенаправление может увести событие на непроверенный адрес
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run доставляет события каждые cfg.PollInterval, пока не отменён ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// полная пачка означает, что в очереди есть ещё доставки
+			for d.dispatchBatch(ctx) == d.cfg.BatchSize && ctx.Err() == nil {
+			}
+		}
+	}
+}
+
+// dispatchBatch выполняет попытки для одной пачки доставок параллельно и возвращает её размер
+func (d *Dispatcher) dispatchBatch(ctx context.Context) int {
+	// доставки откладываются на время, за которое пачка гарантированно завершится
+	lease := d.cfg.Timeout + time.Minute
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка выборки доставок вебхуков", "error", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery base.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries)
+}
+
+// attempt отправляет доставку и записывает итог попытки
+func (d *Dispatcher) attempt(ctx context.Context, delivery base.WebhookDelivery) {
+	status, err := d.send(ctx, delivery)
+
+	a := base.WebhookAttempt{DeliveryID: delivery.ID, EndpointID: delivery.EndpointID, ResponseStatus: status}
+	attempts := delivery.Attempts + 1
+	switch {
+	case err == nil:
+		a.Status = base.DeliverySucceeded
+	case attempts >= d.cfg.MaxAttempts:
+		a.Status = base.DeliveryFailed
+		a.Error = err.Error()
+	default:
+		a.Status = base.DeliveryPending
+		a.Error = err.Error()
+		a.NextAttemptAt = time.Now().Add(retry.Backoff(attempts, d.cfg.RetryBackoff, d.cfg.MaxRetryBackoff))
+	}
+	metrics.WebhookDeliveries.WithLabelValues(delivery.EventType, a.Status).Inc()
+
+	log := slog.With("delivery_id", delivery.ID, "webhook_id", delivery.EndpointID, "event", delivery.EventType, "attempt", attempts)
+	if err != nil {
+		log.WarnContext(ctx, "Ошибка доставки вебхука", "status", a.Status, "error", err)
+	}
+
+	// контекст без отмены: при остановке сервиса иначе потерялся бы итог уже выполненного запроса
+	disabled, err := d.store.FinishWebhookAttempt(context.WithoutCancel(ctx), a, d.cfg.DisableAfter)
+	if err != nil {
+		log.ErrorContext(ctx, "Ошибка записи итога доставки вебхука", "error", err)
+		return
+	}
+	if disabled {
+		log.WarnContext(ctx, "Вебхук отключён после ошибок доставки подряд", "failures", d.cfg.DisableAfter)
+	}
+}
+
+// send отправляет событие и возвращает код ответа; ошибкой считается всё, кроме ответа 2xx
+func (d *Dispatcher) send(ctx context.Context, delivery base.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "subscriptions-webhooks")
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// тело ответа не нужно, но дочитывается, чтобы соединение вернулось в пул
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("получатель ответил %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,166 @@
+package webhooks
+
+import (
+	"context"
+	"effective_mobile/base"
+	"effective_mobile/config"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+// receiver — получатель вебхуков, который отвечает status и запоминает запросы
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func newTestDispatcher(t *testing.T, status int) (*Dispatcher, *base.MemoryStore, *receiver, base.WebhookEndpoint) {
+	t.Helper()
+
+	rc := &receiver{status: status}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	store := base.NewMemoryStore()
+	endpoint, err := store.InsertWebhookEndpoint(context.Background(), base.WebhookEndpoint{URL: server.URL + "/hooks", Secret: testSecret})
+	if err != nil {
+		t.Fatalf("InsertWebhookEndpoint: %v", err)
+	}
+
+	// тестовый получатель слушает loopback, поэтому его сеть разрешается явно
+	policy, err := NewAddressPolicy([]string{"127.0.0.0/8", "::1/128"})
+	if err != nil {
+		t.Fatalf("NewAddressPolicy: %v", err)
+	}
+	cfg := config.WebhookConfig{
+		BatchSize:       10,
+		Timeout:         time.Second,
+		MaxAttempts:     2,
+		RetryBackoff:    time.Minute,
+		MaxRetryBackoff: time.Hour,
+		DisableAfter:    3,
+	}
+	return NewDispatcher(store, cfg, policy), store, rc, endpoint
+}
+
+func enqueue(t *testing.T, store base.SubscriptionStore) base.WebhookEvent {
+	t.Helper()
+
+	event := base.NewWebhookEvent(base.EventSubscriptionCreated, base.Subscription{ID: 1, UserID: "u1", Service: "netflix", Price: 400})
+	if _, err := store.EnqueueWebhookEvent(context.Background(), event); err != nil {
+		t.Fatalf("EnqueueWebhookEvent: %v", err)
+	}
+	return event
+}
+
+func lastDelivery(t *testing.T, store base.SubscriptionStore, endpointID int) base.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := store.SelectWebhookDeliveries(context.Background(), strconv.Itoa(endpointID), "", 1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("SelectWebhookDeliveries: %v, %v", deliveries, err)
+	}
+	return deliveries[0]
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	d, store, rc, endpoint := newTestDispatcher(t, http.StatusNoContent)
+	event := enqueue(t, store)
+
+	if n := d.dispatchBatch(context.Background()); n != 1 {
+		t.Fatalf("dispatchBatch = %d, want 1", n)
+	}
+	if len(rc.requests) != 1 {
+		t.Fatalf("получено %d запросов, want 1", len(rc.requests))
+	}
+
+	r, body := rc.requests[0], rc.bodies[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/hooks" {
+		t.Errorf("запрос %s %s", r.Method, r.URL.Path)
+	}
+	if r.Header.Get(HeaderEventID) != event.ID || r.Header.Get(HeaderEventType) != event.Type {
+		t.Errorf("заголовки события %v", r.Header)
+	}
+	if err := Verify(testSecret, r.Header.Get(HeaderSignature), body, time.Minute, time.Now()); err != nil {
+		t.Errorf("подпись: %v", err)
+	}
+	var got base.WebhookEvent
+	if err := json.Unmarshal(body, &got); err != nil || got.ID != event.ID || got.Data.Service != "netflix" {
+		t.Errorf("тело запроса %s, %v", body, err)
+	}
+
+	delivery := lastDelivery(t, store, endpoint.ID)
+	if delivery.Status != base.DeliverySucceeded || delivery.ResponseStatus != http.StatusNoContent || delivery.Attempts != 1 {
+		t.Errorf("доставка после успеха: %+v", delivery)
+	}
+	if n := d.dispatchBatch(context.Background()); n != 0 || len(rc.requests) != 1 {
+		t.Errorf("доставленное событие отправлено повторно")
+	}
+}
+
+func TestDispatcherRetriesAndFails(t *testing.T) {
+	d, store, rc, endpoint := newTestDispatcher(t, http.StatusInternalServerError)
+	enqueue(t, store)
+
+	before := time.Now()
+	d.dispatchBatch(context.Background())
+	delivery := lastDelivery(t, store, endpoint.ID)
+	if delivery.Status != base.DeliveryPending || delivery.ResponseStatus != http.StatusInternalServerError || delivery.LastError == "" {
+		t.Fatalf("доставка после первой ошибки: %+v", delivery)
+	}
+	// повтор не раньше RetryBackoff с точностью до разброса
+	if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.Before(before.Add(50*time.Second)) {
+		t.Errorf("следующая попытка в %v", delivery.NextAttemptAt)
+	}
+
+	// попытка, которой ещё не время, не выполняется
+	d.dispatchBatch(context.Background())
+	if len(rc.requests) != 1 {
+		t.Fatalf("получено %d запросов до времени повтора, want 1", len(rc.requests))
+	}
+
+	// последняя из MaxAttempts попыток завершает доставку ошибкой
+	delivery.URL, delivery.Secret = endpoint.URL, endpoint.Secret
+	d.attempt(context.Background(), delivery)
+	if len(rc.requests) != 2 {
+		t.Fatalf("получено %d запросов, want 2", len(rc.requests))
+	}
+	if got := lastDelivery(t, store, endpoint.ID); got.Status != base.DeliveryFailed || got.Attempts != 2 || got.NextAttemptAt != nil {
+		t.Errorf("доставка после последней попытки: %+v", got)
+	}
+}
+
+func TestDispatcherRefusesForbiddenAddress(t *testing.T) {
+	d, store, rc, endpoint := newTestDispatcher(t, http.StatusNoContent)
+	// без разрешённых сетей loopback запрещён
+	*d = *NewDispatcher(store, d.cfg, AddressPolicy{})
+	enqueue(t, store)
+
+	d.dispatchBatch(context.Background())
+	if len(rc.requests) != 0 {
+		t.Fatalf("запрос отправлен на запрещённый адрес")
+	}
+	if delivery := lastDelivery(t, store, endpoint.ID); delivery.Status != base.DeliveryPending || delivery.LastError == "" {
+		t.Errorf("доставка на запрещённый адрес: %+v", delivery)
+	}
+}
@@ -0,0 +1,66 @@
+package webhooks
+
+import (
+	"context"
+	"effective_mobile/base"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// Publisher — публикатор outbox, который ставит события created, updated и deleted в очередь доставки вебхукам.
+// ID события вебхука строится из ID события outbox, поэтому повторная публикация, например после ошибки
+// другого публикатора, не создаёт новых доставок.
+type Publisher struct {
+	store base.SubscriptionStore
+}
+
+// NewPublisher создаёт публикатора событий outbox в очередь вебхуков
+func NewPublisher(store base.SubscriptionStore) Publisher {
+	return Publisher{store: store}
+}
+
+func (Publisher) Name() string { return "webhooks" }
+
+func (p Publisher) Publish(ctx context.Context, e base.OutboxEvent) error {
+	if !slices.Contains(base.WebhookEventTypes, e.Type) {
+		return nil
+	}
+	var s base.Subscription
+	if err := json.Unmarshal(e.Data, &s); err != nil {
+		return err
+	}
+	event := base.WebhookEvent{ID: "outbox-" + strconv.FormatInt(e.ID, 10), Type: e.Type, CreatedAt: e.CreatedAt.UTC(), Data: s}
+	_, err := p.store.EnqueueWebhookEvent(ctx, event)
+	return err
+}
+
+// ExpiringChannel — канал напоминаний, который превращает напоминания об окончании подписки
+// в события subscription.expiring; напоминания о списаниях он пропускает
+type ExpiringChannel struct {
+	store base.SubscriptionStore
+}
+
+// NewExpiringChannel создаёт канал напоминаний для событий subscription.expiring
+func NewExpiringChannel(store base.SubscriptionStore) ExpiringChannel {
+	return ExpiringChannel{store: store}
+}
+
+func (ExpiringChannel) Name() string { return "webhooks" }
+
+func (c ExpiringChannel) Send(ctx context.Context, r base.Reminder) error {
+	if r.Kind != base.ReminderExpiry {
+		return nil
+	}
+	s, err := c.store.SelectSubscriptionByID(ctx, strconv.Itoa(r.SubscriptionID), false)
+	if errors.Is(err, base.ErrSubscriptionNotFound) {
+		// подписку удалили после поиска напоминаний
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.store.EnqueueWebhookEvent(ctx, base.NewWebhookEvent(base.EventSubscriptionExpiring, s))
+	return err
+}
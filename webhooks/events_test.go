@@ -0,0 +1,44 @@
+package webhooks
+
+import (
+	"context"
+	"effective_mobile/base"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPublisherEnqueuesOncePerOutboxEvent(t *testing.T) {
+	store := base.NewMemoryStore()
+	endpoint, err := store.InsertWebhookEndpoint(context.Background(), base.WebhookEndpoint{URL: "https://hooks.example.com", Secret: testSecret})
+	if err != nil {
+		t.Fatalf("InsertWebhookEndpoint: %v", err)
+	}
+	publisher := NewPublisher(store)
+
+	data, err := json.Marshal(base.Subscription{ID: 7, UserID: "u1", Service: "netflix", Price: 400})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	created := base.OutboxEvent{ID: 42, Type: base.EventSubscriptionCreated, SubscriptionID: 7, Data: data, CreatedAt: time.Now()}
+	restored := base.OutboxEvent{ID: 43, Type: base.EventSubscriptionRestored, SubscriptionID: 7, Data: data, CreatedAt: time.Now()}
+
+	// повторная публикация того же события outbox, например после ошибки другого публикатора, не создаёт новую доставку
+	for _, e := range []base.OutboxEvent{created, created, restored} {
+		if err := publisher.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish(%s): %v", e.Type, err)
+		}
+	}
+
+	deliveries, err := store.SelectWebhookDeliveries(context.Background(), strconv.Itoa(endpoint.ID), "", 10)
+	if err != nil {
+		t.Fatalf("SelectWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d доставок, want 1", len(deliveries))
+	}
+	if d := deliveries[0]; d.EventID != "outbox-42" || d.EventType != base.EventSubscriptionCreated {
+		t.Errorf("доставка %+v", d)
+	}
+}
@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecretPrefix отличает ключи подписи вебхуков от API-ключей
+const SecretPrefix = "whsec_"
+
+// GenerateSecret создаёт ключ подписи для вебхука, зарегистрированного без своего ключа
+func GenerateSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Sign возвращает значение заголовка X-Webhook-Signature: t=<unix-время>,v1=<hex HMAC-SHA256>.
+// Подписывается строка "<t>.<тело>", поэтому перехваченный запрос нельзя выдать за новый с другим временем.
+func Sign(secret string, at time.Time, body []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// Verify проверяет заголовок X-Webhook-Signature на стороне получателя; запросы старше tolerance отклоняются
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || v1 == "" {
+		return errors.New("некорректный заголовок подписи")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("подпись устарела")
+	}
+	if !hmac.Equal([]byte(v1), []byte(signature(secret, t, body))) {
+		return errors.New("подпись не совпадает")
+	}
+	return nil
+}
+
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package webhooks
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"id":"outbox-1","type":"subscription.created"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(secret, signedAt, body)
+
+	if !strings.HasPrefix(header, "t=1700000000,v1=") {
+		t.Fatalf("заголовок подписи %q", header)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "верная подпись", secret: secret, header: header, body: body, now: signedAt},
+		{name: "в пределах допуска", secret: secret, header: header, body: body, now: signedAt.Add(4 * time.Minute)},
+		{name: "часы получателя отстают", secret: secret, header: header, body: body, now: signedAt.Add(-4 * time.Minute)},
+		{name: "устаревшая подпись", secret: secret, header: header, body: body, now: signedAt.Add(6 * time.Minute), wantErr: true},
+		{name: "изменённое тело", secret: secret, header: header, body: []byte(`{"id":"outbox-2"}`), now: signedAt, wantErr: true},
+		{name: "другой ключ", secret: "whsec_other", header: header, body: body, now: signedAt, wantErr: true},
+		{
+			name: "подменённое время", secret: secret, body: body, now: signedAt.Add(time.Hour), wantErr: true,
+			header: strings.Replace(header, "t=1700000000", "t=1700003600", 1),
+		},
+		{name: "без подписи", secret: secret, header: "t=1700000000", body: body, now: signedAt, wantErr: true},
+		{name: "без времени", secret: secret, header: "v1=abc", body: body, now: signedAt, wantErr: true},
+		{name: "пустой заголовок", secret: secret, header: "", body: body, now: signedAt, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if !strings.HasPrefix(a, SecretPrefix) || len(a) < len(SecretPrefix)+32 {
+		t.Errorf("ключ %q", a)
+	}
+	if a == b {
+		t.Error("два ключа совпали")
+	}
+}